@@ -0,0 +1,158 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/etas94/godcbot/database"
+)
+
+// aliasCommand 是 /alias 指令群組的定義
+var aliasCommand = &discordgo.ApplicationCommand{
+	Name:        "alias",
+	Description: "管理圖片的別名",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "add",
+			Description: "為圖片加入別名",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				identifierOption,
+				{
+					Name:        "alias",
+					Description: "新的別名",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    true,
+				},
+				libraryOption,
+			},
+		},
+		{
+			Name:        "remove",
+			Description: "移除圖片的別名",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				identifierOption,
+				{
+					Name:         "alias",
+					Description:  "要移除的別名",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     true,
+					Autocomplete: true,
+				},
+				libraryOption,
+			},
+		},
+	},
+}
+
+// 處理 /alias add 與 /alias remove
+func handleAlias(s *discordgo.Session, i *discordgo.InteractionCreate, options optionMap) {
+	sub := i.ApplicationCommandData().Options[0].Name
+	identifier := options["identifier"].StringValue()
+	alias := options["alias"].StringValue()
+
+	scope := targetScope(i, options)
+	if !canWrite(i, scope) {
+		respondEphemeral(s, i, "你沒有權限修改全域圖庫。")
+		return
+	}
+	lib, err := storeFor(scope)
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		return
+	}
+
+	var before, updated database.ImageData
+	removed := true
+	err = lib.Transact(func(db *database.ImageDB) error {
+		img, ok := db.FindImage(identifier)
+		if !ok {
+			return database.ErrNotFound
+		}
+		before = img
+		var err error
+		if sub == "add" {
+			updated, err = db.AddAlias(img.ID, alias)
+		} else {
+			updated, removed, err = db.RemoveAlias(img.ID, alias)
+		}
+		if err == nil {
+			db.RecordRevision(&before, updated, interactionUser(i).ID, database.AuditUpdate, time.Now())
+		}
+		return err
+	})
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		respondEphemeral(s, i, fmt.Sprintf("找不到圖片 %q", identifier))
+		return
+	case errors.Is(err, database.ErrNameTaken):
+		respondEphemeral(s, i, fmt.Sprintf("無法加入別名，%v。", err))
+		return
+	case err != nil:
+		fmt.Println("儲存圖庫失敗:", err)
+		return
+	}
+
+	if !removed {
+		respondEphemeral(s, i, fmt.Sprintf("圖片 %q 沒有別名 %q。", updated.Name, alias))
+		return
+	}
+	if len(before.Aliases) != len(updated.Aliases) {
+		action := "加入別名 "
+		if sub == "remove" {
+			action = "移除別名 "
+		}
+		recordAudit(s, i, scope, database.AuditUpdate, &before, &updated, action+alias)
+	}
+	respondEphemeral(s, i, fmt.Sprintf("圖片 %q（ID：%s）目前的別名：%s", updated.Name, updated.ID, formatAliases(updated.Aliases)))
+}
+
+// 將別名格式化為顯示用的字串
+func formatAliases(aliases []string) string {
+	if len(aliases) == 0 {
+		return "（無）"
+	}
+	return strings.Join(aliases, ", ")
+}
+
+// 建議已選擇圖片的別名，供 /alias remove 使用
+func aliasChoices(i *discordgo.InteractionCreate, options optionMap, query string) ([]*discordgo.ApplicationCommandOptionChoice, error) {
+	opt, ok := options["identifier"]
+	if !ok {
+		return nil, nil
+	}
+	scope := targetScope(i, options)
+	if !canRead(i, scope) {
+		return nil, nil
+	}
+	lib, err := storeFor(scope)
+	if err != nil {
+		return nil, err
+	}
+	img, err := findImageExact(lib, opt.StringValue())
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	q := database.NormalizeName(query)
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, maxChoices)
+	for _, alias := range img.Aliases {
+		if len(choices) == maxChoices {
+			break
+		}
+		if len(alias) <= 100 && strings.Contains(database.NormalizeName(alias), q) { // Discord 選項值的長度上限
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+				Name:  truncate(alias, 100),
+				Value: alias,
+			})
+		}
+	}
+	return choices, nil
+}
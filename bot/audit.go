@@ -0,0 +1,251 @@
+package bot
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/etas94/godcbot/config"
+	"github.com/etas94/godcbot/database"
+)
+
+// auditLog 記錄所有對圖庫的修改
+var auditLog *database.AuditLog
+
+// 稽核紀錄保存在此檔案中，每行一筆
+const auditLogFilePath = "./audit.log"
+
+// auditLabels 是顯示給使用者的動作名稱
+var auditLabels = map[string]string{
+	database.AuditAdd:              "新增",
+	database.AuditDelete:           "刪除",
+	database.AuditUpdate:           "修改",
+	database.AuditRestore:          "還原",
+	database.AuditRevert:           "回復版本",
+	database.AuditClassify:         "更改分類",
+	database.AuditCategoryCreate:   "建立分類",
+	database.AuditCategoryRename:   "重新命名分類",
+	database.AuditCategoryMerge:    "合併分類",
+	database.AuditCategoryDelete:   "刪除分類",
+	database.AuditCategoryDescribe: "修改分類說明",
+}
+
+// auditCommand 是 /auditlog 指令群組的定義
+var auditCommand = &discordgo.ApplicationCommand{
+	Name:                     "auditlog",
+	Description:              "查看圖庫的修改紀錄",
+	DefaultMemberPermissions: &curatorPermission,
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "search",
+			Description: "查詢修改紀錄，最新的在前",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "user",
+					Description: "執行操作的使用者(可選)",
+					Type:        discordgo.ApplicationCommandOptionUser,
+					Required:    false,
+				},
+				{
+					Name:        "action",
+					Description: "動作(可選)",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "新增", Value: database.AuditAdd},
+						{Name: "刪除", Value: database.AuditDelete},
+						{Name: "修改", Value: database.AuditUpdate},
+						{Name: "還原", Value: database.AuditRestore},
+						{Name: "回復版本", Value: database.AuditRevert},
+						{Name: "更改分類", Value: database.AuditClassify},
+						{Name: "分類的變更", Value: database.AuditCategory},
+					},
+				},
+				{
+					Name:        "image",
+					Description: "圖片的ID(可選，已刪除的圖片請使用永久ID)",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+				},
+				{
+					Name:        "limit",
+					Description: "顯示的筆數(可選，預設為20)",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Required:    false,
+					MinValue:    &auditMinLimit,
+					MaxValue:    100,
+				},
+				libraryOption,
+			},
+		},
+		{
+			Name:        "channel",
+			Description: "設定同步張貼修改紀錄的頻道，未指定時停止張貼",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:         "channel",
+					Description:  "紀錄頻道(可選)",
+					Type:         discordgo.ApplicationCommandOptionChannel,
+					Required:     false,
+					ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+				},
+			},
+		},
+	},
+}
+
+// auditMinLimit 是 /auditlog search 的 limit 選項下限
+var auditMinLimit = 1.0
+
+// 記錄一筆對圖庫的修改，並張貼到伺服器設定的紀錄頻道
+// 寫入失敗只會記錄在主控台，不影響已經完成的操作
+func recordAudit(s *discordgo.Session, i *discordgo.InteractionCreate, scope, action string, before, after *database.ImageData, detail string) {
+	entry := appendAudit(i, scope, action, before, after, detail)
+	if i.GuildID == "" {
+		return
+	}
+	channelID := guildSettings.Get(i.GuildID).AuditChannel
+	if channelID == "" {
+		return
+	}
+	// 在背景張貼，不拖延互動的回應（Discord 要求在 3 秒內回應）
+	go func() {
+		_, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+			Content:         formatAuditEntry(entry),
+			AllowedMentions: &discordgo.MessageAllowedMentions{}, // 不要通知被提到的使用者
+		})
+		if err != nil {
+			fmt.Println("張貼稽核紀錄失敗:", err)
+		}
+	}()
+}
+
+// 只將一筆修改寫入稽核紀錄而不張貼，用於一次修改大量圖片時逐張記錄，頻道中只張貼摘要
+func appendAudit(i *discordgo.InteractionCreate, scope, action string, before, after *database.ImageData, detail string) database.AuditEntry {
+	entry := database.AuditEntry{
+		Time:   time.Now(),
+		Action: action,
+		Actor:  interactionUser(i).ID,
+		Guild:  i.GuildID,
+		Scope:  scope,
+		Before: before,
+		After:  after,
+		Detail: detail,
+	}
+	if after != nil {
+		entry.ImageID = after.ID
+	} else if before != nil {
+		entry.ImageID = before.ID
+	}
+
+	if err := auditLog.Append(entry); err != nil {
+		fmt.Println("寫入稽核紀錄失敗:", err)
+	}
+	return entry
+}
+
+// 將一筆紀錄格式化為一行文字
+func formatAuditEntry(e database.AuditEntry) string {
+	label := auditLabels[e.Action]
+	if label == "" {
+		label = e.Action
+	}
+	line := fmt.Sprintf("<t:%d:f> <@%s> %s", e.Time.Unix(), e.Actor, label)
+
+	img := e.After
+	if img == nil {
+		img = e.Before
+	}
+	if img != nil {
+		line += fmt.Sprintf(" `%s` %s", img.ID, img.Name)
+	}
+	if e.Detail != "" {
+		line += "：" + e.Detail
+	}
+	if e.Scope == database.GlobalScope {
+		line += "（全域圖庫）"
+	}
+	return line
+}
+
+// 處理 /auditlog search 與 /auditlog channel
+func handleAuditLog(s *discordgo.Session, i *discordgo.InteractionCreate, options optionMap) {
+	if i.ApplicationCommandData().Options[0].Name == "channel" {
+		handleAuditChannel(s, i, options)
+		return
+	}
+
+	scope := targetScope(i, options)
+	if !canRead(i, scope) {
+		respondEphemeral(s, i, "本伺服器尚未開啟全域圖庫。")
+		return
+	}
+
+	filter := database.AuditFilter{Scope: scope, Limit: 20}
+	if opt, ok := options["user"]; ok {
+		filter.Actor = opt.Value.(string)
+	}
+	if opt, ok := options["action"]; ok {
+		filter.Action = opt.StringValue()
+	}
+	if opt, ok := options["image"]; ok {
+		filter.ImageID = opt.StringValue()
+		// 圖片還在時也接受顯示代碼與舊ID
+		if lib, err := storeFor(scope); err == nil {
+			if img, err := lib.GetByID(filter.ImageID); err == nil {
+				filter.ImageID = img.ID
+			}
+		}
+	}
+	if opt, ok := options["limit"]; ok {
+		filter.Limit = int(opt.IntValue())
+	}
+
+	entries, err := auditLog.Query(filter)
+	if err != nil {
+		fmt.Println("讀取稽核紀錄失敗:", err)
+		return
+	}
+	if len(entries) == 0 {
+		respondEphemeral(s, i, "沒有符合條件的紀錄。")
+		return
+	}
+
+	content := ""
+	for _, e := range entries {
+		line := formatAuditEntry(e) + "\n"
+		if len(content)+len(line) > 1900 { // Discord 訊息長度上限為 2000
+			content += "……"
+			break
+		}
+		content += line
+	}
+	respondEphemeral(s, i, content)
+}
+
+// 處理 /auditlog channel
+func handleAuditChannel(s *discordgo.Session, i *discordgo.InteractionCreate, options optionMap) {
+	if i.GuildID == "" {
+		respondEphemeral(s, i, "此指令只能在伺服器中使用。")
+		return
+	}
+	channelID := ""
+	if opt, ok := options["channel"]; ok {
+		channelID = opt.Value.(string)
+	}
+	err := guildSettings.Update(i.GuildID, func(settings *config.GuildSettings) {
+		settings.AuditChannel = channelID
+	})
+	if err != nil {
+		fmt.Println("儲存伺服器設定失敗:", err)
+		respondEphemeral(s, i, "儲存伺服器設定失敗，請稍後再試。")
+		return
+	}
+	if channelID == "" {
+		respondEphemeral(s, i, "已停止張貼修改紀錄。")
+	} else {
+		respondEphemeral(s, i, fmt.Sprintf("之後的修改紀錄會同步張貼到 <#%s>。", channelID))
+	}
+}
@@ -0,0 +1,167 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/etas94/godcbot/database"
+)
+
+// maxChoices 是 Discord 自動完成最多可顯示的建議數量
+const maxChoices = 25
+
+// 處理自動完成，根據正在輸入的選項從圖庫中提供建議
+func handleAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	options := parseOptions(data.Options)
+
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	if focused := focusedOption(data.Options); focused != nil {
+		var err error
+		switch focused.Name {
+		case "identifier":
+			choices, err = identifierChoices(i, data.Name, options, focused.StringValue())
+		case "category", "source", "target", "reassign":
+			choices, err = categoryChoices(i, options, focused.StringValue())
+		case "alias":
+			choices, err = aliasChoices(i, options, focused.StringValue())
+		case "tags":
+			choices, err = tagChoices(i, options, focused.StringValue())
+		}
+		if err != nil {
+			fmt.Println("讀取圖庫失敗:", err)
+		}
+	}
+
+	response := &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	}
+	err := s.InteractionRespond(i.Interaction, response)
+	if err != nil {
+		fmt.Println("發送自動完成失敗:", err)
+	}
+}
+
+// 返回使用者正在輸入的選項，會一併搜尋子指令的選項
+func focusedOption(options []*discordgo.ApplicationCommandInteractionDataOption) *discordgo.ApplicationCommandInteractionDataOption {
+	for _, opt := range options {
+		if opt.Focused {
+			return opt
+		}
+		if focused := focusedOption(opt.Options); focused != nil {
+			return focused
+		}
+	}
+	return nil
+}
+
+// 返回可供自動完成的圖庫範圍
+// /image 與 /send 會搜尋所有可讀取的圖庫，其餘指令只搜尋要操作的圖庫
+func autocompleteScopes(i *discordgo.InteractionCreate, command string, options optionMap) []string {
+	if command == "image" || command == "send" {
+		return readableScopes(i)
+	}
+	scope := targetScope(i, options)
+	if !canRead(i, scope) {
+		return nil
+	}
+	return []string{scope}
+}
+
+// 根據輸入建議圖片，顯示為「ID – 名稱」，選擇後填入圖片ID
+func identifierChoices(i *discordgo.InteractionCreate, command string, options optionMap, query string) ([]*discordgo.ApplicationCommandOptionChoice, error) {
+	var results []database.SearchResult
+	for _, scope := range autocompleteScopes(i, command, options) {
+		lib, err := storeFor(scope)
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.TrimSpace(query) == "" {
+			// 還沒有輸入時依ID列出前幾張
+			all, err := lib.List()
+			if err != nil {
+				return nil, err
+			}
+			for _, img := range all {
+				results = append(results, database.SearchResult{Image: img})
+			}
+			continue
+		}
+
+		ranked, err := lib.RankedSearch(query, maxChoices)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, ranked...)
+	}
+
+	// 依分數排序，同分時保持圖庫的先後順序
+	sort.SliceStable(results, func(a, b int) bool {
+		return results[a].Score > results[b].Score
+	})
+
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, maxChoices)
+	seen := make(map[string]bool)
+	for _, r := range results {
+		if len(choices) == maxChoices {
+			break
+		}
+		if seen[r.Image.ID] { // 不同圖庫可能有相同的ID，只建議優先的那張
+			continue
+		}
+		seen[r.Image.ID] = true
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  truncate(fmt.Sprintf("%s – %s", r.Image.ID, r.Image.Name), 100),
+			Value: r.Image.ID,
+		})
+	}
+	return choices, nil
+}
+
+// 根據輸入建議分類名稱，名稱開頭相符的排在前面
+func categoryChoices(i *discordgo.InteractionCreate, options optionMap, query string) ([]*discordgo.ApplicationCommandOptionChoice, error) {
+	scope := targetScope(i, options)
+	if !canRead(i, scope) {
+		return nil, nil
+	}
+	lib, err := storeFor(scope)
+	if err != nil {
+		return nil, err
+	}
+	categories, err := lib.Categories()
+	if err != nil {
+		return nil, err
+	}
+
+	q := database.NormalizeName(query)
+	var prefixed, contained []string
+	for name := range categories {
+		normalized := database.NormalizeName(name)
+		switch {
+		case strings.HasPrefix(normalized, q):
+			prefixed = append(prefixed, name)
+		case strings.Contains(normalized, q):
+			contained = append(contained, name)
+		}
+	}
+	sort.Strings(prefixed)
+	sort.Strings(contained)
+
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, maxChoices)
+	for _, name := range append(prefixed, contained...) {
+		if len(choices) == maxChoices {
+			break
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  truncate(fmt.Sprintf("%s (%s)", name, categories[name]), 100),
+			Value: name,
+		})
+	}
+	return choices, nil
+}
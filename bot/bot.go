@@ -1,8 +1,10 @@
 package bot
 
 import (
+	"errors"
 	"fmt"
-	"sort"
+	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/etas94/godcbot/config"
@@ -11,7 +13,8 @@ import (
 
 var goBot *discordgo.Session
 
-const ImgDbFilePath = "./image.json"
+// dmDisabled 用於只能在伺服器中使用的指令
+var dmDisabled = false
 
 // 初始化機器人並啟動
 func Start() {
@@ -22,16 +25,51 @@ func Start() {
 		return
 	}
 
+	libraries, err = openRegistry(cfg)
+	if err != nil {
+		fmt.Println("開啟圖庫失敗:", err)
+		return
+	}
+
+	blobs, err = database.OpenBlobStore(blobDir)
+	if err != nil {
+		fmt.Println("開啟圖片檔案目錄失敗:", err)
+		return
+	}
+	if cfg.MaxUploadMB > 0 {
+		maxUploadSize = int64(cfg.MaxUploadMB) << 20
+	}
+
+	guildSettings, err = config.LoadGuildSettings(guildSettingsFilePath)
+	if err != nil {
+		fmt.Println("讀取伺服器設定失敗:", err)
+		return
+	}
+
+	auditLog, err = database.OpenAuditLog(auditLogFilePath)
+	if err != nil {
+		fmt.Println("開啟稽核紀錄失敗:", err)
+		return
+	}
+
+	submissions, err = database.LoadSubmissions(submissionsFilePath)
+	if err != nil {
+		fmt.Println("讀取投稿失敗:", err)
+		return
+	}
+
+	for _, id := range cfg.GlobalAdmins {
+		globalAdmins[id] = true
+	}
+
 	goBot, err = discordgo.New("Bot " + cfg.Token)
 	if err != nil {
 		fmt.Println("初始化Discord對話失敗:", err)
 		return
 	}
 
-	// 註冊互動事件處理器來管理 Slash Command。
-	goBot.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-		handleCommand(s, i)
-	})
+	// 註冊互動事件處理器來管理 Slash Command 與訊息元件。
+	goBot.AddHandler(handleInteraction)
 
 	// 與Discord連接。
 	err = goBot.Open()
@@ -42,6 +80,12 @@ func Start() {
 
 	fmt.Println("機器人已成功連接！")
 
+	// 所有設定與紀錄都載入成功後才啟動背景工作，初始化失敗時不會留下執行中的 goroutine
+	startMirrorer(cfg)
+	startLinkChecker(cfg)
+	startBlobCollector()
+	startTrashPurger(cfg) // 清理後會使用 blobCollector 回收檔案
+
 	// 註冊Slash Commands
 	commands := []*discordgo.ApplicationCommand{
 		{
@@ -53,10 +97,11 @@ func Start() {
 			Description: "根據名稱或ID獲取圖片",
 			Options: []*discordgo.ApplicationCommandOption{
 				{
-					Name:        "identifier",
-					Description: "圖片的名稱或ID",
-					Type:        discordgo.ApplicationCommandOptionString,
-					Required:    true,
+					Name:         "identifier",
+					Description:  "圖片的名稱或ID",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     true,
+					Autocomplete: true,
 				},
 			},
 		},
@@ -72,28 +117,39 @@ func Start() {
 				},
 				{
 					Name:        "url",
-					Description: "圖片的網址",
+					Description: "圖片的網址(與附件擇一)",
 					Type:        discordgo.ApplicationCommandOptionString,
-					Required:    true,
+					Required:    false,
 				},
 				{
-					Name:        "category",
-					Description: "圖片的分類(可選)",
-					Type:        discordgo.ApplicationCommandOptionString,
+					Name:         "category",
+					Description:  "圖片的分類(可選)",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: true,
+				},
+				libraryOption,
+				{
+					Name:        "attachment",
+					Description: "要上傳的圖片檔案(與網址擇一)",
+					Type:        discordgo.ApplicationCommandOptionAttachment,
 					Required:    false,
 				},
 			},
 		},
 		{
-			Name:        "delimage",
-			Description: "從圖庫中刪除圖片",
+			Name:                     "delimage",
+			Description:              "從圖庫中刪除圖片",
+			DefaultMemberPermissions: &curatorPermission,
 			Options: []*discordgo.ApplicationCommandOption{
 				{
-					Name:        "identifier",
-					Description: "圖片的名稱或ID",
-					Type:        discordgo.ApplicationCommandOptionString,
-					Required:    true,
+					Name:         "identifier",
+					Description:  "圖片的名稱或ID",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     true,
+					Autocomplete: true,
 				},
+				libraryOption,
 			},
 		},
 		{
@@ -101,22 +157,24 @@ func Start() {
 			Description: "機器人代為傳圖",
 			Options: []*discordgo.ApplicationCommandOption{
 				{
-					Name:        "identifier",
-					Description: "圖片的名稱或ID",
-					Type:        discordgo.ApplicationCommandOptionString,
-					Required:    true,
+					Name:         "identifier",
+					Description:  "圖片的名稱或ID",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     true,
+					Autocomplete: true,
 				},
 			},
 		},
 		{
 			Name:        "list",
-			Description: "列出指定分類中的圖片",
+			Description: "列出指定分類或標籤中的圖片",
 			Options: []*discordgo.ApplicationCommandOption{
 				{
-					Name:        "category",
-					Description: "篩選的分類",
-					Type:        discordgo.ApplicationCommandOptionString,
-					Required:    true,
+					Name:         "category",
+					Description:  "篩選的分類(可選)",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: true,
 				},
 				{
 					Name:        "page",
@@ -124,6 +182,32 @@ func Start() {
 					Type:        discordgo.ApplicationCommandOptionInteger,
 					Required:    false,
 				},
+				libraryOption,
+				tagsOption(false),
+				{
+					Name:        "match",
+					Description: "標籤的篩選方式(可選，預設為全部符合)",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "全部符合", Value: "all"},
+						{Name: "任一符合", Value: "any"},
+					},
+				},
+				{
+					Name:        "format",
+					Description: "篩選的圖片格式(可選)",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "PNG", Value: "png"},
+						{Name: "JPEG", Value: "jpeg"},
+						{Name: "GIF", Value: "gif"},
+						{Name: "WebP", Value: "webp"},
+						{Name: "動態圖片", Value: "animated"},
+					},
+				},
+				gridOption,
 			},
 		},
 		{
@@ -136,22 +220,56 @@ func Start() {
 					Type:        discordgo.ApplicationCommandOptionInteger,
 					Required:    false,
 				},
+				libraryOption,
+				gridOption,
 			},
 		},
 		{
-			Name:        "classify",
-			Description: "更新圖片的分類",
+			Name:                     "classify",
+			Description:              "更新圖片的分類",
+			DefaultMemberPermissions: &curatorPermission,
 			Options: []*discordgo.ApplicationCommandOption{
 				{
-					Name:        "identifier",
-					Description: "圖片的名稱或ID",
-					Type:        discordgo.ApplicationCommandOptionString,
-					Required:    true,
+					Name:         "identifier",
+					Description:  "圖片的名稱或ID",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     true,
+					Autocomplete: true,
 				},
 				{
-					Name:        "category",
-					Description: "新的分類名稱",
-					Type:        discordgo.ApplicationCommandOptionString,
+					Name:         "category",
+					Description:  "新的分類名稱",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     true,
+					Autocomplete: true,
+				},
+				libraryOption,
+			},
+		},
+		tagCommand,
+		aliasCommand,
+		categoryCommand,
+		imageHealthCommand,
+		permissionsCommand,
+		submissionsCommand,
+		auditCommand,
+		restoreCommand,
+		historyCommand,
+		{
+			Name:         uploadMenuName,
+			Type:         discordgo.MessageApplicationCommand,
+			DMPermission: &dmDisabled,
+		},
+		{
+			Name:                     "globallibrary",
+			Description:              "設定本伺服器是否讀取共用的全域圖庫",
+			DefaultMemberPermissions: &adminPermission,
+			DMPermission:             &dmDisabled,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "enabled",
+					Description: "是否開啟全域圖庫",
+					Type:        discordgo.ApplicationCommandOptionBoolean,
 					Required:    true,
 				},
 			},
@@ -174,614 +292,290 @@ func Start() {
 	}
 }
 
-// 處理Slash Command
-func handleCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	switch i.ApplicationCommandData().Name {
-	case "ping":
-		response := &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: "Pong!",
-			},
-		}
-		err := s.InteractionRespond(i.Interaction, response)
-		if err != nil {
-			fmt.Println("發送回應失敗:", err)
-		}
-
-	case "image":
-		identifier := i.ApplicationCommandData().Options[0].StringValue()
-		db, err := database.LoadDatabase(ImgDbFilePath)
-		if err != nil {
-			fmt.Println("讀取圖片庫失敗:", err)
-			return
+// 關閉機器人，並在結束前保存圖庫中尚未寫入的變更
+func Stop() {
+	if goBot != nil {
+		goBot.Close()
+	}
+	if mirrorer != nil {
+		mirrorer.Stop()
+	}
+	if linkChecker != nil {
+		linkChecker.Stop()
+	}
+	if trashPurger != nil {
+		trashPurger.Stop()
+	}
+	if blobCollector != nil {
+		blobCollector.Stop()
+	}
+	if libraries != nil {
+		if err := libraries.Close(); err != nil {
+			fmt.Println("關閉圖庫失敗:", err)
 		}
+	}
+	if auditLog != nil {
+		auditLog.Close()
+	}
+}
 
-		var imageData database.ImageData
-		var found bool
-
-		// 檢查輸入是否為 ID
-		for _, img := range db.Images {
-			if img.ID == identifier {
-				imageData = img
-				found = true
-				break
-			}
-		}
+// 回應僅使用者可見的文字訊息
+func respondEphemeral(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	response := &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral, // 僅使用者可見。
+		},
+	}
+	err := s.InteractionRespond(i.Interaction, response)
+	if err != nil {
+		fmt.Println("發送回應失敗:", err)
+	}
+}
 
-		if !found {
-			// 使用 SearchImageByName 函數進行搜尋
-			matchedID, err := database.SearchImageByName(db, identifier)
-			if err != nil || matchedID == "" {
-				response := &discordgo.InteractionResponse{
-					Type: discordgo.InteractionResponseChannelMessageWithSource,
-					Data: &discordgo.InteractionResponseData{
-						Content: fmt.Sprintf("找不到圖片 %q", identifier),
-						Flags:   discordgo.MessageFlagsEphemeral, // 僅使用者可見。
-					},
-				}
-				err = s.InteractionRespond(i.Interaction, response)
-				if err != nil {
-					fmt.Println("發送回應失敗:", err)
-				}
-				return
-			}
+// optionMap 以名稱索引指令的選項，讓可選的選項不必依照固定位置讀取
+type optionMap map[string]*discordgo.ApplicationCommandInteractionDataOption
 
-			// 從 db.Images 中尋找對應的圖片資料
-			for _, img := range db.Images {
-				if img.ID == matchedID {
-					imageData = img
-					found = true
-					break
-				}
+// 將指令選項轉為以名稱索引的映射，子指令的選項會一併展開
+func parseOptions(options []*discordgo.ApplicationCommandInteractionDataOption) optionMap {
+	m := make(optionMap, len(options))
+	for _, opt := range options {
+		m[opt.Name] = opt
+		if opt.Type == discordgo.ApplicationCommandOptionSubCommand || opt.Type == discordgo.ApplicationCommandOptionSubCommandGroup {
+			for name, sub := range parseOptions(opt.Options) {
+				m[name] = sub
 			}
 		}
+	}
+	return m
+}
 
-		if !found { //找不到此ID
-			response := &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Content: fmt.Sprintf("找不到圖片 %q", identifier),
-					Flags:   discordgo.MessageFlagsEphemeral,
-				},
-			}
-			err = s.InteractionRespond(i.Interaction, response)
-			if err != nil {
-				fmt.Println("發送回應失敗:", err)
-			}
+// 依互動類型分派事件
+func handleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		// 所有指令在分派前統一檢查權限
+		if !authorize(s, i, commandRole(i.ApplicationCommandData())) {
 			return
 		}
-
-		// 建立圖片嵌入訊息
-		embed := &discordgo.MessageEmbed{
-			Title: fmt.Sprintf("圖片: %s", imageData.Name),
-			Image: &discordgo.MessageEmbedImage{
-				URL: imageData.URL,
-			},
-		}
-
-		response := &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Embeds: []*discordgo.MessageEmbed{embed},
-				Flags:  discordgo.MessageFlagsEphemeral, // 僅使用者可見。
-			},
-		}
-		err = s.InteractionRespond(i.Interaction, response)
-		if err != nil {
-			fmt.Println("發送回應失敗:", err)
-		}
-
-	case "addimage":
-		name := i.ApplicationCommandData().Options[0].StringValue()
-		url := i.ApplicationCommandData().Options[1].StringValue()
-
-		var category string
-		if len(i.ApplicationCommandData().Options) > 2 { //有category參數
-			category = i.ApplicationCommandData().Options[2].StringValue()
-		} else {
-			category = "NULL"
-		}
-
-		db, err := database.LoadDatabase(ImgDbFilePath)
-		if err != nil {
-			fmt.Println("讀取圖庫失敗:", err)
+		handleCommand(s, i)
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		handleAutocomplete(s, i)
+	case discordgo.InteractionMessageComponent:
+		action, _, _ := strings.Cut(i.MessageComponentData().CustomID, ":")
+		if !authorize(s, i, componentRole(action)) {
 			return
 		}
-
-		if db.Categories == nil { //初始化分類
-			db.Categories = make(map[string]string)
-		}
-
-		categoryID := db.Categories[category]
-		if categoryID == "" { //沒提供分類或無此分類
-			if category == "NULL" {
-				categoryID = "00"
-			} else {
-				categoryID = fmt.Sprintf("%02d", len(db.Categories)) //分類ID為2位數
-			}
-			db.Categories[category] = categoryID
-		}
-
-		// 計算ID，先填補空缺的ID
-		existingIDs := make(map[string]bool)
-		for _, img := range db.Images {
-			if img.Category == categoryID {
-				existingIDs[img.ID] = true
-			}
-		}
-
-		id := ""
-		for i := 1; i <= len(existingIDs)+1; i++ { // 限制迴圈範圍
-			candidateID := fmt.Sprintf("%s%03d", categoryID, i)
-			if !existingIDs[candidateID] {
-				id = candidateID
-				break
-			}
-		}
-
-		if id == "" {
-			fmt.Println("無法生成唯一的ID")
+		handleComponent(s, i)
+	case discordgo.InteractionModalSubmit:
+		action, _, _ := strings.Cut(i.ModalSubmitData().CustomID, ":")
+		if !authorize(s, i, componentRole(action)) {
 			return
 		}
+		handleModal(s, i)
+	}
+}
 
-		db.Images[name] = database.ImageData{
-			URL:      url,
-			Name:     name,
-			ID:       id,
-			Category: categoryID,
-		}
+// 處理訊息元件（按鈕、選單），CustomID 的格式為 "動作:參數"
+func handleComponent(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	action, arg, _ := strings.Cut(i.MessageComponentData().CustomID, ":")
+	switch action {
+	case "pick":
+		handlePick(s, i, arg)
+	case "list":
+		handleListPage(s, i, arg)
+	case "dup-confirm":
+		handleDuplicateConfirm(s, i, arg)
+	case "dup-cancel":
+		handleDuplicateCancel(s, i, arg)
+	case "health-delete":
+		handleHealthDelete(s, i, arg)
+	case "health-replace":
+		handleHealthReplace(s, i, arg)
+	case "trash-undo":
+		handleTrashUndo(s, i, arg)
+	case "history-revert":
+		handleHistoryRevert(s, i, arg)
+	case "sub-approve":
+		handleSubmissionApprove(s, i, arg)
+	case "sub-reject":
+		handleSubmissionReject(s, i, arg)
+	case "sub-edit":
+		handleSubmissionEdit(s, i, arg)
+	}
+}
 
-		err = database.SaveDatabase(ImgDbFilePath, db)
-		if err != nil {
-			fmt.Println("上傳圖片失敗:", err)
-			return
-		}
+// 處理表單的送出，CustomID 的格式與訊息元件相同
+func handleModal(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	action, arg, _ := strings.Cut(i.ModalSubmitData().CustomID, ":")
+	switch action {
+	case "upload":
+		handleUploadModal(s, i, arg)
+	case "health-replace":
+		handleHealthReplaceModal(s, i, arg)
+	case "sub-edit":
+		handleSubmissionEditModal(s, i, arg)
+	}
+}
 
+// 處理Slash Command
+func handleCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	options := parseOptions(i.ApplicationCommandData().Options)
+
+	switch i.ApplicationCommandData().Name {
+	case "ping":
 		response := &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
-				Content: fmt.Sprintf("成功添加圖片 %q，分類為：%s，ID為：%s，網址為：%s", name, category, id, url),
-				Flags:   discordgo.MessageFlagsEphemeral, // 僅使用者可見。
+				Content: "Pong!",
 			},
 		}
-		err = s.InteractionRespond(i.Interaction, response)
+		err := s.InteractionRespond(i.Interaction, response)
 		if err != nil {
 			fmt.Println("發送回應失敗:", err)
 		}
 
-	case "delimage":
-		identifier := i.ApplicationCommandData().Options[0].StringValue()
+	case "image", "send":
+		command := i.ApplicationCommandData().Name
+		identifier := options["identifier"].StringValue()
 
-		db, err := database.LoadDatabase(ImgDbFilePath)
-		if err != nil {
-			fmt.Println("讀取圖庫失敗:", err)
+		imageData, candidates, err := resolveImage(i, identifier)
+		if errors.Is(err, database.ErrNotFound) {
+			respondEphemeral(s, i, fmt.Sprintf("找不到圖片 %q", identifier))
 			return
 		}
-
-		var nameToDelete string
-		for name, img := range db.Images {
-			if img.Name == identifier || img.ID == identifier {
-				nameToDelete = name
-				break
-			}
-		}
-
-		if nameToDelete == "" {
-			response := &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Content: fmt.Sprintf("找不到圖片 %q", identifier),
-					Flags:   discordgo.MessageFlagsEphemeral, // 僅使用者可見。
-				},
-			}
-			err := s.InteractionRespond(i.Interaction, response)
-			if err != nil {
-				fmt.Println("發送回應失敗:", err)
-			}
-			return
-		}
-
-		delete(db.Images, nameToDelete)
-		err = database.SaveDatabase(ImgDbFilePath, db)
 		if err != nil {
-			fmt.Println("刪除圖片失敗:", err)
+			fmt.Println("讀取圖片庫失敗:", err)
 			return
 		}
 
-		response := &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: fmt.Sprintf("成功刪除 %q。", identifier),
-				Flags:   discordgo.MessageFlagsEphemeral, // 僅使用者可見。
-			},
-		}
-		err = s.InteractionRespond(i.Interaction, response)
-		if err != nil {
-			fmt.Println("發送回應失敗:", err)
-		}
-
-	case "send":
-		identifier := i.ApplicationCommandData().Options[0].StringValue()
-		db, err := database.LoadDatabase(ImgDbFilePath)
-		if err != nil {
-			fmt.Println("讀取圖片庫失敗:", err)
+		// 多張圖片分數接近時，讓使用者選擇而不是隨便挑一張
+		if candidates != nil {
+			respondPicker(s, i, command, candidates)
 			return
 		}
 
-		var imageData database.ImageData
-		var found bool
-
-		// 檢查輸入是否為 ID
-		for _, img := range db.Images {
-			if img.ID == identifier {
-				imageData = img
-				found = true
-				break
-			}
+		if command == "image" {
+			respondImage(s, i, imageData, discordgo.InteractionResponseChannelMessageWithSource)
+		} else {
+			respondSend(s, i, imageData)
 		}
 
-		if !found {
-			// 使用 SearchImageByName 函數進行搜尋
-			matchedID, err := database.SearchImageByName(db, identifier)
-			if err != nil || matchedID == "" { //找不到此名稱
-				response := &discordgo.InteractionResponse{
-					Type: discordgo.InteractionResponseChannelMessageWithSource,
-					Data: &discordgo.InteractionResponseData{
-						Content: fmt.Sprintf("找不到圖片 %q", identifier),
-						Flags:   discordgo.MessageFlagsEphemeral, // 僅使用者可見。
-					},
-				}
-				err = s.InteractionRespond(i.Interaction, response)
-				if err != nil {
-					fmt.Println("發送回應失敗:", err)
-				}
-				return
-			}
+	case "addimage":
+		handleAddImage(s, i, options)
 
-			// 從 db.Images 中尋找對應的圖片資料
-			for _, img := range db.Images {
-				if img.ID == matchedID {
-					imageData = img
-					found = true
-					break
-				}
-			}
-		}
+	case "delimage":
+		identifier := options["identifier"].StringValue()
 
-		if !found { //找不到此ID
-			response := &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Content: fmt.Sprintf("找不到圖片 %q", identifier),
-					Flags:   discordgo.MessageFlagsEphemeral,
-				},
-			}
-			err = s.InteractionRespond(i.Interaction, response)
-			if err != nil {
-				fmt.Println("發送回應失敗:", err)
-			}
+		scope := targetScope(i, options)
+		if !canWrite(i, scope) {
+			respondEphemeral(s, i, "你沒有權限修改全域圖庫。")
 			return
 		}
-
-		embed := &discordgo.MessageEmbed{
-			Image: &discordgo.MessageEmbedImage{
-				URL: imageData.URL,
-			},
-		}
-
-		response := &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: fmt.Sprintf("From %s", i.Member.User.Mention()),
-				Embeds:  []*discordgo.MessageEmbed{embed},
-			},
-		}
-		err = s.InteractionRespond(i.Interaction, response)
+		lib, err := storeFor(scope)
 		if err != nil {
-			fmt.Println("發送回應失敗:", err)
+			fmt.Println("讀取圖庫失敗:", err)
+			return
 		}
 
-	case "list":
-		var categoryFilter string
-		if len(i.ApplicationCommandData().Options) > 0 {
-			categoryFilter = i.ApplicationCommandData().Options[0].StringValue()
+		img, err := findImageExact(lib, identifier)
+		if errors.Is(err, database.ErrNotFound) {
+			respondEphemeral(s, i, fmt.Sprintf("找不到圖片 %q", identifier))
+			return
 		}
-
-		db, err := database.LoadDatabase(ImgDbFilePath)
 		if err != nil {
 			fmt.Println("讀取圖庫失敗:", err)
 			return
 		}
 
-		var filteredImages []database.ImageData
-		if categoryFilter != "" {
-			categoryCode := ""
-			for name, code := range db.Categories {
-				if name == categoryFilter {
-					categoryCode = code
-					break
-				}
-			}
-			if categoryCode == "" { //無此分類
-				response := &discordgo.InteractionResponse{
-					Type: discordgo.InteractionResponseChannelMessageWithSource,
-					Data: &discordgo.InteractionResponseData{
-						Content: fmt.Sprintf("找不到分類 %q。", categoryFilter),
-						Flags:   discordgo.MessageFlagsEphemeral,
-					},
-				}
-				err := s.InteractionRespond(i.Interaction, response)
-				if err != nil {
-					fmt.Println("發送回應失敗:", err)
-				}
-				return
-			}
-			for _, img := range db.Images {
-				if img.Category == categoryCode {
-					filteredImages = append(filteredImages, img)
-				}
-			}
-		} else {
-			response := &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Content: "請提供分類來列出圖片。",
-					Flags:   discordgo.MessageFlagsEphemeral,
-				},
-			}
-			err := s.InteractionRespond(i.Interaction, response)
-			if err != nil {
-				fmt.Println("發送回應失敗:", err)
-			}
+		img, err = trashImage(s, i, lib, scope, img.ID, "")
+		if err != nil {
+			fmt.Println("刪除圖片失敗:", err)
 			return
 		}
+		respondTrashed(s, i, scope, img)
 
-		// 按ID排序
-		sort.Slice(filteredImages, func(i, j int) bool {
-			return filteredImages[i].ID < filteredImages[j].ID
-		})
+	case "list":
+		handleList(s, i, options)
 
-		totalImages := len(filteredImages)
-		pages := (totalImages + 19) / 20
+	case "listall":
+		handleListAll(s, i, options)
 
-		currentPage := 0
-		if len(i.ApplicationCommandData().Options) > 1 {
-			currentPage = int(i.ApplicationCommandData().Options[1].IntValue()) - 1 // 調整為零基索引
-		}
+	case "classify":
+		identifier := options["identifier"].StringValue()
+		newCategory := options["category"].StringValue()
 
-		if currentPage < 0 || currentPage >= pages {
-			response := &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Content: fmt.Sprintf("頁數超出範圍。總共 %d 頁。", pages),
-					Flags:   discordgo.MessageFlagsEphemeral,
-				},
-			}
-			err := s.InteractionRespond(i.Interaction, response)
-			if err != nil {
-				fmt.Println("發送回應失敗:", err)
-			}
+		scope := targetScope(i, options)
+		if !canWrite(i, scope) {
+			respondEphemeral(s, i, "你沒有權限修改全域圖庫。")
 			return
 		}
-
-		start := currentPage * 20
-		end := start + 20
-		if end > totalImages {
-			end = totalImages
-		}
-
-		content := ""
-		if categoryFilter != "" {
-			content += fmt.Sprintf("%s:\n", categoryFilter) //列出分類名稱
-		}
-
-		for _, img := range filteredImages[start:end] {
-			content += fmt.Sprintf("ID: %s   名稱: %s\n", img.ID, img.Name)
-		}
-
-		if content == "" {
-			content = "無圖片可顯示。"
-		}
-
-		content += fmt.Sprintf("\n第 %d/%d 頁", currentPage+1, pages)
-
-		response := &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: content,
-				Flags:   discordgo.MessageFlagsEphemeral,
-			},
-		}
-		err = s.InteractionRespond(i.Interaction, response)
-		if err != nil {
-			fmt.Println("發送回應失敗:", err)
-		}
-
-	case "listall":
-		// 初始化當前頁數，如果未提供則預設為第 1 頁
-		var currentPage int = 1
-		if len(i.ApplicationCommandData().Options) > 0 {
-			currentPage = int(i.ApplicationCommandData().Options[0].IntValue())
-			if currentPage < 1 {
-				currentPage = 1 // 確保頁數最小為 1
-			}
-		}
-
-		// 從資料庫加載圖片數據
-		db, err := database.LoadDatabase(ImgDbFilePath)
+		lib, err := storeFor(scope)
 		if err != nil {
 			fmt.Println("讀取圖庫失敗:", err)
 			return
 		}
 
-		// 將所有圖片添加到切片中
-		var allImages []database.ImageData
-		for _, img := range db.Images {
-			allImages = append(allImages, img)
-		}
-
-		// 按ID對圖片進行排序
-		sort.Slice(allImages, func(i, j int) bool {
-			return allImages[i].ID < allImages[j].ID
-		})
-
-		// 計算總圖片數量和頁數
-		totalImages := len(allImages)
-		pages := (totalImages + 19) / 20
-
-		// 如果當前頁數超出範圍，返回錯誤消息
-		if currentPage > pages {
-			response := &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Content: fmt.Sprintf("頁數超出範圍。總共 %d 頁。", pages),
-					Flags:   discordgo.MessageFlagsEphemeral,
-				},
+		var before, imageToClassify database.ImageData
+		err = lib.Transact(func(db *database.ImageDB) error {
+			img, ok := db.FindImage(identifier)
+			if !ok {
+				return database.ErrNotFound
 			}
-			err := s.InteractionRespond(i.Interaction, response)
-			if err != nil {
-				fmt.Println("發送回應失敗:", err)
+			before = img
+			// 永久ID不變，只重新分配顯示代碼
+			imageToClassify, ok = db.Reclassify(img.ID, newCategory)
+			if !ok {
+				return database.ErrNotFound
 			}
+			db.RecordRevision(&before, imageToClassify, interactionUser(i).ID, database.AuditClassify, time.Now())
+			return nil
+		})
+		if errors.Is(err, database.ErrNotFound) { //找不到圖片
+			respondEphemeral(s, i, fmt.Sprintf("找不到圖片 %q", identifier))
 			return
 		}
-
-		// 計算當前頁面的圖片範圍
-		start := (currentPage - 1) * 20
-		end := start + 20
-		if end > totalImages {
-			end = totalImages
-		}
-
-		// 構建輸出內容
-		content := ""
-		lastCategory := ""
-		for _, img := range allImages[start:end] {
-			// 如果分類變化，添加分類標題
-			if img.Category != lastCategory {
-				lastCategory = img.Category
-				categoryName := "未分類" // 默認為未分類
-				for name, code := range db.Categories {
-					if code == lastCategory {
-						categoryName = name
-						break
-					}
-				}
-				if lastCategory == "00" {
-					categoryName = "未分類"
-				}
-				content += fmt.Sprintf("\n%s:\n", categoryName)
-			}
-			// 添加圖片的ID和名稱
-			content += fmt.Sprintf("ID: %s   名稱: %s\n", img.ID, img.Name)
-		}
-
-		// 如果沒有內容，顯示無圖片
-		if content == "" {
-			content = "無圖片可顯示"
+		if err != nil {
+			fmt.Println("儲存圖庫失敗:", err)
+			return
 		}
+		recordAudit(s, i, scope, database.AuditClassify, &before, &imageToClassify, fmt.Sprintf("%s → %s", before.Code, imageToClassify.Code))
 
-		// 添加頁碼
-		content += fmt.Sprintf("\n第 %d/%d 頁", currentPage, pages)
+		respondEphemeral(s, i, fmt.Sprintf("成功將圖片 %q 分類到 %q，永久ID為 %q，新的顯示代碼為 %q（舊的ID與代碼仍可使用）", imageToClassify.Name, newCategory, imageToClassify.ID, imageToClassify.Code))
 
-		// 發送響應
-		response := &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: content,
-				Flags:   discordgo.MessageFlagsEphemeral,
-			},
-		}
-		err = s.InteractionRespond(i.Interaction, response)
-		if err != nil {
-			fmt.Println("發送回應失敗:", err)
-		}
+	case "tag":
+		handleTag(s, i, options)
 
-	case "classify":
-		identifier := i.ApplicationCommandData().Options[0].StringValue()
-		newCategory := i.ApplicationCommandData().Options[1].StringValue()
+	case "alias":
+		handleAlias(s, i, options)
 
-		db, err := database.LoadDatabase(ImgDbFilePath)
-		if err != nil {
-			fmt.Println("讀取圖庫失敗:", err)
-			return
-		}
+	case "category":
+		handleCategory(s, i, options)
 
-		var imgKey string
-		var imageToClassify *database.ImageData
-		for key, img := range db.Images {
-			if img.ID == identifier || img.Name == identifier {
-				imgKey = key
-				imageToClassify = &img
-				break
-			}
-		}
+	case "imagehealth":
+		handleImageHealth(s, i, options)
 
-		if imageToClassify == nil { //找不到圖片
-			response := &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Content: fmt.Sprintf("找不到圖片 %q", identifier),
-					Flags:   discordgo.MessageFlagsEphemeral,
-				},
-			}
-			err = s.InteractionRespond(i.Interaction, response)
-			if err != nil {
-				fmt.Println("發送回應失敗:", err)
-			}
-			return
-		}
+	case uploadMenuName:
+		handleUploadMenu(s, i)
 
-		categoryCode := ""
-		for name, code := range db.Categories {
-			if name == newCategory {
-				categoryCode = code
-				break
-			}
-		}
+	case "globallibrary":
+		handleGlobalLibrary(s, i, options)
 
-		if categoryCode == "" {
-			newCode := fmt.Sprintf("%02d", len(db.Categories)+1)
-			db.Categories[newCategory] = newCode
-			categoryCode = newCode
-		}
+	case "permissions":
+		handlePermissions(s, i, options)
 
-		// 更新分類並重新分配ID
-		existingIDs := make(map[string]bool)
-		for _, img := range db.Images {
-			if img.Category == categoryCode {
-				existingIDs[img.ID] = true
-			}
-		}
+	case "submissions":
+		handleSubmissions(s, i, options)
 
-		// 分配新的ID
-		for i := 1; ; i++ {
-			newID := fmt.Sprintf("%s%03d", categoryCode, i)
-			if !existingIDs[newID] {
-				imageToClassify.ID = newID
-				break
-			}
-		}
+	case "auditlog":
+		handleAuditLog(s, i, options)
 
-		imageToClassify.Category = categoryCode
-		db.Images[imgKey] = *imageToClassify
-		err = database.SaveDatabase(ImgDbFilePath, db)
-		if err != nil {
-			fmt.Println("儲存圖庫失敗:", err)
-			return
-		}
+	case "restore":
+		handleRestore(s, i, options)
 
-		response := &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: fmt.Sprintf("成功將圖片 %q 分類到 %q，新的ID為 %q", imageToClassify.Name, newCategory, imageToClassify.ID),
-				Flags:   discordgo.MessageFlagsEphemeral,
-			},
-		}
-		err = s.InteractionRespond(i.Interaction, response)
-		if err != nil {
-			fmt.Println("發送回應失敗:", err)
-		}
+	case "history":
+		handleHistory(s, i, options)
 	}
 
 }
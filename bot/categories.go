@@ -0,0 +1,308 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/etas94/godcbot/database"
+)
+
+// categoryOption 返回以自動完成選擇既有分類的選項
+func categoryOption(name, description string, required bool) *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Name:         name,
+		Description:  description,
+		Type:         discordgo.ApplicationCommandOptionString,
+		Required:     required,
+		Autocomplete: true,
+	}
+}
+
+// descriptionOptions 是設定分類說明與表情符號的選項
+var descriptionOptions = []*discordgo.ApplicationCommandOption{
+	{
+		Name:        "description",
+		Description: "分類的說明(可選，輸入 - 清除)",
+		Type:        discordgo.ApplicationCommandOptionString,
+		Required:    false,
+		MaxLength:   200,
+	},
+	{
+		Name:        "emoji",
+		Description: "代表分類的表情符號(可選，輸入 - 清除)",
+		Type:        discordgo.ApplicationCommandOptionString,
+		Required:    false,
+		MaxLength:   64,
+	},
+}
+
+// categoryCommand 是 /category 指令群組的定義
+var categoryCommand = &discordgo.ApplicationCommand{
+	Name:                     "category",
+	Description:              "管理圖庫的分類",
+	DefaultMemberPermissions: &curatorPermission,
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "create",
+			Description: "建立新的分類",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: append([]*discordgo.ApplicationCommandOption{
+				{
+					Name:        "name",
+					Description: "分類的名稱",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    true,
+				},
+			}, append(descriptionOptions, libraryOption)...),
+		},
+		{
+			Name:        "rename",
+			Description: "修改分類的名稱，圖片的ID不會改變",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				categoryOption("category", "要改名的分類", true),
+				{
+					Name:        "new_name",
+					Description: "新的名稱",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    true,
+				},
+				libraryOption,
+			},
+		},
+		{
+			Name:        "merge",
+			Description: "將一個分類的圖片全部移到另一個分類，並刪除原本的分類",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				categoryOption("source", "要併入的分類（合併後刪除）", true),
+				categoryOption("target", "保留的分類", true),
+				libraryOption,
+			},
+		},
+		{
+			Name:        "delete",
+			Description: "刪除分類",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				categoryOption("category", "要刪除的分類", true),
+				categoryOption("reassign", "分類中的圖片要移到的分類(分類中有圖片時必填)", false),
+				libraryOption,
+			},
+		},
+		{
+			Name:        "describe",
+			Description: "查看或設定分類的說明與表情符號",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: append([]*discordgo.ApplicationCommandOption{
+				categoryOption("category", "要查看或設定的分類", true),
+			}, append(descriptionOptions, libraryOption)...),
+		},
+	},
+}
+
+// 處理 /category 的子指令
+func handleCategory(s *discordgo.Session, i *discordgo.InteractionCreate, options optionMap) {
+	sub := i.ApplicationCommandData().Options[0].Name
+	scope := targetScope(i, options)
+
+	// 只查看說明時不需要寫入權限
+	_, hasDescription := options["description"]
+	_, hasEmoji := options["emoji"]
+	readOnly := sub == "describe" && !hasDescription && !hasEmoji
+	if readOnly && !canRead(i, scope) {
+		respondEphemeral(s, i, "本伺服器尚未開啟全域圖庫。")
+		return
+	}
+	if !readOnly && !canWrite(i, scope) {
+		respondEphemeral(s, i, "你沒有權限修改全域圖庫。")
+		return
+	}
+	lib, err := storeFor(scope)
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		return
+	}
+
+	if readOnly {
+		respondCategoryInfo(s, i, lib, options["category"].StringValue())
+		return
+	}
+
+	var content, action string
+	var moved []database.ChangedImage // 合併或刪除分類時移動的圖片
+	actor, now := interactionUser(i).ID, time.Now()
+	err = lib.Transact(func(db *database.ImageDB) error {
+		switch sub {
+		case "create":
+			action = database.AuditCategoryCreate
+			name := options["name"].StringValue()
+			code, err := db.CreateCategory(name)
+			if err != nil {
+				return err
+			}
+			if err := db.SetCategoryInfo(name, categoryInfoOptions(database.CategoryInfo{}, options)); err != nil {
+				return err
+			}
+			content = fmt.Sprintf("成功建立分類 %q，編號為 %s。", name, code)
+
+		case "rename":
+			action = database.AuditCategoryRename
+			oldName := options["category"].StringValue()
+			newName := options["new_name"].StringValue()
+			renamed, err := db.RenameCategory(oldName, newName)
+			if err != nil {
+				return err
+			}
+			for _, c := range renamed {
+				db.RecordRevision(&c.Before, c.After, actor, action, now)
+			}
+			content = fmt.Sprintf("成功將分類 %q 改名為 %q，圖片的ID不變。", oldName, newName)
+
+		case "merge":
+			action = database.AuditCategoryMerge
+			source := options["source"].StringValue()
+			target := options["target"].StringValue()
+			var err error
+			if moved, err = db.MergeCategories(source, target); err != nil {
+				return err
+			}
+			for _, c := range moved {
+				db.RecordRevision(&c.Before, c.After, actor, database.AuditClassify, now)
+			}
+			content = fmt.Sprintf("成功將分類 %q 併入 %q，移動了 %d 張圖片（永久ID不變，舊的代碼仍可使用）。", source, target, len(moved))
+
+		case "delete":
+			action = database.AuditCategoryDelete
+			name := options["category"].StringValue()
+			var reassign string
+			if opt, ok := options["reassign"]; ok {
+				reassign = opt.StringValue()
+			}
+			var err error
+			if moved, err = db.DeleteCategory(name, reassign); err != nil {
+				return err
+			}
+			for _, c := range moved {
+				db.RecordRevision(&c.Before, c.After, actor, database.AuditClassify, now)
+			}
+			content = fmt.Sprintf("成功刪除分類 %q。", name)
+			if len(moved) > 0 {
+				content += fmt.Sprintf("%d 張圖片已移到 %q。", len(moved), reassign)
+			}
+
+		case "describe":
+			action = database.AuditCategoryDescribe
+			name := options["category"].StringValue()
+			code, ok := db.Categories[name]
+			if !ok {
+				return fmt.Errorf("%w：%q", database.ErrCategoryNotFound, name)
+			}
+			if err := db.SetCategoryInfo(name, categoryInfoOptions(db.CategoryInfo[code], options)); err != nil {
+				return err
+			}
+			content = fmt.Sprintf("已更新分類 %q 的說明。", name)
+		}
+		return nil
+	})
+	if err != nil {
+		// 這些錯誤的訊息已經說明了原因，直接告訴使用者
+		if errors.Is(err, database.ErrCategoryNotFound) || errors.Is(err, database.ErrCategoryExists) ||
+			errors.Is(err, database.ErrCategoryNotEmpty) || errors.Is(err, database.ErrInvalidCategory) {
+			respondEphemeral(s, i, fmt.Sprintf("無法修改分類：%v", err))
+			return
+		}
+		fmt.Println("儲存圖庫失敗:", err)
+		return
+	}
+	for _, c := range moved {
+		appendAudit(i, scope, database.AuditClassify, &c.Before, &c.After, fmt.Sprintf("%s → %s", c.Before.Code, c.After.Code))
+	}
+	recordAudit(s, i, scope, action, nil, nil, content)
+	respondEphemeral(s, i, content)
+}
+
+// 以選項更新分類說明，"-" 表示清除該欄位
+func categoryInfoOptions(info database.CategoryInfo, options optionMap) database.CategoryInfo {
+	if opt, ok := options["description"]; ok {
+		info.Description = opt.StringValue()
+		if info.Description == "-" {
+			info.Description = ""
+		}
+	}
+	if opt, ok := options["emoji"]; ok {
+		info.Emoji = opt.StringValue()
+		if info.Emoji == "-" {
+			info.Emoji = ""
+		}
+	}
+	return info
+}
+
+// 回應分類的編號、圖片數量、說明與表情符號
+func respondCategoryInfo(s *discordgo.Session, i *discordgo.InteractionCreate, lib database.Store, name string) {
+	categories, err := lib.Categories()
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		return
+	}
+	code, ok := categories[name]
+	if !ok {
+		respondEphemeral(s, i, fmt.Sprintf("找不到分類 %q。", name))
+		return
+	}
+	infos, err := lib.CategoryInfos()
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		return
+	}
+	images, err := lib.ListByCategory(code)
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		return
+	}
+
+	info := infos[code]
+	embed := &discordgo.MessageEmbed{
+		Title:       categoryTitle(code, categories, infos),
+		Description: info.Description,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "編號", Value: code, Inline: true},
+			{Name: "圖片數量", Value: fmt.Sprint(len(images)), Inline: true},
+		},
+	}
+	response := &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{embed},
+			Flags:  discordgo.MessageFlagsEphemeral, // 僅使用者可見。
+		},
+	}
+	err = s.InteractionRespond(i.Interaction, response)
+	if err != nil {
+		fmt.Println("發送回應失敗:", err)
+	}
+}
+
+// 返回顯示用的分類標題（表情符號與名稱），沒有名稱的編號會明確標示而不是當成未分類
+func categoryTitle(code string, categories map[string]string, infos map[string]database.CategoryInfo) string {
+	title := ""
+	for name, c := range categories {
+		if c == code {
+			title = name
+			break
+		}
+	}
+	switch {
+	case code == database.UncategorizedCode:
+		title = "未分類"
+	case title == "":
+		title = fmt.Sprintf("未命名的分類（編號 %s）", code)
+	}
+	if emoji := infos[code].Emoji; emoji != "" {
+		title = emoji + " " + title
+	}
+	return title
+}
@@ -0,0 +1,211 @@
+package bot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/etas94/godcbot/database"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// 縮圖網格的版面
+const (
+	sheetColumns = 5   // 每列的縮圖數量
+	sheetThumb   = 160 // 縮圖的最大邊長（像素）
+	sheetCaption = 18  // 縮圖下方說明文字的高度
+	sheetPadding = 6   // 縮圖之間的間距
+)
+
+// gridOption 是 /list 與 /listall 以縮圖網格顯示的選項
+var gridOption = &discordgo.ApplicationCommandOption{
+	Name:        "grid",
+	Description: "以縮圖網格顯示這一頁(可選)",
+	Type:        discordgo.ApplicationCommandOptionBoolean,
+	Required:    false,
+}
+
+// 檢查是否指定以縮圖網格顯示
+func wantGrid(options optionMap) bool {
+	opt, ok := options["grid"]
+	return ok && opt.BoolValue()
+}
+
+// sheetCacheSize 是快取的網格圖片數量上限，超過時移除最早產生的
+const sheetCacheSize = 64
+
+var (
+	sheetBackground  = color.RGBA{0x2b, 0x2d, 0x31, 0xff} // 與 Discord 深色主題相近的背景
+	sheetPlaceholder = color.RGBA{0x40, 0x44, 0x4b, 0xff}
+	sheetText        = color.RGBA{0xdb, 0xde, 0xe1, 0xff}
+)
+
+// sheetCache 以頁面內容為鍵保存已產生的網格圖片（JPEG）
+var sheetCache = struct {
+	sync.Mutex
+	images map[string][]byte
+	order  []string // 加入的順序，用於移除最早的項目
+}{images: make(map[string][]byte)}
+
+// 以網格圖片回應目前頁面，content 為原本的文字列表，update 為 true 時修改按鈕所在的訊息
+// 產生圖片可能超過 Discord 的三秒回應期限，因此先延後回應
+func respondContactSheet(s *discordgo.Session, i *discordgo.InteractionCreate, content string, components []discordgo.MessageComponent, images []database.ImageData, update bool) {
+	if update {
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredMessageUpdate})
+		if err != nil {
+			fmt.Println("發送回應失敗:", err)
+		}
+	} else {
+		deferEphemeral(s, i)
+	}
+
+	edit := &discordgo.WebhookEdit{
+		Content:     &content,
+		Components:  &components,
+		Attachments: &[]*discordgo.MessageAttachment{}, // 移除之前頁面的縮圖網格
+	}
+	sheet, err := contactSheet(images)
+	if err != nil {
+		fmt.Println("產生縮圖網格失敗:", err)
+	} else {
+		edit.Files = []*discordgo.File{{
+			Name:        "page.jpg",
+			ContentType: "image/jpeg",
+			Reader:      bytes.NewReader(sheet),
+		}}
+	}
+	_, err = s.InteractionResponseEdit(i.Interaction, edit)
+	if err != nil {
+		fmt.Println("發送回應失敗:", err)
+	}
+}
+
+// 返回圖片的網格圖片，相同的頁面內容直接使用快取
+func contactSheet(images []database.ImageData) ([]byte, error) {
+	key := sheetKey(images)
+	sheetCache.Lock()
+	cached, ok := sheetCache.images[key]
+	sheetCache.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	sheet, err := renderContactSheet(images)
+	if err != nil {
+		return nil, err
+	}
+
+	sheetCache.Lock()
+	defer sheetCache.Unlock()
+	if _, ok := sheetCache.images[key]; !ok {
+		sheetCache.images[key] = sheet
+		sheetCache.order = append(sheetCache.order, key)
+		if len(sheetCache.order) > sheetCacheSize {
+			delete(sheetCache.images, sheetCache.order[0])
+			sheetCache.order = sheetCache.order[1:]
+		}
+	}
+	return sheet, nil
+}
+
+// 以每張圖片的ID與本機檔案的雜湊產生快取鍵，順序、圖片或檔案改變時都會產生新的網格
+func sheetKey(images []database.ImageData) string {
+	h := sha256.New()
+	for _, img := range images {
+		hash := ""
+		if ref := img.LocalBlob(); ref != nil {
+			hash = ref.Hash
+		}
+		fmt.Fprintf(h, "%s\x00%s\x00", img.ID, hash)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// 繪製網格圖片：每張圖片縮放到 sheetThumb 以內並置中，下方標示ID
+// 只使用本機的檔案，沒有本機檔案（尚未鏡像）的圖片以灰色方塊代替
+func renderContactSheet(images []database.ImageData) ([]byte, error) {
+	columns := sheetColumns
+	if len(images) < columns {
+		columns = len(images)
+	}
+	rows := (len(images) + sheetColumns - 1) / sheetColumns
+	cellW := sheetThumb + sheetPadding
+	cellH := sheetThumb + sheetCaption + sheetPadding
+
+	sheet := image.NewRGBA(image.Rect(0, 0, columns*cellW+sheetPadding, rows*cellH+sheetPadding))
+	draw.Draw(sheet, sheet.Bounds(), image.NewUniform(sheetBackground), image.Point{}, draw.Src)
+
+	for n, img := range images {
+		x := sheetPadding + n%sheetColumns*cellW
+		y := sheetPadding + n/sheetColumns*cellH
+		box := image.Rect(x, y, x+sheetThumb, y+sheetThumb)
+
+		if thumb := loadThumbnail(img); thumb != nil {
+			draw.ApproxBiLinear.Scale(sheet, fitRect(thumb.Bounds(), box), thumb, thumb.Bounds(), draw.Over, nil)
+		} else {
+			draw.Draw(sheet, box, image.NewUniform(sheetPlaceholder), image.Point{}, draw.Src)
+		}
+		drawCaption(sheet, img.ID, x, y+sheetThumb)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, sheet, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// 讀取圖片的本機檔案（動態圖片只取第一格），無法讀取或尺寸太大時返回 nil
+func loadThumbnail(img database.ImageData) image.Image {
+	ref := img.LocalBlob()
+	if ref == nil {
+		return nil
+	}
+	f, err := blobs.Open(ref)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	decoded, err := database.DecodeImage(f)
+	if err != nil {
+		return nil
+	}
+	return decoded
+}
+
+// 返回把 src 等比例縮放後置中放入 box 的位置，小圖片不會被放大
+func fitRect(src, box image.Rectangle) image.Rectangle {
+	w, h := src.Dx(), src.Dy()
+	if w > box.Dx() || h > box.Dy() {
+		if w*box.Dy() > h*box.Dx() {
+			w, h = box.Dx(), max(1, h*box.Dx()/w)
+		} else {
+			w, h = max(1, w*box.Dy()/h), box.Dy()
+		}
+	}
+	x := box.Min.X + (box.Dx()-w)/2
+	y := box.Min.Y + (box.Dy()-h)/2
+	return image.Rect(x, y, x+w, y+h)
+}
+
+// 在縮圖下方置中寫上說明文字（內建字型只支援 ASCII，因此只寫圖片ID）
+func drawCaption(dst *image.RGBA, text string, x, y int) {
+	face := basicfont.Face7x13
+	d := &font.Drawer{Dst: dst, Src: image.NewUniform(sheetText), Face: face}
+	width := d.MeasureString(text).Ceil()
+	left := x + (sheetThumb-width)/2
+	if left < x {
+		left = x
+	}
+	d.Dot = fixed.P(left, y+face.Ascent+(sheetCaption-face.Height)/2)
+	d.DrawString(text)
+}
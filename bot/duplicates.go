@@ -0,0 +1,180 @@
+package bot
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/etas94/godcbot/database"
+)
+
+// pendingAddTTL 是重複圖片等待使用者確認的時間，逾時後按鈕失效
+const pendingAddTTL = 15 * time.Minute
+
+// maxDuplicatesShown 是確認訊息中列出的重複圖片數量上限
+const maxDuplicatesShown = 10
+
+// pendingAdd 是因為找到重複圖片而等待確認的新增操作
+type pendingAdd struct {
+	userID   string
+	scope    string
+	img      database.ImageData
+	category string
+	expires  time.Time
+}
+
+// pendingAdds 以發出指令的互動ID為鍵，保存等待確認的新增操作
+var pendingAdds = struct {
+	sync.Mutex
+	m map[string]pendingAdd
+}{m: make(map[string]pendingAdd)}
+
+// 加入圖片，找到重複的圖片時改為顯示既有的圖片與「仍要加入／取消」按鈕
+// 呼叫前必須已經以 deferEphemeral 延後回應
+// 需要審核時（見 needsReview）不直接加入，而是建立投稿
+func submitImage(s *discordgo.Session, i *discordgo.InteractionCreate, lib database.Store, scope string, img database.ImageData, category string) {
+	review := needsReview(i, scope)
+	var added database.ImageData
+	var dups []database.Duplicate
+	var err error
+	if review {
+		err = lib.View(func(db *database.ImageDB) error {
+			dups = db.FindDuplicates(img)
+			return nil
+		})
+	} else {
+		added, dups, err = addImage(s, i, lib, scope, img, category, false)
+	}
+	if err == nil && len(dups) == 0 && review {
+		editResponse(s, i, submitForReview(s, i, scope, img, category))
+		return
+	}
+	if err != nil || len(dups) == 0 {
+		editResponse(s, i, addedMessage(added, category, err))
+		return
+	}
+
+	token := i.ID
+	now := time.Now()
+	pendingAdds.Lock()
+	for key, p := range pendingAdds.m { // 順便清除逾時的操作
+		if now.After(p.expires) {
+			delete(pendingAdds.m, key)
+		}
+	}
+	pendingAdds.m[token] = pendingAdd{
+		userID:   interactionUser(i).ID,
+		scope:    scope,
+		img:      img,
+		category: category,
+		expires:  now.Add(pendingAddTTL),
+	}
+	pendingAdds.Unlock()
+
+	content := fmt.Sprintf("圖庫中已有與 %q 重複的圖片：", img.Name)
+	embeds := []*discordgo.MessageEmbed{duplicatesEmbed(dups)}
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{Label: "仍要加入", Style: discordgo.PrimaryButton, CustomID: "dup-confirm:" + token},
+			discordgo.Button{Label: "取消", Style: discordgo.SecondaryButton, CustomID: "dup-cancel:" + token},
+		}},
+	}
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content:    &content,
+		Embeds:     &embeds,
+		Components: &components,
+	})
+	if err != nil {
+		fmt.Println("發送回應失敗:", err)
+	}
+}
+
+// 建立列出重複圖片的嵌入訊息
+func duplicatesEmbed(dups []database.Duplicate) *discordgo.MessageEmbed {
+	description := ""
+	for n, dup := range dups {
+		if n == maxDuplicatesShown {
+			description += fmt.Sprintf("……以及另外 %d 張", len(dups)-n)
+			break
+		}
+		reason := dup.Reason
+		if dup.Reason == database.DuplicateSimilar {
+			reason += fmt.Sprintf("（差異 %d/64）", dup.Distance)
+		}
+		description += fmt.Sprintf("`%s` %s — %s\n", displayID(dup.Image), dup.Image.Name, reason)
+	}
+	embed := &discordgo.MessageEmbed{
+		Title:       "可能重複的圖片",
+		Description: description,
+	}
+	if url := dups[0].Image.URL; url != "" { // 上傳的圖片需要附加檔案，只預覽有網址的圖片
+		embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: url}
+	}
+	return embed
+}
+
+// 取出並移除等待確認的新增操作，只有發出指令的使用者可以確認
+func takePendingAdd(s *discordgo.Session, i *discordgo.InteractionCreate, token string) (pendingAdd, bool) {
+	pendingAdds.Lock()
+	defer pendingAdds.Unlock()
+
+	p, ok := pendingAdds.m[token]
+	if !ok || time.Now().After(p.expires) {
+		delete(pendingAdds.m, token)
+		updateMessage(s, i, "此操作已逾時，請重新使用 /addimage。")
+		return pendingAdd{}, false
+	}
+	if p.userID != interactionUser(i).ID {
+		respondEphemeral(s, i, "只有加入圖片的使用者可以確認。")
+		return pendingAdd{}, false
+	}
+	delete(pendingAdds.m, token)
+	return p, true
+}
+
+// 處理「仍要加入」按鈕
+func handleDuplicateConfirm(s *discordgo.Session, i *discordgo.InteractionCreate, token string) {
+	p, ok := takePendingAdd(s, i, token)
+	if !ok {
+		return
+	}
+	if !canWrite(i, p.scope) {
+		updateMessage(s, i, "你沒有權限修改此圖庫。")
+		return
+	}
+	if needsReview(i, p.scope) {
+		updateMessage(s, i, submitForReview(s, i, p.scope, p.img, p.category))
+		return
+	}
+	lib, err := storeFor(p.scope)
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		return
+	}
+	added, _, err := addImage(s, i, lib, p.scope, p.img, p.category, true)
+	updateMessage(s, i, addedMessage(added, p.category, err))
+}
+
+// 處理「取消」按鈕
+func handleDuplicateCancel(s *discordgo.Session, i *discordgo.InteractionCreate, token string) {
+	if _, ok := takePendingAdd(s, i, token); ok {
+		updateMessage(s, i, "已取消加入圖片。")
+	}
+}
+
+// 以文字取代按鈕所在的訊息，並移除嵌入訊息與按鈕
+func updateMessage(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	response := &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Embeds:     []*discordgo.MessageEmbed{},
+			Components: []discordgo.MessageComponent{},
+		},
+	}
+	err := s.InteractionRespond(i.Interaction, response)
+	if err != nil {
+		fmt.Println("發送回應失敗:", err)
+	}
+}
@@ -0,0 +1,234 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/etas94/godcbot/config"
+	"github.com/etas94/godcbot/database"
+)
+
+// linkChecker 定期檢查圖片網址是否失效，停用時為 nil
+var linkChecker *database.LinkChecker
+
+const (
+	// defaultLinkCheckInterval 是未設定時每張圖片網址重新檢查的間隔
+	defaultLinkCheckInterval = 6 * time.Hour
+	// defaultLinkCheckConcurrency 是未設定時同時發出的檢查請求數量
+	defaultLinkCheckConcurrency = 4
+	// maxHealthButtons 是 /imagehealth 附上操作按鈕的圖片數量（Discord 每則訊息最多 5 列元件）
+	maxHealthButtons = 5
+)
+
+// imageHealthCommand 是 /imagehealth 指令的定義，預設只有伺服器管理員可以使用
+var imageHealthCommand = &discordgo.ApplicationCommand{
+	Name:                     "imagehealth",
+	Description:              "列出網址已失效的圖片",
+	DefaultMemberPermissions: &curatorPermission,
+	Options: []*discordgo.ApplicationCommandOption{
+		libraryOption,
+	},
+}
+
+// 依照配置啟動網址檢查
+func startLinkChecker(cfg *config.Config) {
+	if cfg.LinkCheckIntervalMinutes < 0 {
+		fmt.Println("已停用圖片網址的定期檢查")
+		return
+	}
+	interval := defaultLinkCheckInterval
+	if cfg.LinkCheckIntervalMinutes > 0 {
+		interval = time.Duration(cfg.LinkCheckIntervalMinutes) * time.Minute
+	}
+	concurrency := defaultLinkCheckConcurrency
+	if cfg.LinkCheckConcurrency > 0 {
+		concurrency = cfg.LinkCheckConcurrency
+	}
+	linkChecker = database.NewLinkChecker(libraries, nil, interval, concurrency)
+	linkChecker.Start()
+}
+
+// 處理 /imagehealth，列出失效的圖片並為前幾張附上刪除與更換網址的按鈕
+func handleImageHealth(s *discordgo.Session, i *discordgo.InteractionCreate, options optionMap) {
+	scope := targetScope(i, options)
+	if !canWrite(i, scope) {
+		respondEphemeral(s, i, "你沒有權限修改全域圖庫。")
+		return
+	}
+	lib, err := libraries.Library(scope)
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		return
+	}
+
+	broken := lib.Snapshot().BrokenImages()
+	if len(broken) == 0 {
+		respondEphemeral(s, i, "目前沒有網址失效的圖片。")
+		return
+	}
+
+	content := fmt.Sprintf("共有 %d 張圖片的網址已失效：\n", len(broken))
+	var rows []discordgo.MessageComponent
+	for n, img := range broken {
+		line := fmt.Sprintf("`%s` %s — %s（%s 檢查）\n", displayID(img), img.Name, img.Health.Error, img.Health.CheckedAt.Format("2006-01-02 15:04"))
+		if len(content)+len(line) > 1900 { // Discord 訊息長度上限為 2000
+			content += "……"
+			break
+		}
+		content += line
+
+		if n < maxHealthButtons {
+			arg := scope + ":" + img.ID
+			rows = append(rows, discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    truncate("刪除 "+img.Name, 80),
+					Style:    discordgo.DangerButton,
+					CustomID: "health-delete:" + arg,
+				},
+				discordgo.Button{
+					Label:    "更換網址",
+					Style:    discordgo.SecondaryButton,
+					CustomID: "health-replace:" + arg,
+				},
+			}})
+		}
+	}
+
+	response := &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: rows,
+			Flags:      discordgo.MessageFlagsEphemeral, // 僅使用者可見。
+		},
+	}
+	err = s.InteractionRespond(i.Interaction, response)
+	if err != nil {
+		fmt.Println("發送回應失敗:", err)
+	}
+}
+
+// 取得按鈕或表單中 "範圍:圖片ID" 指向的圖片，並確認使用者可以修改該圖庫
+func healthTarget(s *discordgo.Session, i *discordgo.InteractionCreate, arg string) (database.Store, database.ImageData, bool) {
+	scope, id, _ := strings.Cut(arg, ":")
+	if !canWrite(i, scope) {
+		respondEphemeral(s, i, "你沒有權限修改此圖庫。")
+		return nil, database.ImageData{}, false
+	}
+	lib, err := storeFor(scope)
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		return nil, database.ImageData{}, false
+	}
+	img, err := lib.GetByID(id)
+	if errors.Is(err, database.ErrNotFound) {
+		respondEphemeral(s, i, fmt.Sprintf("找不到圖片 %q，可能已被刪除。", id))
+		return nil, database.ImageData{}, false
+	}
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		return nil, database.ImageData{}, false
+	}
+	return lib, img, true
+}
+
+// 處理「刪除」按鈕
+func handleHealthDelete(s *discordgo.Session, i *discordgo.InteractionCreate, arg string) {
+	lib, img, ok := healthTarget(s, i, arg)
+	if !ok {
+		return
+	}
+	scope, _, _ := strings.Cut(arg, ":")
+	img, err := trashImage(s, i, lib, scope, img.ID, "網址已失效")
+	if err != nil {
+		fmt.Println("刪除圖片失敗:", err)
+		return
+	}
+	respondTrashed(s, i, scope, img)
+}
+
+// 處理「更換網址」按鈕，以表單詢問新的網址
+func handleHealthReplace(s *discordgo.Session, i *discordgo.InteractionCreate, arg string) {
+	_, img, ok := healthTarget(s, i, arg)
+	if !ok {
+		return
+	}
+	response := &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: "health-replace:" + arg,
+			Title:    truncate("更換網址："+img.Name, 45),
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+					discordgo.TextInput{
+						CustomID: "url",
+						Label:    "新的圖片網址",
+						Style:    discordgo.TextInputShort,
+						Value:    img.URL,
+						Required: true,
+					},
+				}},
+			},
+		},
+	}
+	err := s.InteractionRespond(i.Interaction, response)
+	if err != nil {
+		fmt.Println("發送回應失敗:", err)
+	}
+}
+
+// 處理「更換網址」表單的送出，先檢查新網址再寫回圖庫
+func handleHealthReplaceModal(s *discordgo.Session, i *discordgo.InteractionCreate, arg string) {
+	lib, img, ok := healthTarget(s, i, arg)
+	if !ok {
+		return
+	}
+	newURL := strings.TrimSpace(modalValues(i.ModalSubmitData().Components)["url"])
+	if u, err := url.Parse(newURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		respondEphemeral(s, i, fmt.Sprintf("%q 不是有效的網址。", newURL))
+		return
+	}
+
+	// 檢查網址可能超過 Discord 的三秒回應期限，先延後回應
+	deferEphemeral(s, i)
+	var health *database.LinkHealth
+	if linkChecker != nil {
+		health = linkChecker.Check(newURL)
+	}
+
+	var before, after database.ImageData
+	err := lib.Transact(func(db *database.ImageDB) error {
+		current, ok := db.ImageByID(img.ID)
+		if !ok {
+			return database.ErrNotFound
+		}
+		before = current
+		current.URL = newURL
+		current.Health = health
+		db.ReplaceImage(current.ID, current)
+		after = current
+		db.RecordRevision(&before, after, interactionUser(i).ID, database.AuditUpdate, time.Now())
+		return nil
+	})
+	if errors.Is(err, database.ErrNotFound) {
+		editResponse(s, i, fmt.Sprintf("找不到圖片 %q，可能已被刪除。", img.Name))
+		return
+	}
+	if err != nil {
+		fmt.Println("儲存圖庫失敗:", err)
+		return
+	}
+
+	scope, _, _ := strings.Cut(arg, ":")
+	recordAudit(s, i, scope, database.AuditUpdate, &before, &after, "更換網址")
+
+	content := fmt.Sprintf("已將 %q 的網址更換為：%s", img.Name, newURL)
+	if health.Broken() {
+		content += fmt.Sprintf("\n注意：新網址目前也無法使用（%s）。", health.Error)
+	}
+	editResponse(s, i, content)
+}
@@ -0,0 +1,249 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/etas94/godcbot/database"
+)
+
+// maxHistoryListed 是 /history 列出的版本數量（選單最多 25 個選項）
+const maxHistoryListed = 25
+
+// historyCommand 是 /history 指令的定義
+var historyCommand = &discordgo.ApplicationCommand{
+	Name:        "history",
+	Description: "查看圖片的修改紀錄，並可以回復成較早的版本",
+	Options: []*discordgo.ApplicationCommandOption{
+		identifierOption,
+		libraryOption,
+	},
+}
+
+// 處理 /history，列出圖片的版本，策展人以上的成員可以從選單回復成較早的版本
+func handleHistory(s *discordgo.Session, i *discordgo.InteractionCreate, options optionMap) {
+	identifier := options["identifier"].StringValue()
+	scope := targetScope(i, options)
+	if !canRead(i, scope) {
+		respondEphemeral(s, i, "本伺服器尚未開啟全域圖庫。")
+		return
+	}
+	lib, err := storeFor(scope)
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		return
+	}
+
+	var img database.ImageData
+	var revisions []database.Revision
+	categories := make(map[string]string) // 分類編號 → 名稱
+	err = lib.View(func(db *database.ImageDB) error {
+		var ok bool
+		if img, ok = db.FindImage(identifier); !ok {
+			return database.ErrNotFound
+		}
+		revisions = db.Revisions(img.ID)
+		for name, code := range db.Categories {
+			categories[code] = name
+		}
+		return nil
+	})
+	if errors.Is(err, database.ErrNotFound) {
+		respondEphemeral(s, i, fmt.Sprintf("找不到圖片 %q", identifier))
+		return
+	}
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		return
+	}
+	if len(revisions) == 0 {
+		respondEphemeral(s, i, fmt.Sprintf("圖片 %q 還沒有任何修改紀錄。", img.Name))
+		return
+	}
+
+	// 最新的版本在前
+	var lines []string
+	var menu []discordgo.SelectMenuOption
+	for n := len(revisions) - 1; n >= 0 && len(lines) < maxHistoryListed; n-- {
+		rev := revisions[n]
+		changes := "開始記錄之前的版本"
+		if n > 0 {
+			changes = revisionChanges(revisions[n-1].Image, rev.Image, categories)
+		}
+		lines = append(lines, formatRevision(rev, changes))
+		if n < len(revisions)-1 {
+			menu = append(menu, discordgo.SelectMenuOption{
+				Label:       truncate(fmt.Sprintf("第 %d 版：%s", rev.Number, revisionTime(rev)), 100),
+				Value:       strconv.Itoa(rev.Number),
+				Description: truncate(changes, 100),
+			})
+		}
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       truncate(fmt.Sprintf("版本紀錄：%s", img.Name), 256),
+		Description: truncate(strings.Join(lines, "\n"), 4096),
+		Footer:      &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("永久ID：%s，共 %d 個版本", img.ID, len(revisions))},
+	}
+	data := &discordgo.InteractionResponseData{
+		Embeds: []*discordgo.MessageEmbed{embed},
+		Flags:  discordgo.MessageFlagsEphemeral, // 僅使用者可見。
+	}
+	if len(menu) > 0 && canWrite(i, scope) && memberRole(i) >= componentRole("history-revert") {
+		data.Components = []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{
+					CustomID:    "history-revert:" + scope + ":" + img.ID,
+					Placeholder: "回復成較早的版本",
+					Options:     menu,
+				},
+			}},
+		}
+	}
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: data,
+	})
+	if err != nil {
+		fmt.Println("發送回應失敗:", err)
+	}
+}
+
+// 將一個版本格式化為一行文字
+func formatRevision(rev database.Revision, changes string) string {
+	line := fmt.Sprintf("**第 %d 版**", rev.Number)
+	if !rev.Time.IsZero() {
+		line += fmt.Sprintf(" <t:%d:f>", rev.Time.Unix())
+	}
+	if rev.Actor != "" {
+		line += fmt.Sprintf(" <@%s>", rev.Actor)
+	}
+	if label := auditLabels[rev.Action]; label != "" {
+		line += " " + label
+	}
+	return line + "：" + changes
+}
+
+// 返回選單中顯示的版本時間
+func revisionTime(rev database.Revision) string {
+	if rev.Time.IsZero() {
+		return "開始記錄之前"
+	}
+	return rev.Time.Local().Format("2006-01-02 15:04")
+}
+
+// 描述兩個版本之間的差異，categories 為分類編號到名稱的映射
+func revisionChanges(prev, cur database.ImageData, categories map[string]string) string {
+	var changes []string
+	if prev.Name != cur.Name {
+		changes = append(changes, fmt.Sprintf("名稱 %q → %q", prev.Name, cur.Name))
+	}
+	if prev.URL != cur.URL {
+		changes = append(changes, "更換網址")
+	}
+	if !reflect.DeepEqual(prev.Blob, cur.Blob) {
+		changes = append(changes, "更換檔案")
+	}
+	if prev.Category != cur.Category {
+		changes = append(changes, fmt.Sprintf("分類 %s → %s", revisionCategory(prev.Category, categories), revisionCategory(cur.Category, categories)))
+	}
+	if diff := listChanges(prev.Tags, cur.Tags); diff != "" {
+		changes = append(changes, "標籤 "+diff)
+	}
+	if diff := listChanges(prev.Aliases, cur.Aliases); diff != "" {
+		changes = append(changes, "別名 "+diff)
+	}
+	if len(changes) == 0 {
+		return "沒有變更"
+	}
+	return strings.Join(changes, "，")
+}
+
+// 返回分類的顯示名稱，已刪除的分類顯示編號
+func revisionCategory(code string, categories map[string]string) string {
+	if code == database.UncategorizedCode {
+		return database.UncategorizedName
+	}
+	if name, ok := categories[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("（已刪除的分類 %s）", code)
+}
+
+// 以 +加入 -移除 的格式描述兩個列表的差異
+func listChanges(prev, cur []string) string {
+	in := func(list []string, s string) bool {
+		for _, v := range list {
+			if v == s {
+				return true
+			}
+		}
+		return false
+	}
+	var changes []string
+	for _, s := range cur {
+		if !in(prev, s) {
+			changes = append(changes, "+"+s)
+		}
+	}
+	for _, s := range prev {
+		if !in(cur, s) {
+			changes = append(changes, "-"+s)
+		}
+	}
+	return strings.Join(changes, " ")
+}
+
+// 處理版本選單的選擇，arg 為 "範圍:永久ID"
+func handleHistoryRevert(s *discordgo.Session, i *discordgo.InteractionCreate, arg string) {
+	scope, id, _ := strings.Cut(arg, ":")
+	values := i.MessageComponentData().Values
+	if len(values) == 0 {
+		return
+	}
+	number, err := strconv.Atoi(values[0])
+	if err != nil {
+		return
+	}
+	if !canWrite(i, scope) {
+		respondEphemeral(s, i, "你沒有權限修改全域圖庫。")
+		return
+	}
+	lib, err := storeFor(scope)
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		return
+	}
+
+	var before, reverted database.ImageData
+	err = lib.Transact(func(db *database.ImageDB) error {
+		var ok bool
+		if before, ok = db.ImageByID(id); !ok {
+			return database.ErrNotFound
+		}
+		var err error
+		if reverted, err = db.RevertImage(id, number); err != nil {
+			return err
+		}
+		db.RecordRevision(&before, reverted, interactionUser(i).ID, database.AuditRevert, time.Now())
+		return nil
+	})
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		updateMessage(s, i, fmt.Sprintf("找不到圖片 %q，可能已被刪除。", id))
+		return
+	case errors.Is(err, database.ErrNameTaken), errors.Is(err, database.ErrRevisionNotFound):
+		respondEphemeral(s, i, fmt.Sprintf("無法回復圖片，%v。", err))
+		return
+	case err != nil:
+		fmt.Println("儲存圖庫失敗:", err)
+		return
+	}
+	recordAudit(s, i, scope, database.AuditRevert, &before, &reverted, fmt.Sprintf("回復成第 %d 版", number))
+	updateMessage(s, i, fmt.Sprintf("已將 %q（ID：%s）回復成第 %d 版。", reverted.Name, displayID(reverted), number))
+}
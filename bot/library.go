@@ -0,0 +1,220 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/etas94/godcbot/config"
+	"github.com/etas94/godcbot/database"
+)
+
+// libraries 管理全域圖庫與每個伺服器各自的圖庫
+var libraries *database.Registry
+
+// guildSettings 保存每個伺服器的設定（例如是否讀取全域圖庫）
+var guildSettings *config.GuildSettingsStore
+
+// globalAdmins 是可以修改全域圖庫的使用者ID
+var globalAdmins = make(map[string]bool)
+
+const ImgDbFilePath = "./image.json"
+
+const defaultSQLitePath = "./image.db"
+
+// 每個伺服器的 JSON 圖庫存放在此目錄，檔名為伺服器ID
+const guildLibraryDir = "./libraries"
+
+const guildSettingsFilePath = "./guilds.json"
+
+// libraryOption 讓指令可以選擇操作本伺服器或全域的圖庫
+var libraryOption = &discordgo.ApplicationCommandOption{
+	Name:        "library",
+	Description: "要使用的圖庫(可選，預設為本伺服器)",
+	Type:        discordgo.ApplicationCommandOptionString,
+	Required:    false,
+	Choices: []*discordgo.ApplicationCommandOptionChoice{
+		{Name: "本伺服器", Value: "guild"},
+		{Name: "全域", Value: "global"},
+	},
+}
+
+// 根據配置開啟圖庫，圖庫保存在記憶體中，並由所選的儲存後端持久化
+// 全域圖庫沿用原本的 image.json（或 SQLite 中的 global 範圍）
+func openRegistry(cfg *config.Config) (*database.Registry, error) {
+	if cfg.BackupCount > 0 {
+		database.BackupCount = cfg.BackupCount
+	}
+
+	switch cfg.Storage {
+	case "", "json":
+		return database.NewRegistry(jsonBackend, jsonScopes, nil), nil
+	case "sqlite":
+		path := cfg.SQLitePath
+		if path == "" {
+			path = defaultSQLitePath
+		}
+		s, err := database.OpenSQLiteStore(path)
+		if err != nil {
+			return nil, err
+		}
+
+		// 第一次使用 SQLite 時，從現有的 JSON 圖庫匯入資料
+		empty, err := s.IsEmpty()
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		if empty {
+			n, err := database.ImportJSON(ImgDbFilePath, s)
+			if err != nil {
+				s.Close()
+				return nil, err
+			}
+			fmt.Printf("已從 %s 匯入 %d 張圖片到 %s\n", ImgDbFilePath, n, path)
+		}
+
+		open := func(scope string) (database.Backend, error) {
+			return s.Scope(scope), nil
+		}
+		return database.NewRegistry(open, s.Scopes, s), nil
+	default:
+		return nil, fmt.Errorf("未知的儲存後端 %q", cfg.Storage)
+	}
+}
+
+// 返回範圍對應的 JSON 圖庫檔案
+func jsonBackend(scope string) (database.Backend, error) {
+	if scope == database.GlobalScope {
+		return database.NewJSONStore(ImgDbFilePath), nil
+	}
+	if !isSnowflake(scope) { // 範圍會成為檔名，只接受 Discord 的數字ID
+		return nil, fmt.Errorf("無效的圖庫範圍 %q", scope)
+	}
+	if err := os.MkdirAll(guildLibraryDir, 0o755); err != nil {
+		return nil, err
+	}
+	return database.NewJSONStore(filepath.Join(guildLibraryDir, scope+".json")), nil
+}
+
+// 返回全域圖庫與目錄中每個伺服器的 JSON 圖庫的範圍
+func jsonScopes() ([]string, error) {
+	scopes := []string{database.GlobalScope}
+	entries, err := os.ReadDir(guildLibraryDir)
+	if os.IsNotExist(err) {
+		return scopes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if scope, ok := strings.CutSuffix(entry.Name(), ".json"); ok && isSnowflake(scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// 檢查字串是否為 Discord 的數字ID
+func isSnowflake(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// 取得範圍的圖庫
+func storeFor(scope string) (database.Store, error) {
+	return libraries.Library(scope)
+}
+
+// 取得發出互動的使用者（伺服器中為 Member.User，私訊中為 User）
+func interactionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+// 返回互動所在伺服器的圖庫範圍，私訊時使用全域圖庫
+func guildScope(i *discordgo.InteractionCreate) string {
+	if i.GuildID == "" {
+		return database.GlobalScope
+	}
+	return i.GuildID
+}
+
+// 根據 library 選項決定要操作的圖庫範圍，預設為所在伺服器的圖庫
+func targetScope(i *discordgo.InteractionCreate, options optionMap) string {
+	if opt, ok := options["library"]; ok && opt.StringValue() == "global" {
+		return database.GlobalScope
+	}
+	return guildScope(i)
+}
+
+// 檢查互動是否可以讀取範圍的圖庫
+// 伺服器只能讀取自己的圖庫，以及（有開啟時）全域圖庫
+func canRead(i *discordgo.InteractionCreate, scope string) bool {
+	if scope == guildScope(i) {
+		return true
+	}
+	return scope == database.GlobalScope && guildSettings.Get(i.GuildID).UseGlobal
+}
+
+// 檢查互動是否可以修改範圍的圖庫，全域圖庫只有 GlobalAdmins 可以修改
+func canWrite(i *discordgo.InteractionCreate, scope string) bool {
+	if scope != database.GlobalScope {
+		return scope == guildScope(i)
+	}
+	user := interactionUser(i)
+	return user != nil && globalAdmins[user.ID]
+}
+
+// 返回互動可以讀取的圖庫範圍，依搜尋的優先順序排列
+func readableScopes(i *discordgo.InteractionCreate) []string {
+	scopes := []string{guildScope(i)}
+	if i.GuildID != "" && guildSettings.Get(i.GuildID).UseGlobal {
+		scopes = append(scopes, database.GlobalScope)
+	}
+	return scopes
+}
+
+// 根據完整的ID或名稱尋找圖片
+func findImageExact(s database.Store, identifier string) (database.ImageData, error) {
+	img, err := s.GetByID(identifier)
+	if !errors.Is(err, database.ErrNotFound) {
+		return img, err
+	}
+	return s.GetByName(identifier)
+}
+
+// 處理 /globallibrary：設定伺服器是否讀取共用的全域圖庫
+func handleGlobalLibrary(s *discordgo.Session, i *discordgo.InteractionCreate, options optionMap) {
+	if i.GuildID == "" {
+		respondEphemeral(s, i, "此指令只能在伺服器中使用。")
+		return
+	}
+	enabled := options["enabled"].BoolValue()
+	err := guildSettings.Update(i.GuildID, func(settings *config.GuildSettings) {
+		settings.UseGlobal = enabled
+	})
+	if err != nil {
+		fmt.Println("儲存伺服器設定失敗:", err)
+		respondEphemeral(s, i, "儲存伺服器設定失敗，請稍後再試。")
+		return
+	}
+
+	if enabled {
+		respondEphemeral(s, i, "已開啟全域圖庫，本伺服器現在可以讀取共用的圖片。")
+	} else {
+		respondEphemeral(s, i, "已關閉全域圖庫，本伺服器只會使用自己的圖庫。")
+	}
+}
@@ -0,0 +1,383 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/etas94/godcbot/database"
+)
+
+// listPageSize 是 /list 與 /listall 每頁顯示的圖片數量
+const listPageSize = 20
+
+// maxCustomIDLength 是 Discord 訊息元件 CustomID 的長度上限
+const maxCustomIDLength = 100
+
+// listQuery 是 /list 與 /listall 的查詢條件
+// 換頁按鈕的 CustomID 中保存完整的條件，因此機器人重新啟動後按鈕仍然有效
+type listQuery struct {
+	All      bool     // 是否為 /listall
+	Scope    string   // 圖庫範圍
+	Category string   // 分類編號（名稱可能很長，CustomID 中只保存編號）
+	Tags     []string // 標籤篩選
+	MatchAll bool     // 標籤是否必須全部符合
+	Format   string   // 格式篩選，見 matchesFormat
+	Grid     bool     // 是否以縮圖網格顯示
+}
+
+// encode 將查詢條件編碼為 CustomID 的一部分，標籤放在最後因此可以包含冒號
+func (q listQuery) encode() string {
+	kind := "c"
+	if q.All {
+		kind = "a"
+	}
+	flags := ""
+	if q.MatchAll {
+		flags += "m"
+	}
+	if q.Grid {
+		flags += "g"
+	}
+	return strings.Join([]string{kind, q.Scope, q.Category, flags, q.Format, strings.Join(q.Tags, ",")}, ":")
+}
+
+// decodeListQuery 解析 encode 產生的字串
+func decodeListQuery(s string) (listQuery, bool) {
+	parts := strings.SplitN(s, ":", 6)
+	if len(parts) != 6 {
+		return listQuery{}, false
+	}
+	q := listQuery{
+		All:      parts[0] == "a",
+		Scope:    parts[1],
+		Category: parts[2],
+		MatchAll: strings.Contains(parts[3], "m"),
+		Grid:     strings.Contains(parts[3], "g"),
+		Format:   parts[4],
+	}
+	if parts[5] != "" {
+		q.Tags = strings.Split(parts[5], ",")
+	}
+	return q, true
+}
+
+// listPage 是一頁列表的內容
+type listPage struct {
+	content string
+	images  []database.ImageData // 這一頁的圖片
+	page    int                  // 從 0 開始的頁數
+	pages   int                  // 總頁數
+}
+
+// 處理 /list
+func handleList(s *discordgo.Session, i *discordgo.InteractionCreate, options optionMap) {
+	var categoryFilter string
+	if opt, ok := options["category"]; ok {
+		categoryFilter = opt.StringValue()
+	}
+	q := listQuery{Scope: targetScope(i, options), MatchAll: true, Grid: wantGrid(options)}
+	if opt, ok := options["tags"]; ok {
+		q.Tags = database.ParseTags(opt.StringValue())
+	}
+	if opt, ok := options["match"]; ok {
+		q.MatchAll = opt.StringValue() != "any"
+	}
+	if opt, ok := options["format"]; ok {
+		q.Format = opt.StringValue()
+	}
+
+	if categoryFilter == "" && len(q.Tags) == 0 && q.Format == "" {
+		respondEphemeral(s, i, "請提供分類、標籤或格式來列出圖片。")
+		return
+	}
+	if !canRead(i, q.Scope) {
+		respondEphemeral(s, i, "本伺服器尚未開啟全域圖庫。")
+		return
+	}
+
+	if categoryFilter != "" {
+		lib, err := storeFor(q.Scope)
+		if err != nil {
+			fmt.Println("讀取圖庫失敗:", err)
+			return
+		}
+		categories, err := lib.Categories()
+		if err != nil {
+			fmt.Println("讀取圖庫失敗:", err)
+			return
+		}
+		q.Category = categories[categoryFilter]
+		if q.Category == "" { //無此分類
+			respondEphemeral(s, i, fmt.Sprintf("找不到分類 %q。", categoryFilter))
+			return
+		}
+	}
+
+	respondListCommand(s, i, q, options)
+}
+
+// 處理 /listall
+func handleListAll(s *discordgo.Session, i *discordgo.InteractionCreate, options optionMap) {
+	q := listQuery{All: true, Scope: targetScope(i, options), Grid: wantGrid(options)}
+	if !canRead(i, q.Scope) {
+		respondEphemeral(s, i, "本伺服器尚未開啟全域圖庫。")
+		return
+	}
+	respondListCommand(s, i, q, options)
+}
+
+// 以 page 選項指定的頁數回應指令
+func respondListCommand(s *discordgo.Session, i *discordgo.InteractionCreate, q listQuery, options optionMap) {
+	page := 0
+	if opt, ok := options["page"]; ok {
+		page = int(opt.IntValue()) - 1 // 調整為零基索引
+	}
+
+	p, err := q.render(page)
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		return
+	}
+	if page < 0 || page >= p.pages {
+		respondEphemeral(s, i, fmt.Sprintf("頁數超出範圍。總共 %d 頁。", p.pages))
+		return
+	}
+	respondList(s, i, q, p, false)
+}
+
+// 處理換頁按鈕與跳頁選單，arg 為 "按鈕:頁數:查詢條件"
+func handleListPage(s *discordgo.Session, i *discordgo.InteractionCreate, arg string) {
+	parts := strings.SplitN(arg, ":", 3)
+	if len(parts) != 3 {
+		return
+	}
+	q, ok := decodeListQuery(parts[2])
+	if !ok {
+		return
+	}
+	if !canRead(i, q.Scope) {
+		respondEphemeral(s, i, "無法讀取此圖庫。")
+		return
+	}
+
+	page, _ := strconv.Atoi(parts[1])
+	if values := i.MessageComponentData().Values; parts[0] == "jump" && len(values) > 0 {
+		page, _ = strconv.Atoi(values[0])
+	}
+
+	p, err := q.render(page) // 圖庫可能已經改變，render 會把頁數限制在範圍內
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		return
+	}
+	respondList(s, i, q, p, true)
+}
+
+// 回應一頁列表，update 為 true 時直接修改按鈕所在的訊息
+func respondList(s *discordgo.Session, i *discordgo.InteractionCreate, q listQuery, p listPage, update bool) {
+	content := p.content
+	components, ok := pageComponents(q, p)
+	if !ok {
+		content += "\n（篩選條件太長，無法使用換頁按鈕，請以 page 選項換頁）"
+	}
+
+	if q.Grid && len(p.images) > 0 {
+		respondContactSheet(s, i, content, components, p.images, update)
+		return
+	}
+
+	responseType := discordgo.InteractionResponseChannelMessageWithSource
+	if update {
+		responseType = discordgo.InteractionResponseUpdateMessage
+	}
+	response := &discordgo.InteractionResponse{
+		Type: responseType,
+		Data: &discordgo.InteractionResponseData{
+			Content:     content,
+			Components:  components,
+			Attachments: &[]*discordgo.MessageAttachment{}, // 移除之前頁面的縮圖網格
+			Flags:       discordgo.MessageFlagsEphemeral,   // 僅使用者可見。
+		},
+	}
+	err := s.InteractionRespond(i.Interaction, response)
+	if err != nil {
+		fmt.Println("發送回應失敗:", err)
+	}
+}
+
+// 建立換頁按鈕與跳頁選單，只有一頁時不需要任何元件
+// CustomID 超過長度上限時返回 false
+func pageComponents(q listQuery, p listPage) ([]discordgo.MessageComponent, bool) {
+	components := []discordgo.MessageComponent{}
+	if p.pages <= 1 {
+		return components, true
+	}
+	encoded := q.encode()
+	customID := func(button string, page int) string {
+		return fmt.Sprintf("list:%s:%d:%s", button, page, encoded)
+	}
+	if len(customID("first", p.pages)) > maxCustomIDLength {
+		return components, false
+	}
+
+	first, last := p.page == 0, p.page == p.pages-1
+	buttons := discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+		discordgo.Button{Label: "« 第一頁", Style: discordgo.SecondaryButton, CustomID: customID("first", 0), Disabled: first},
+		discordgo.Button{Label: "‹ 上一頁", Style: discordgo.PrimaryButton, CustomID: customID("prev", p.page-1), Disabled: first},
+		discordgo.Button{Label: "下一頁 ›", Style: discordgo.PrimaryButton, CustomID: customID("next", p.page+1), Disabled: last},
+		discordgo.Button{Label: "最後一頁 »", Style: discordgo.SecondaryButton, CustomID: customID("last", p.pages-1), Disabled: last},
+	}}
+
+	// 選單最多 25 個選項，頁數太多時只列出目前頁數附近的頁面
+	from := p.page - 12
+	if from > p.pages-25 {
+		from = p.pages - 25
+	}
+	if from < 0 {
+		from = 0
+	}
+	var options []discordgo.SelectMenuOption
+	for n := from; n < p.pages && n < from+25; n++ {
+		options = append(options, discordgo.SelectMenuOption{
+			Label:   fmt.Sprintf("第 %d 頁", n+1),
+			Value:   strconv.Itoa(n),
+			Default: n == p.page,
+		})
+	}
+	jump := discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+		discordgo.SelectMenu{
+			CustomID:    customID("jump", p.page),
+			Placeholder: "跳到指定頁數",
+			Options:     options,
+		},
+	}}
+	return append(components, buttons, jump), true
+}
+
+// render 讀取圖庫並產生第 page 頁（從 0 開始）的內容，超出範圍的頁數會被限制在範圍內
+func (q listQuery) render(page int) (listPage, error) {
+	lib, err := storeFor(q.Scope)
+	if err != nil {
+		return listPage{}, err
+	}
+	images, err := q.images(lib)
+	if err != nil {
+		return listPage{}, err
+	}
+	categories, err := lib.Categories()
+	if err != nil {
+		return listPage{}, err
+	}
+	infos, err := lib.CategoryInfos()
+	if err != nil {
+		return listPage{}, err
+	}
+
+	p := listPage{pages: (len(images) + listPageSize - 1) / listPageSize}
+	if p.pages == 0 {
+		p.pages = 1
+	}
+	p.page = min(max(page, 0), p.pages-1)
+	start := p.page * listPageSize
+	end := min(start+listPageSize, len(images))
+	p.images = images[start:end]
+
+	// 構建輸出內容
+	content := ""
+	if q.Category != "" {
+		content += fmt.Sprintf("%s:\n", categoryTitle(q.Category, categories, infos)) //列出分類名稱
+	}
+	if len(q.Tags) > 0 {
+		sep := " + "
+		if !q.MatchAll {
+			sep = " / "
+		}
+		content += fmt.Sprintf("標籤: %s\n", strings.Join(q.Tags, sep))
+	}
+	if q.Format == "animated" {
+		content += "格式: 動態圖片\n"
+	} else if q.Format != "" {
+		content += fmt.Sprintf("格式: %s\n", strings.ToUpper(q.Format))
+	}
+
+	lastCategory := ""
+	for _, img := range p.images {
+		// /listall 在分類變化時添加分類標題
+		if q.All && img.Category != lastCategory {
+			lastCategory = img.Category
+			content += fmt.Sprintf("\n%s:\n", categoryTitle(lastCategory, categories, infos))
+		}
+		content += fmt.Sprintf("ID: %s   名稱: %s\n", displayID(img), img.Name)
+	}
+	if len(p.images) == 0 {
+		content += "無圖片可顯示。\n"
+	}
+
+	// 添加頁碼
+	content += fmt.Sprintf("\n第 %d/%d 頁", p.page+1, p.pages)
+	p.content = content
+	return p, nil
+}
+
+// images 返回符合條件的所有圖片
+// /listall 依分類分組後再依顯示代碼排序（換過分類的圖片ID不在原本的分類中），/list 依ID排序
+func (q listQuery) images(lib database.Store) ([]database.ImageData, error) {
+	if q.All {
+		all, err := lib.List()
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(all, func(a, b int) bool {
+			if all[a].Category != all[b].Category {
+				return database.CompareCodes(all[a].Category, all[b].Category) < 0
+			}
+			return all[a].Code < all[b].Code
+		})
+		return all, nil
+	}
+
+	var filtered []database.ImageData
+	var err error
+	switch {
+	case q.Category != "":
+		filtered, err = lib.ListByCategory(q.Category)
+	case len(q.Tags) > 0:
+		filtered, err = lib.ListByTags(q.Tags, q.MatchAll)
+	default:
+		filtered, err = lib.List()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if q.Category != "" && len(q.Tags) > 0 { // 同時指定分類與標籤時取交集
+		tagged, err := lib.ListByTags(q.Tags, q.MatchAll)
+		if err != nil {
+			return nil, err
+		}
+		ids := make(map[string]bool, len(tagged))
+		for _, img := range tagged {
+			ids[img.ID] = true
+		}
+		var both []database.ImageData
+		for _, img := range filtered {
+			if ids[img.ID] {
+				both = append(both, img)
+			}
+		}
+		filtered = both
+	}
+	if q.Format != "" {
+		var matched []database.ImageData
+		for _, img := range filtered {
+			if matchesFormat(img, q.Format) {
+				matched = append(matched, img)
+			}
+		}
+		filtered = matched
+	}
+	return filtered, nil
+}
@@ -0,0 +1,57 @@
+package bot
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/etas94/godcbot/config"
+	"github.com/etas94/godcbot/database"
+)
+
+// mirrorer 在背景把圖片網址下載到本機，停用時為 nil
+var mirrorer *database.Mirrorer
+
+// defaultMirrorInterval 是未設定時背景鏡像的間隔
+const defaultMirrorInterval = 30 * time.Minute
+
+// 依照配置啟動背景鏡像
+func startMirrorer(cfg *config.Config) {
+	interval := defaultMirrorInterval
+	if cfg.MirrorIntervalMinutes < 0 {
+		fmt.Println("已停用圖片網址的背景鏡像")
+		return
+	}
+	if cfg.MirrorIntervalMinutes > 0 {
+		interval = time.Duration(cfg.MirrorIntervalMinutes) * time.Minute
+	}
+	mirrorer = database.NewMirrorer(libraries, blobs, maxUploadSize)
+	mirrorer.Start(interval)
+}
+
+// 返回 /send 使用的圖片來源
+// 只有 LinkChecker 最近一次檢查確認原始網址正常時才使用網址；網址失效、從未檢查、結果已過期
+// 或停用了 LinkChecker 時，若有本機鏡像則改為上傳鏡像的檔案。只依照已記錄的結果判斷，不在回應互動之前對外發出請求
+func sendSource(img database.ImageData) (string, []*discordgo.File, error) {
+	ref := usableMirror(img)
+	if ref == nil || linkVerified(img) {
+		return imageSource(img)
+	}
+	if img.Health.Broken() {
+		fmt.Printf("圖片 %q 的網址已失效，改用本機鏡像\n", img.Name)
+	}
+	return blobSource(ref)
+}
+
+// 返回圖片目前網址的本機鏡像，沒有可用的鏡像時返回 nil
+func usableMirror(img database.ImageData) *database.BlobRef {
+	if img.URL == "" || !img.Mirror.Available() || img.Mirror.URL != img.URL {
+		return nil
+	}
+	return img.Mirror.Blob
+}
+
+// 返回圖片的網址是否在檢查間隔內被 LinkChecker 確認為正常
+func linkVerified(img database.ImageData) bool {
+	return linkChecker != nil && !linkChecker.NeedsCheck(img, time.Now()) && !img.Health.Broken()
+}
@@ -0,0 +1,295 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/etas94/godcbot/config"
+)
+
+// Role 是成員在伺服器中使用機器人的權限等級，較高的等級包含較低等級的所有權限
+type Role int
+
+const (
+	RoleViewer      Role = iota // 檢視者：查看、搜尋與傳送圖片
+	RoleContributor             // 貢獻者：新增圖片，修改標籤與別名
+	RoleCurator                 // 策展人：刪除圖片、更改分類與管理分類
+	RoleAdmin                   // 管理員：變更伺服器設定與權限
+)
+
+// defaultRole 是伺服器沒有設定 DefaultRole 時，一般成員的權限等級
+const defaultRole = RoleContributor
+
+// roleKeys 是保存在伺服器設定中的等級名稱
+var roleKeys = map[Role]string{
+	RoleViewer:      "viewer",
+	RoleContributor: "contributor",
+	RoleCurator:     "curator",
+	RoleAdmin:       "admin",
+}
+
+// roleLabels 是顯示給使用者的等級名稱
+var roleLabels = map[Role]string{
+	RoleViewer:      "檢視者",
+	RoleContributor: "貢獻者",
+	RoleCurator:     "策展人",
+	RoleAdmin:       "管理員",
+}
+
+// 將設定中的等級名稱轉為 Role
+func parseRole(key string) (Role, bool) {
+	for role, k := range roleKeys {
+		if k == key {
+			return role, true
+		}
+	}
+	return RoleViewer, false
+}
+
+// commandRoles 是每個指令需要的最低等級，"指令 子指令" 的設定優先於整個指令
+// 未列出的指令只有管理員可以使用，避免新增指令時忘記設定而開放給所有人
+var commandRoles = map[string]Role{
+	"ping":          RoleViewer,
+	"image":         RoleViewer,
+	"send":          RoleViewer,
+	"list":          RoleViewer,
+	"listall":       RoleViewer,
+	"tag list":      RoleViewer,
+	"addimage":      RoleContributor,
+	uploadMenuName:  RoleContributor,
+	"tag":           RoleContributor,
+	"alias":         RoleContributor,
+	"delimage":      RoleCurator,
+	"restore":       RoleCurator,
+	"history":       RoleContributor,
+	"classify":      RoleCurator,
+	"category":      RoleCurator,
+	"imagehealth":   RoleCurator,
+	"globallibrary": RoleAdmin,
+	"permissions":   RoleAdmin,
+
+	"submissions list":    RoleContributor,
+	"submissions channel": RoleAdmin,
+	"auditlog search":     RoleCurator,
+	"auditlog channel":    RoleAdmin,
+}
+
+// componentRoles 是訊息元件與表單需要的最低等級，以 CustomID 的動作為鍵
+var componentRoles = map[string]Role{
+	"pick":           RoleViewer,
+	"list":           RoleViewer,
+	"dup-confirm":    RoleContributor,
+	"dup-cancel":     RoleContributor,
+	"upload":         RoleContributor,
+	"health-delete":  RoleCurator,
+	"trash-undo":     RoleCurator,
+	"history-revert": RoleCurator,
+	"health-replace": RoleCurator,
+	"sub-approve":    RoleCurator,
+	"sub-reject":     RoleCurator,
+	"sub-edit":       RoleCurator,
+}
+
+// 註冊指令時設定的 default_member_permissions，讓 Discord 預設只對有相應權限的成員顯示指令
+// 伺服器管理員可以在「整合」設定中調整；實際的權限仍由 authorize 依照 commandRoles 檢查
+var (
+	curatorPermission = int64(discordgo.PermissionManageMessages)
+	adminPermission   = int64(discordgo.PermissionManageServer)
+)
+
+// 返回指令需要的最低等級
+func commandRole(data discordgo.ApplicationCommandInteractionData) Role {
+	if len(data.Options) > 0 && data.Options[0].Type == discordgo.ApplicationCommandOptionSubCommand {
+		if role, ok := commandRoles[data.Name+" "+data.Options[0].Name]; ok {
+			return role
+		}
+	}
+	if role, ok := commandRoles[data.Name]; ok {
+		return role
+	}
+	return RoleAdmin
+}
+
+// 返回訊息元件或表單需要的最低等級
+func componentRole(action string) Role {
+	if role, ok := componentRoles[action]; ok {
+		return role
+	}
+	return RoleAdmin
+}
+
+// 返回成員的權限等級
+// 全域管理員與擁有「管理員」或「管理伺服器」權限的成員一律為管理員；
+// 其他成員取身分組對應的最高等級（可以低於預設等級），沒有對應時使用伺服器的預設等級
+// 私訊中沒有身分組，只能查看全域圖庫
+func memberRole(i *discordgo.InteractionCreate) Role {
+	if user := interactionUser(i); user != nil && globalAdmins[user.ID] {
+		return RoleAdmin
+	}
+	if i.Member == nil {
+		return RoleViewer
+	}
+	if i.Member.Permissions&(discordgo.PermissionAdministrator|discordgo.PermissionManageServer) != 0 {
+		return RoleAdmin
+	}
+
+	// 有對應的身分組時以身分組為準，即使低於預設等級（例如限制特定身分組只能查看）
+	settings := guildSettings.Get(i.GuildID)
+	role, mapped := RoleViewer, false
+	for _, id := range i.Member.Roles {
+		if r, ok := parseRole(settings.Roles[id]); ok && (!mapped || r > role) {
+			role, mapped = r, true
+		}
+	}
+	if mapped {
+		return role
+	}
+	if r, ok := parseRole(settings.DefaultRole); ok {
+		return r
+	}
+	return defaultRole
+}
+
+// 檢查成員是否至少擁有 required 等級，不足時回應拒絕訊息並返回 false
+func authorize(s *discordgo.Session, i *discordgo.InteractionCreate, required Role) bool {
+	role := memberRole(i)
+	if role >= required {
+		return true
+	}
+	respondEphemeral(s, i, fmt.Sprintf("你沒有權限使用此功能：需要「%s」以上的等級，你目前是「%s」。", roleLabels[required], roleLabels[role]))
+	return false
+}
+
+// levelChoices 是 /permissions 中可選的等級
+func levelChoices(roles ...Role) []*discordgo.ApplicationCommandOptionChoice {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(roles))
+	for _, role := range roles {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: roleLabels[role], Value: roleKeys[role]})
+	}
+	return choices
+}
+
+// permissionsCommand 是 /permissions 指令群組的定義
+var permissionsCommand = &discordgo.ApplicationCommand{
+	Name:                     "permissions",
+	Description:              "設定本伺服器成員使用圖庫的權限",
+	DefaultMemberPermissions: &adminPermission,
+	DMPermission:             &dmDisabled,
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "role",
+			Description: "設定身分組的權限等級",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "role",
+					Description: "Discord 身分組",
+					Type:        discordgo.ApplicationCommandOptionRole,
+					Required:    true,
+				},
+				{
+					Name:        "level",
+					Description: "權限等級",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    true,
+					Choices: append(levelChoices(RoleViewer, RoleContributor, RoleCurator, RoleAdmin),
+						&discordgo.ApplicationCommandOptionChoice{Name: "移除設定", Value: "none"}),
+				},
+			},
+		},
+		{
+			Name:        "default",
+			Description: "設定沒有對應身分組的成員的權限等級",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "level",
+					Description: "權限等級",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    true,
+					Choices:     levelChoices(RoleViewer, RoleContributor, RoleCurator),
+				},
+			},
+		},
+		{
+			Name:        "show",
+			Description: "顯示目前的權限設定",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+		},
+	},
+}
+
+// 處理 /permissions role、/permissions default 與 /permissions show
+func handlePermissions(s *discordgo.Session, i *discordgo.InteractionCreate, options optionMap) {
+	if i.GuildID == "" {
+		respondEphemeral(s, i, "此指令只能在伺服器中使用。")
+		return
+	}
+
+	var content string
+	var err error
+	switch sub := i.ApplicationCommandData().Options[0].Name; sub {
+	case "role":
+		role := options["role"].RoleValue(s, i.GuildID)
+		roleID := options["role"].Value.(string)
+		level := options["level"].StringValue()
+		err = guildSettings.Update(i.GuildID, func(settings *config.GuildSettings) {
+			if level == "none" {
+				delete(settings.Roles, roleID)
+				return
+			}
+			if settings.Roles == nil {
+				settings.Roles = make(map[string]string)
+			}
+			settings.Roles[roleID] = level
+		})
+		name := "<@&" + roleID + ">"
+		if role != nil {
+			name = role.Name
+		}
+		if r, ok := parseRole(level); ok {
+			content = fmt.Sprintf("已將身分組 %s 設為「%s」。", name, roleLabels[r])
+		} else {
+			content = fmt.Sprintf("已移除身分組 %s 的權限設定。", name)
+		}
+
+	case "default":
+		level := options["level"].StringValue()
+		err = guildSettings.Update(i.GuildID, func(settings *config.GuildSettings) {
+			settings.DefaultRole = level
+		})
+		r, _ := parseRole(level)
+		content = fmt.Sprintf("沒有對應身分組的成員現在是「%s」。", roleLabels[r])
+
+	case "show":
+		content = formatPermissions(guildSettings.Get(i.GuildID))
+	}
+	if err != nil {
+		fmt.Println("儲存伺服器設定失敗:", err)
+		respondEphemeral(s, i, "儲存伺服器設定失敗，請稍後再試。")
+		return
+	}
+	respondEphemeral(s, i, content)
+}
+
+// 將伺服器的權限設定格式化為顯示用的文字
+func formatPermissions(settings config.GuildSettings) string {
+	role := defaultRole
+	if r, ok := parseRole(settings.DefaultRole); ok {
+		role = r
+	}
+	content := fmt.Sprintf("一般成員：%s\n擁有「管理伺服器」權限的成員：%s\n", roleLabels[role], roleLabels[RoleAdmin])
+
+	ids := make([]string, 0, len(settings.Roles))
+	for id := range settings.Roles {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if r, ok := parseRole(settings.Roles[id]); ok {
+			content += fmt.Sprintf("<@&%s>：%s\n", id, roleLabels[r])
+		}
+	}
+	return content
+}
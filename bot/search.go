@@ -0,0 +1,312 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/etas94/godcbot/database"
+)
+
+const (
+	// pickerSize 是選單最多列出的候選數量
+	pickerSize = 5
+	// 第一名與第二名的分數差距小於 pickerMargin 時，讓使用者自行選擇
+	pickerMargin = 0.1
+)
+
+// scopedResult 是附帶圖庫範圍的搜尋結果
+type scopedResult struct {
+	Scope string
+	database.SearchResult
+}
+
+// 在互動可讀取的圖庫中尋找圖片
+// 完全相符的ID會直接返回；否則以模糊搜尋評分，前幾名分數接近時返回候選清單讓使用者選擇
+func resolveImage(i *discordgo.InteractionCreate, identifier string) (database.ImageData, []scopedResult, error) {
+	scopes := readableScopes(i)
+
+	// 先檢查輸入是否為 ID
+	for _, scope := range scopes {
+		lib, err := storeFor(scope)
+		if err != nil {
+			return database.ImageData{}, nil, err
+		}
+		img, err := lib.GetByID(identifier)
+		if !errors.Is(err, database.ErrNotFound) {
+			return img, nil, err
+		}
+	}
+
+	var results []scopedResult
+	for _, scope := range scopes {
+		lib, err := storeFor(scope)
+		if err != nil {
+			return database.ImageData{}, nil, err
+		}
+		ranked, err := lib.RankedSearch(identifier, pickerSize)
+		if err != nil {
+			return database.ImageData{}, nil, err
+		}
+		for _, r := range ranked {
+			results = append(results, scopedResult{Scope: scope, SearchResult: r})
+		}
+	}
+	if len(results) == 0 {
+		return database.ImageData{}, nil, database.ErrNotFound
+	}
+
+	// 依分數排序，同分時伺服器的圖庫優先於全域圖庫（scopes 的順序）
+	sort.SliceStable(results, func(a, b int) bool {
+		return results[a].Score > results[b].Score
+	})
+
+	top := results[0]
+	if len(results) == 1 || top.Score >= 1 || top.Score-results[1].Score >= pickerMargin {
+		return top.Image, nil, nil
+	}
+	if len(results) > pickerSize {
+		results = results[:pickerSize]
+	}
+	return database.ImageData{}, results, nil
+}
+
+// 回應候選選單，讓使用者從相似的圖片中選擇
+// command 會記錄在選單的 CustomID 中，選擇後依原本的指令顯示或傳送圖片
+func respondPicker(s *discordgo.Session, i *discordgo.InteractionCreate, command string, candidates []scopedResult) {
+	options := make([]discordgo.SelectMenuOption, 0, len(candidates))
+	for _, c := range candidates {
+		options = append(options, discordgo.SelectMenuOption{
+			Label:       truncate(fmt.Sprintf("%s – %s", c.Image.ID, c.Image.Name), 100),
+			Value:       c.Scope + ":" + c.Image.ID,
+			Description: fmt.Sprintf("相似度 %.0f%%", c.Score*100),
+		})
+	}
+
+	response := &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: "找到多張相似的圖片，請選擇：",
+			Flags:   discordgo.MessageFlagsEphemeral,
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+					discordgo.SelectMenu{
+						CustomID:    "pick:" + command,
+						Placeholder: "選擇圖片",
+						Options:     options,
+					},
+				}},
+			},
+		},
+	}
+	err := s.InteractionRespond(i.Interaction, response)
+	if err != nil {
+		fmt.Println("發送回應失敗:", err)
+	}
+}
+
+// 處理候選選單的選擇，arg 為原本的指令名稱
+func handlePick(s *discordgo.Session, i *discordgo.InteractionCreate, command string) {
+	values := i.MessageComponentData().Values
+	if len(values) == 0 {
+		return
+	}
+	scope, id, ok := strings.Cut(values[0], ":")
+	if !ok || !canRead(i, scope) {
+		respondEphemeral(s, i, "無法讀取此圖庫。")
+		return
+	}
+
+	lib, err := storeFor(scope)
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		return
+	}
+	img, err := lib.GetByID(id)
+	if errors.Is(err, database.ErrNotFound) {
+		respondEphemeral(s, i, fmt.Sprintf("找不到圖片 %q", id))
+		return
+	}
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		return
+	}
+
+	switch command {
+	case "image":
+		// 以圖片取代原本的選單
+		respondImage(s, i, img, discordgo.InteractionResponseUpdateMessage)
+	case "send":
+		respondSend(s, i, img)
+	}
+}
+
+// 以僅使用者可見的嵌入訊息顯示圖片
+func respondImage(s *discordgo.Session, i *discordgo.InteractionCreate, imageData database.ImageData, responseType discordgo.InteractionResponseType) {
+	url, files, err := imageSource(imageData)
+	if err != nil {
+		fmt.Println("讀取圖片檔案失敗:", err)
+		respondEphemeral(s, i, fmt.Sprintf("無法讀取圖片 %q 的檔案。", imageData.Name))
+		return
+	}
+	defer closeFiles(files)
+
+	// 建立圖片嵌入訊息
+	embed := &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("圖片: %s", imageData.Name),
+		Image: &discordgo.MessageEmbedImage{
+			URL: url,
+		},
+	}
+	if len(imageData.Aliases) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "別名", Value: truncate(formatAliases(imageData.Aliases), 1024)})
+	}
+	if len(imageData.Tags) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "標籤", Value: truncate(formatTags(imageData.Tags), 1024)})
+	}
+	if meta := imageData.Meta; meta != nil {
+		embed.Fields = append(embed.Fields,
+			&discordgo.MessageEmbedField{Name: "格式", Value: meta.Format(), Inline: true},
+			&discordgo.MessageEmbedField{Name: "尺寸", Value: fmt.Sprintf("%d × %d", meta.Width, meta.Height), Inline: true},
+			&discordgo.MessageEmbedField{Name: "大小", Value: formatSize(meta.Size), Inline: true},
+		)
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: "SHA-256: " + meta.Hash}
+	}
+
+	response := &discordgo.InteractionResponse{
+		Type: responseType,
+		Data: &discordgo.InteractionResponseData{
+			Content:    "",
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: []discordgo.MessageComponent{},
+			Files:      files,
+			Flags:      discordgo.MessageFlagsEphemeral, // 僅使用者可見。
+		},
+	}
+	err = s.InteractionRespond(i.Interaction, response)
+	if err != nil {
+		fmt.Println("發送回應失敗:", err)
+	}
+}
+
+// 由機器人公開傳送圖片
+func respondSend(s *discordgo.Session, i *discordgo.InteractionCreate, imageData database.ImageData) {
+	url, files, err := sendSource(imageData)
+	if err != nil {
+		fmt.Println("讀取圖片檔案失敗:", err)
+		respondEphemeral(s, i, fmt.Sprintf("無法讀取圖片 %q 的檔案。", imageData.Name))
+		return
+	}
+	err = respondImageSource(s, i, url, files)
+	closeFiles(files)
+	if err == nil {
+		return
+	}
+	// 以網址發送失敗時改用本機鏡像再試一次
+	ref := usableMirror(imageData)
+	if files != nil || ref == nil {
+		fmt.Println("發送回應失敗:", err)
+		return
+	}
+	fmt.Printf("以網址發送圖片 %q 失敗，改用本機鏡像: %v\n", imageData.Name, err)
+	url, files, err = blobSource(ref)
+	if err != nil {
+		fmt.Println("讀取圖片檔案失敗:", err)
+		return
+	}
+	defer closeFiles(files)
+	if err := respondImageSource(s, i, url, files); err != nil {
+		fmt.Println("發送回應失敗:", err)
+	}
+}
+
+// 以嵌入訊息回應 /send 的圖片，files 是以附件引用的網址要附加的檔案
+func respondImageSource(s *discordgo.Session, i *discordgo.InteractionCreate, url string, files []*discordgo.File) error {
+	embed := &discordgo.MessageEmbed{
+		Image: &discordgo.MessageEmbedImage{
+			URL: url,
+		},
+	}
+
+	response := &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: fmt.Sprintf("From %s", interactionUser(i).Mention()),
+			Embeds:  []*discordgo.MessageEmbed{embed},
+			Files:   files,
+		},
+	}
+	return s.InteractionRespond(i.Interaction, response)
+}
+
+// 返回嵌入訊息使用的圖片網址，以附件上傳的圖片會一併返回要附加的檔案
+// 呼叫者必須在回應後以 closeFiles 關閉檔案
+func imageSource(img database.ImageData) (string, []*discordgo.File, error) {
+	if img.URL != "" || img.Blob == nil {
+		return img.URL, nil, nil
+	}
+	return blobSource(img.Blob)
+}
+
+// 開啟 BlobStore 中的檔案，返回以附件引用的網址與要附加的檔案
+func blobSource(ref *database.BlobRef) (string, []*discordgo.File, error) {
+	f, err := blobs.Open(ref)
+	if err != nil {
+		return "", nil, err
+	}
+	file := &discordgo.File{
+		Name:        ref.FileName(),
+		ContentType: ref.ContentType,
+		Reader:      f,
+	}
+	return "attachment://" + file.Name, []*discordgo.File{file}, nil
+}
+
+// 關閉 imageSource 開啟的檔案
+func closeFiles(files []*discordgo.File) {
+	for _, file := range files {
+		if c, ok := file.Reader.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+// 將位元組數格式化為 KB 或 MB
+func formatSize(size int64) string {
+	if size < 1<<20 {
+		return fmt.Sprintf("%d KB", (size+1023)/1024)
+	}
+	return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+}
+
+// 檢查圖片是否符合 /list 的格式篩選，"animated" 表示任何動態圖片
+// 尚未讀取資訊的圖片格式未知，不符合任何篩選
+func matchesFormat(img database.ImageData, format string) bool {
+	if img.Meta == nil {
+		return false
+	}
+	if format == "animated" {
+		return img.Meta.Animated
+	}
+	return img.Meta.ContentType == database.ImageFormats[format]
+}
+
+// 返回顯示用的圖片ID，換過分類的圖片會一併顯示目前的顯示代碼
+func displayID(img database.ImageData) string {
+	if img.Code == "" || img.Code == img.ID {
+		return img.ID
+	}
+	return fmt.Sprintf("%s（代碼 %s）", img.ID, img.Code)
+}
+
+// 將字串截斷為最多 n 個字元
+func truncate(str string, n int) string {
+	runes := []rune(str)
+	if len(runes) <= n {
+		return str
+	}
+	return string(runes[:n-1]) + "…"
+}
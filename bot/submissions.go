@@ -0,0 +1,360 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/etas94/godcbot/config"
+	"github.com/etas94/godcbot/database"
+)
+
+// submissions 保存等待審核的投稿
+var submissions *database.SubmissionStore
+
+// 投稿保存在此檔案中，機器人重新啟動後仍可審核
+const submissionsFilePath = "./submissions.json"
+
+// submissionsCommand 是 /submissions 指令群組的定義
+var submissionsCommand = &discordgo.ApplicationCommand{
+	Name:         "submissions",
+	Description:  "查看與設定等待審核的圖片投稿",
+	DMPermission: &dmDisabled,
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "list",
+			Description: "列出等待審核的投稿（策展人可以看到所有投稿，其他成員只會看到自己的）",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+		},
+		{
+			Name:        "channel",
+			Description: "設定審核投稿的頻道，未指定時關閉審核（所有成員的圖片直接加入圖庫）",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:         "channel",
+					Description:  "審核頻道(可選)",
+					Type:         discordgo.ApplicationCommandOptionChannel,
+					Required:     false,
+					ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+				},
+			},
+		},
+	},
+}
+
+// 檢查圖片是否需要先經過審核：伺服器設定了審核頻道，且成員不是策展人以上
+// 全域圖庫只有全域管理員可以修改，因此不需要審核
+func needsReview(i *discordgo.InteractionCreate, scope string) bool {
+	if scope == database.GlobalScope || i.GuildID == "" {
+		return false
+	}
+	return guildSettings.Get(i.GuildID).ReviewChannel != "" && memberRole(i) < RoleCurator
+}
+
+// 建立投稿並張貼到審核頻道，返回給投稿者的結果訊息
+func submitForReview(s *discordgo.Session, i *discordgo.InteractionCreate, scope string, img database.ImageData, category string) string {
+	sub := database.Submission{
+		ID:          i.ID,
+		Scope:       scope,
+		Image:       img,
+		Category:    category,
+		SubmitterID: interactionUser(i).ID,
+		ChannelID:   guildSettings.Get(i.GuildID).ReviewChannel,
+		CreatedAt:   time.Now(),
+	}
+
+	_, files, err := imageSource(sub.Image)
+	if err != nil {
+		fmt.Println("讀取圖片檔案失敗:", err)
+		return "讀取圖片檔案失敗，請稍後再試。"
+	}
+	defer closeFiles(files)
+	message, err := s.ChannelMessageSendComplex(sub.ChannelID, &discordgo.MessageSend{
+		Embeds:     []*discordgo.MessageEmbed{reviewEmbed(sub)},
+		Components: reviewComponents(sub.ID),
+		Files:      files,
+	})
+	if err != nil {
+		fmt.Println("張貼審核訊息失敗:", err)
+		return "無法張貼到審核頻道，請通知管理員檢查頻道設定與機器人的權限。"
+	}
+
+	sub.MessageID = message.ID
+	if err := submissions.Put(sub); err != nil {
+		fmt.Println("儲存投稿失敗:", err)
+		s.ChannelMessageDelete(sub.ChannelID, message.ID)
+		return "儲存投稿失敗，請稍後再試。"
+	}
+	return fmt.Sprintf("已送出圖片 %q 等待審核（投稿編號 %s），核准後才會加入圖庫。", img.Name, sub.ID)
+}
+
+// 建立審核訊息的嵌入內容
+func reviewEmbed(sub database.Submission) *discordgo.MessageEmbed {
+	url := sub.Image.URL
+	if url == "" && sub.Image.Blob != nil {
+		url = "attachment://" + sub.Image.Blob.FileName()
+	}
+	embed := &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("投稿: %s", sub.Image.Name),
+		Image: &discordgo.MessageEmbedImage{URL: url},
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "分類", Value: sub.Category, Inline: true},
+			{Name: "投稿者", Value: "<@" + sub.SubmitterID + ">", Inline: true},
+			{Name: "投稿編號", Value: sub.ID, Inline: true},
+		},
+		Timestamp: sub.CreatedAt.Format(time.RFC3339),
+	}
+	if sub.Image.URL != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "網址", Value: truncate(sub.Image.URL, 1024)})
+	}
+	return embed
+}
+
+// 建立審核訊息的「核准／退回／編輯」按鈕
+func reviewComponents(id string) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{Label: "核准", Style: discordgo.SuccessButton, CustomID: "sub-approve:" + id},
+			discordgo.Button{Label: "退回", Style: discordgo.DangerButton, CustomID: "sub-reject:" + id},
+			discordgo.Button{Label: "編輯", Style: discordgo.SecondaryButton, CustomID: "sub-edit:" + id},
+		}},
+	}
+}
+
+// 確認投稿仍在等待審核，且審核者可以修改投稿的圖庫
+func reviewTarget(s *discordgo.Session, i *discordgo.InteractionCreate, id string) (database.Submission, bool) {
+	sub, ok := submissions.Get(id)
+	if !ok {
+		respondEphemeral(s, i, "此投稿已經審核過了。")
+		return database.Submission{}, false
+	}
+	if !canWrite(i, sub.Scope) {
+		respondEphemeral(s, i, "你沒有權限修改此圖庫。")
+		return database.Submission{}, false
+	}
+	return sub, true
+}
+
+// 以審核結果取代審核訊息的按鈕
+func closeReview(s *discordgo.Session, i *discordgo.InteractionCreate, sub database.Submission, result string) {
+	embed := reviewEmbed(sub)
+	embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "審核結果", Value: result})
+	response := &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: []discordgo.MessageComponent{},
+		},
+	}
+	err := s.InteractionRespond(i.Interaction, response)
+	if err != nil {
+		fmt.Println("發送回應失敗:", err)
+	}
+}
+
+// 處理「核准」按鈕：分配ID並加入圖庫
+func handleSubmissionApprove(s *discordgo.Session, i *discordgo.InteractionCreate, id string) {
+	sub, ok := reviewTarget(s, i, id)
+	if !ok {
+		return
+	}
+	lib, err := storeFor(sub.Scope)
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		respondEphemeral(s, i, "讀取圖庫失敗，請稍後再試。")
+		return
+	}
+
+	// 先移除投稿，避免兩位審核者同時按下核准而加入兩次
+	sub, ok, err = submissions.Take(id)
+	if err != nil {
+		fmt.Println("儲存投稿失敗:", err)
+		respondEphemeral(s, i, "儲存投稿失敗，請稍後再試。")
+		return
+	}
+	if !ok {
+		respondEphemeral(s, i, "此投稿已經審核過了。")
+		return
+	}
+
+	added, _, err := addImage(s, i, lib, sub.Scope, sub.Image, sub.Category, true)
+	if err != nil {
+		// 加入失敗時保留投稿，讓審核者處理後再核准
+		if err := submissions.Put(sub); err != nil {
+			fmt.Println("儲存投稿失敗:", err)
+		}
+		if errors.Is(err, database.ErrNameTaken) {
+			respondEphemeral(s, i, fmt.Sprintf("無法核准，%v。請先以「編輯」更改名稱。", err))
+		} else {
+			fmt.Println("上傳圖片失敗:", err)
+			respondEphemeral(s, i, "加入圖片失敗，投稿已保留，請稍後再試。")
+		}
+		return
+	}
+	closeReview(s, i, sub, fmt.Sprintf("✅ 由 %s 核准，ID為：%s", interactionUser(i).Mention(), added.ID))
+}
+
+// 處理「退回」按鈕
+func handleSubmissionReject(s *discordgo.Session, i *discordgo.InteractionCreate, id string) {
+	if _, ok := reviewTarget(s, i, id); !ok {
+		return
+	}
+	sub, ok, err := submissions.Take(id)
+	if err != nil {
+		fmt.Println("儲存投稿失敗:", err)
+		respondEphemeral(s, i, "儲存投稿失敗，請稍後再試。")
+		return
+	}
+	if !ok {
+		respondEphemeral(s, i, "此投稿已經審核過了。")
+		return
+	}
+	// 投稿的檔案沒有其他圖庫使用時，由 blobCollector 回收
+	closeReview(s, i, sub, fmt.Sprintf("❌ 由 %s 退回", interactionUser(i).Mention()))
+}
+
+// 處理「編輯」按鈕，以表單修改投稿的名稱與分類
+func handleSubmissionEdit(s *discordgo.Session, i *discordgo.InteractionCreate, id string) {
+	sub, ok := reviewTarget(s, i, id)
+	if !ok {
+		return
+	}
+	response := &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: "sub-edit:" + id,
+			Title:    "編輯投稿",
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+					discordgo.TextInput{
+						CustomID:  "name",
+						Label:     "圖片的名稱",
+						Style:     discordgo.TextInputShort,
+						Value:     sub.Image.Name,
+						Required:  true,
+						MaxLength: 100,
+					},
+				}},
+				discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+					discordgo.TextInput{
+						CustomID:  "category",
+						Label:     "圖片的分類(可選)",
+						Style:     discordgo.TextInputShort,
+						Value:     categoryInput(sub.Category),
+						Required:  false,
+						MaxLength: 100,
+					},
+				}},
+			},
+		},
+	}
+	err := s.InteractionRespond(i.Interaction, response)
+	if err != nil {
+		fmt.Println("發送回應失敗:", err)
+	}
+}
+
+// 返回表單中分類欄位的預設值，未分類時留空
+func categoryInput(category string) string {
+	if category == database.UncategorizedName {
+		return ""
+	}
+	return category
+}
+
+// 處理「編輯投稿」表單的送出，並更新審核訊息
+func handleSubmissionEditModal(s *discordgo.Session, i *discordgo.InteractionCreate, id string) {
+	if _, ok := reviewTarget(s, i, id); !ok {
+		return
+	}
+	values := modalValues(i.ModalSubmitData().Components)
+	name := strings.TrimSpace(values["name"])
+	category := strings.TrimSpace(values["category"])
+	if category == "" {
+		category = database.UncategorizedName
+	}
+
+	sub, ok, err := submissions.Update(id, func(sub *database.Submission) {
+		sub.Image.Name = name
+		sub.Category = category
+	})
+	if err != nil {
+		fmt.Println("儲存投稿失敗:", err)
+		return
+	}
+	if !ok {
+		respondEphemeral(s, i, "此投稿已經審核過了。")
+		return
+	}
+
+	response := &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{reviewEmbed(sub)},
+			Components: reviewComponents(sub.ID),
+		},
+	}
+	err = s.InteractionRespond(i.Interaction, response)
+	if err != nil {
+		fmt.Println("發送回應失敗:", err)
+	}
+}
+
+// 處理 /submissions list 與 /submissions channel
+func handleSubmissions(s *discordgo.Session, i *discordgo.InteractionCreate, options optionMap) {
+	if i.GuildID == "" {
+		respondEphemeral(s, i, "此指令只能在伺服器中使用。")
+		return
+	}
+
+	if i.ApplicationCommandData().Options[0].Name == "channel" {
+		channelID := ""
+		if opt, ok := options["channel"]; ok {
+			channelID = opt.Value.(string)
+		}
+		err := guildSettings.Update(i.GuildID, func(settings *config.GuildSettings) {
+			settings.ReviewChannel = channelID
+		})
+		if err != nil {
+			fmt.Println("儲存伺服器設定失敗:", err)
+			respondEphemeral(s, i, "儲存伺服器設定失敗，請稍後再試。")
+			return
+		}
+		if channelID == "" {
+			respondEphemeral(s, i, "已關閉投稿審核，所有成員的圖片會直接加入圖庫。")
+		} else {
+			respondEphemeral(s, i, fmt.Sprintf("策展人以下的成員加入的圖片會先張貼到 <#%s> 等待審核。", channelID))
+		}
+		return
+	}
+
+	// 策展人以下的成員只列出自己的投稿
+	userID := ""
+	if memberRole(i) < RoleCurator {
+		userID = interactionUser(i).ID
+	}
+	content := ""
+	count := 0
+	for _, sub := range submissions.List(i.GuildID) {
+		if userID != "" && sub.SubmitterID != userID {
+			continue
+		}
+		count++
+		line := fmt.Sprintf("`%s` %s（分類：%s，投稿者 <@%s>，%s）https://discord.com/channels/%s/%s/%s\n",
+			sub.ID, sub.Image.Name, sub.Category, sub.SubmitterID, sub.CreatedAt.Format("2006-01-02 15:04"),
+			i.GuildID, sub.ChannelID, sub.MessageID)
+		if len(content)+len(line) > 1900 { // Discord 訊息長度上限為 2000
+			content += "……"
+			break
+		}
+		content += line
+	}
+	if count == 0 {
+		respondEphemeral(s, i, "目前沒有等待審核的投稿。")
+		return
+	}
+	respondEphemeral(s, i, "等待審核的投稿：\n"+content)
+}
@@ -0,0 +1,273 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/etas94/godcbot/database"
+)
+
+// tagCommand 是 /tag 指令群組的定義
+var tagCommand = &discordgo.ApplicationCommand{
+	Name:        "tag",
+	Description: "管理圖片的標籤",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "add",
+			Description: "為圖片加入標籤",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				identifierOption,
+				tagsOption(true),
+				libraryOption,
+			},
+		},
+		{
+			Name:        "remove",
+			Description: "移除圖片的標籤",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				identifierOption,
+				tagsOption(true),
+				libraryOption,
+			},
+		},
+		{
+			Name:        "list",
+			Description: "列出圖片的標籤，未指定圖片時列出圖庫中所有標籤",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:         "identifier",
+					Description:  "圖片的名稱或ID(可選)",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: true,
+				},
+				libraryOption,
+			},
+		},
+	},
+}
+
+// identifierOption 是指定單張圖片的必填選項
+var identifierOption = &discordgo.ApplicationCommandOption{
+	Name:         "identifier",
+	Description:  "圖片的名稱或ID",
+	Type:         discordgo.ApplicationCommandOptionString,
+	Required:     true,
+	Autocomplete: true,
+}
+
+// tagsOption 返回以逗號分隔多個標籤的選項
+func tagsOption(required bool) *discordgo.ApplicationCommandOption {
+	description := "以逗號分隔的標籤"
+	if !required {
+		description += "(可選)"
+	}
+	return &discordgo.ApplicationCommandOption{
+		Name:         "tags",
+		Description:  description,
+		Type:         discordgo.ApplicationCommandOptionString,
+		Required:     required,
+		Autocomplete: true,
+	}
+}
+
+// 處理 /tag add、/tag remove 與 /tag list
+func handleTag(s *discordgo.Session, i *discordgo.InteractionCreate, options optionMap) {
+	sub := i.ApplicationCommandData().Options[0].Name
+	scope := targetScope(i, options)
+
+	if sub == "list" {
+		handleTagList(s, i, options, scope)
+		return
+	}
+
+	if !canWrite(i, scope) {
+		respondEphemeral(s, i, "你沒有權限修改全域圖庫。")
+		return
+	}
+	lib, err := storeFor(scope)
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		return
+	}
+
+	identifier := options["identifier"].StringValue()
+	tags := database.ParseTags(options["tags"].StringValue())
+	if len(tags) == 0 {
+		respondEphemeral(s, i, "請提供至少一個標籤。")
+		return
+	}
+
+	var before, updated database.ImageData
+	err = lib.Transact(func(db *database.ImageDB) error {
+		img, ok := db.FindImage(identifier)
+		if !ok {
+			return database.ErrNotFound
+		}
+		before = img
+		if sub == "add" {
+			updated, _ = db.AddTags(img.ID, tags...)
+		} else {
+			updated, _ = db.RemoveTags(img.ID, tags...)
+		}
+		db.RecordRevision(&before, updated, interactionUser(i).ID, database.AuditUpdate, time.Now())
+		return nil
+	})
+	if errors.Is(err, database.ErrNotFound) {
+		respondEphemeral(s, i, fmt.Sprintf("找不到圖片 %q", identifier))
+		return
+	}
+	if err != nil {
+		fmt.Println("儲存圖庫失敗:", err)
+		return
+	}
+	if !reflect.DeepEqual(before.Tags, updated.Tags) {
+		action := "加入標籤 "
+		if sub == "remove" {
+			action = "移除標籤 "
+		}
+		recordAudit(s, i, scope, database.AuditUpdate, &before, &updated, action+strings.Join(tags, ", "))
+	}
+
+	respondEphemeral(s, i, fmt.Sprintf("圖片 %q（ID：%s）目前的標籤：%s", updated.Name, updated.ID, formatTags(updated.Tags)))
+}
+
+// 處理 /tag list
+func handleTagList(s *discordgo.Session, i *discordgo.InteractionCreate, options optionMap, scope string) {
+	if !canRead(i, scope) {
+		respondEphemeral(s, i, "本伺服器尚未開啟全域圖庫。")
+		return
+	}
+	lib, err := storeFor(scope)
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		return
+	}
+
+	if opt, ok := options["identifier"]; ok {
+		img, err := findImageExact(lib, opt.StringValue())
+		if errors.Is(err, database.ErrNotFound) {
+			respondEphemeral(s, i, fmt.Sprintf("找不到圖片 %q", opt.StringValue()))
+			return
+		}
+		if err != nil {
+			fmt.Println("讀取圖庫失敗:", err)
+			return
+		}
+		respondEphemeral(s, i, fmt.Sprintf("圖片 %q（ID：%s）的標籤：%s", img.Name, img.ID, formatTags(img.Tags)))
+		return
+	}
+
+	counts, err := lib.Tags()
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		return
+	}
+	if len(counts) == 0 {
+		respondEphemeral(s, i, "圖庫中還沒有任何標籤。")
+		return
+	}
+
+	// 依使用次數排序，次數相同時依名稱排序
+	tags := make([]string, 0, len(counts))
+	for tag := range counts {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(a, b int) bool {
+		if counts[tags[a]] != counts[tags[b]] {
+			return counts[tags[a]] > counts[tags[b]]
+		}
+		return tags[a] < tags[b]
+	})
+
+	content := "標籤：\n"
+	for _, tag := range tags {
+		line := fmt.Sprintf("%s（%d 張）\n", tag, counts[tag])
+		if len(content)+len(line) > 1900 { // Discord 訊息長度上限為 2000
+			content += "……"
+			break
+		}
+		content += line
+	}
+	respondEphemeral(s, i, content)
+}
+
+// 將標籤格式化為顯示用的字串
+func formatTags(tags []string) string {
+	if len(tags) == 0 {
+		return "（無）"
+	}
+	return strings.Join(tags, ", ")
+}
+
+// 根據輸入建議標籤，只補完逗號後最後一段，前面已輸入的標籤保持不變
+func tagChoices(i *discordgo.InteractionCreate, options optionMap, input string) ([]*discordgo.ApplicationCommandOptionChoice, error) {
+	scope := targetScope(i, options)
+	if !canRead(i, scope) {
+		return nil, nil
+	}
+	lib, err := storeFor(scope)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := lib.Tags()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := ""
+	query := input
+	if n := strings.LastIndexAny(input, ",，"); n >= 0 {
+		_, size := utf8.DecodeRuneInString(input[n:])
+		prefix = input[:n+size]
+		query = input[len(prefix):]
+	}
+	query = database.NormalizeTag(query)
+	entered := make(map[string]bool)
+	for _, tag := range database.ParseTags(prefix) {
+		entered[tag] = true
+	}
+
+	var matched []string
+	for tag := range counts {
+		if !entered[tag] && strings.Contains(tag, query) {
+			matched = append(matched, tag)
+		}
+	}
+	// 開頭相符的優先，其次依使用次數
+	sort.Slice(matched, func(a, b int) bool {
+		pa, pb := strings.HasPrefix(matched[a], query), strings.HasPrefix(matched[b], query)
+		if pa != pb {
+			return pa
+		}
+		if counts[matched[a]] != counts[matched[b]] {
+			return counts[matched[a]] > counts[matched[b]]
+		}
+		return matched[a] < matched[b]
+	})
+
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, maxChoices)
+	for _, tag := range matched {
+		if len(choices) == maxChoices {
+			break
+		}
+		value := prefix + tag
+		if len(value) > 100 { // Discord 選項值的長度上限
+			continue
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  truncate(fmt.Sprintf("%s（%d 張）", value, counts[tag]), 100),
+			Value: value,
+		})
+	}
+	return choices, nil
+}
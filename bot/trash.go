@@ -0,0 +1,229 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/etas94/godcbot/config"
+	"github.com/etas94/godcbot/database"
+)
+
+// trashPurger 定期永久刪除回收桶中過期的圖片，永久保留時為 nil
+var trashPurger *database.TrashPurger
+
+const (
+	// defaultTrashRetention 是未設定時刪除的圖片在回收桶中保留的時間
+	defaultTrashRetention = 30 * 24 * time.Hour
+	// trashPurgeInterval 是清理回收桶的間隔
+	trashPurgeInterval = time.Hour
+	// maxTrashListed 是 /restore 未指定圖片時列出的數量
+	maxTrashListed = 15
+)
+
+// trashRetention 是刪除的圖片在回收桶中保留的時間，0 表示永久保留
+var trashRetention = defaultTrashRetention
+
+// restoreCommand 是 /restore 指令的定義
+var restoreCommand = &discordgo.ApplicationCommand{
+	Name:                     "restore",
+	Description:              "從回收桶還原刪除的圖片，未指定圖片時列出回收桶的內容",
+	DefaultMemberPermissions: &curatorPermission,
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "identifier",
+			Description: "要還原的圖片ID或名稱(可選)",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    false,
+		},
+		libraryOption,
+	},
+}
+
+// 依照配置啟動回收桶的定期清理
+func startTrashPurger(cfg *config.Config) {
+	if cfg.TrashRetentionDays < 0 {
+		trashRetention = 0
+		fmt.Println("回收桶中的圖片將永久保留")
+		return
+	}
+	if cfg.TrashRetentionDays > 0 {
+		trashRetention = time.Duration(cfg.TrashRetentionDays) * 24 * time.Hour
+	}
+	trashPurger = database.NewTrashPurger(libraries, trashRetention, blobCollector)
+	trashPurger.Start(trashPurgeInterval)
+}
+
+// 將圖片移到回收桶並寫入稽核紀錄
+func trashImage(s *discordgo.Session, i *discordgo.InteractionCreate, lib database.Store, scope, id, detail string) (database.ImageData, error) {
+	var img database.ImageData
+	err := lib.Transact(func(db *database.ImageDB) error {
+		var ok bool
+		if img, ok = db.TrashImage(id, interactionUser(i).ID, time.Now()); !ok {
+			return database.ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return database.ImageData{}, err
+	}
+	recordAudit(s, i, scope, database.AuditDelete, &img, nil, detail)
+	return img, nil
+}
+
+// 將回收桶中的圖片放回圖庫並寫入稽核紀錄
+func restoreImage(s *discordgo.Session, i *discordgo.InteractionCreate, lib database.Store, scope, id string) (database.ImageData, error) {
+	var img database.ImageData
+	err := lib.Transact(func(db *database.ImageDB) error {
+		var err error
+		if img, err = db.RestoreImage(id); err != nil {
+			return err
+		}
+		db.RecordRevision(nil, img, interactionUser(i).ID, database.AuditRestore, time.Now())
+		return nil
+	})
+	if err != nil {
+		return database.ImageData{}, err
+	}
+	recordAudit(s, i, scope, database.AuditRestore, nil, &img, "")
+	return img, nil
+}
+
+// 返回刪除成功的訊息，說明可以還原的期限
+func trashedMessage(img database.ImageData) string {
+	content := fmt.Sprintf("已將 %q（ID：%s）移到回收桶。", img.Name, img.ID)
+	if trashRetention > 0 {
+		content += fmt.Sprintf("%d 天內可以使用 /restore 還原。", int(trashRetention.Hours()/24))
+	}
+	return content
+}
+
+// 回應刪除成功的訊息，附上「復原」按鈕
+func respondTrashed(s *discordgo.Session, i *discordgo.InteractionCreate, scope string, img database.ImageData) {
+	response := &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: trashedMessage(img),
+			Flags:   discordgo.MessageFlagsEphemeral, // 僅使用者可見。
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label:    "復原",
+						Style:    discordgo.SecondaryButton,
+						CustomID: "trash-undo:" + scope + ":" + img.ID,
+					},
+				}},
+			},
+		},
+	}
+	err := s.InteractionRespond(i.Interaction, response)
+	if err != nil {
+		fmt.Println("發送回應失敗:", err)
+	}
+}
+
+// 處理「復原」按鈕，arg 為 "範圍:永久ID"
+func handleTrashUndo(s *discordgo.Session, i *discordgo.InteractionCreate, arg string) {
+	scope, id, _ := strings.Cut(arg, ":")
+	if !canWrite(i, scope) {
+		respondEphemeral(s, i, "你沒有權限修改全域圖庫。")
+		return
+	}
+	lib, err := storeFor(scope)
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		return
+	}
+
+	img, err := restoreImage(s, i, lib, scope, id)
+	if errors.Is(err, database.ErrNotFound) {
+		updateMessage(s, i, "回收桶中已經沒有這張圖片，可能已被還原或永久刪除。")
+		return
+	}
+	if errors.Is(err, database.ErrNameTaken) {
+		respondEphemeral(s, i, fmt.Sprintf("無法還原圖片，%v。", err))
+		return
+	}
+	if err != nil {
+		fmt.Println("儲存圖庫失敗:", err)
+		return
+	}
+	updateMessage(s, i, fmt.Sprintf("已復原 %q（ID：%s）。", img.Name, displayID(img)))
+}
+
+// 處理 /restore，指定圖片時還原，否則列出回收桶中最近刪除的圖片
+func handleRestore(s *discordgo.Session, i *discordgo.InteractionCreate, options optionMap) {
+	scope := targetScope(i, options)
+	if !canWrite(i, scope) {
+		respondEphemeral(s, i, "你沒有權限修改全域圖庫。")
+		return
+	}
+	lib, err := storeFor(scope)
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		return
+	}
+
+	var trashed database.TrashedImage
+	var listed []database.TrashedImage
+	identifier := ""
+	if opt, ok := options["identifier"]; ok {
+		identifier = opt.StringValue()
+	}
+	err = lib.View(func(db *database.ImageDB) error {
+		if identifier == "" {
+			listed = db.TrashedImages()
+			return nil
+		}
+		var ok bool
+		if trashed, ok = db.FindTrashed(identifier); !ok {
+			return database.ErrNotFound
+		}
+		return nil
+	})
+	if errors.Is(err, database.ErrNotFound) {
+		respondEphemeral(s, i, fmt.Sprintf("回收桶中找不到圖片 %q。", identifier))
+		return
+	}
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		return
+	}
+	if identifier == "" {
+		respondEphemeral(s, i, formatTrash(listed))
+		return
+	}
+
+	img, err := restoreImage(s, i, lib, scope, trashed.Image.ID)
+	if errors.Is(err, database.ErrNameTaken) {
+		respondEphemeral(s, i, fmt.Sprintf("無法還原圖片，%v。", err))
+		return
+	}
+	if err != nil {
+		fmt.Println("儲存圖庫失敗:", err)
+		return
+	}
+	respondEphemeral(s, i, fmt.Sprintf("成功還原 %q，ID為：%s", img.Name, displayID(img)))
+}
+
+// 將回收桶的內容格式化為清單，每行顯示ID、名稱、刪除者與永久刪除的時間
+func formatTrash(entries []database.TrashedImage) string {
+	if len(entries) == 0 {
+		return "回收桶是空的。"
+	}
+	lines := []string{fmt.Sprintf("回收桶中有 %d 張圖片：", len(entries))}
+	for n, e := range entries {
+		if n == maxTrashListed {
+			lines = append(lines, fmt.Sprintf("……以及其他 %d 張", len(entries)-n))
+			break
+		}
+		line := fmt.Sprintf("`%s` %s，<t:%d:R> 由 <@%s> 刪除", e.Image.ID, truncate(e.Image.Name, 32), e.DeletedAt.Unix(), e.DeletedBy)
+		if trashRetention > 0 {
+			line += fmt.Sprintf("，<t:%d:R> 永久刪除", e.DeletedAt.Add(trashRetention).Unix())
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,328 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/etas94/godcbot/database"
+)
+
+// blobs 保存以附件上傳的圖片檔案
+var blobs *database.BlobStore
+
+// 上傳的圖片存放在此目錄，檔名為內容的雜湊值
+const blobDir = "./blobs"
+
+// blobCollector 定期刪除沒有任何圖庫或投稿使用的圖片檔案
+var blobCollector *database.BlobCollector
+
+const (
+	// blobCollectInterval 是回收圖片檔案的間隔
+	blobCollectInterval = time.Hour
+	// blobGracePeriod 是剛保存的檔案不會被回收的時間，涵蓋保存檔案到寫入圖庫之間的空檔
+	blobGracePeriod = time.Hour
+)
+
+// 啟動圖片檔案的定期回收
+func startBlobCollector() {
+	blobCollector = database.NewBlobCollector(libraries, blobs, submissions, blobGracePeriod)
+	blobCollector.Start(blobCollectInterval)
+}
+
+// maxUploadSize 是上傳圖片的大小上限（位元組），可以在設定檔中以 max_upload_mb 修改
+var maxUploadSize int64 = 8 << 20
+
+// uploadMenuName 是訊息右鍵選單中「加入圖庫」動作的名稱
+const uploadMenuName = "加入圖庫"
+
+// downloadClient 用於下載使用者上傳的附件與提供的網址，只能連線到公開的位址
+var downloadClient = database.NewPublicClient(30 * time.Second)
+
+// 處理 /addimage，圖片來源可以是網址或上傳的附件
+func handleAddImage(s *discordgo.Session, i *discordgo.InteractionCreate, options optionMap) {
+	name := options["name"].StringValue()
+
+	var url string
+	if opt, ok := options["url"]; ok {
+		url = opt.StringValue()
+	}
+	var attachment *discordgo.MessageAttachment
+	if opt, ok := options["attachment"]; ok {
+		attachment = i.ApplicationCommandData().Resolved.Attachments[opt.Value.(string)]
+	}
+	if (url == "") == (attachment == nil) {
+		respondEphemeral(s, i, "請提供圖片的網址或上傳附件（擇一）。")
+		return
+	}
+
+	category := database.UncategorizedName
+	if opt, ok := options["category"]; ok { //有category參數
+		category = opt.StringValue()
+	}
+
+	scope := targetScope(i, options)
+	if !canWrite(i, scope) {
+		respondEphemeral(s, i, "你沒有權限修改全域圖庫。")
+		return
+	}
+	lib, err := storeFor(scope)
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		return
+	}
+
+	// 下載圖片可能超過 Discord 的三秒回應期限，先延後回應
+	deferEphemeral(s, i)
+	if attachment == nil {
+		submitImage(s, i, lib, scope, fetchURL(name, url), category)
+	} else {
+		uploadAttachment(s, i, lib, scope, attachment, name, category)
+	}
+}
+
+// 下載網址的內容作為鏡像並讀取圖片資訊與感知雜湊，感知雜湊供重複檢查使用
+// 下載失敗時仍可加入圖片，只是無法比較檔案內容（Mirrorer 之後會在背景重試）
+func fetchURL(name, url string) database.ImageData {
+	img := database.ImageData{Name: name, URL: url}
+	ref, err := downloadImage(url)
+	if err != nil {
+		fmt.Printf("下載圖片 %q 失敗: %v\n", url, err)
+		return img
+	}
+	img.Mirror = &database.Mirror{URL: url, Status: database.MirrorOK, Blob: ref, Location: blobs.Location(ref), CheckedAt: time.Now()}
+	img.Meta, img.PHash = blobs.Analyze(ref)
+	return img
+}
+
+// 將附件存入 BlobStore 後加入圖庫，結果以 editResponse 回覆
+func uploadAttachment(s *discordgo.Session, i *discordgo.InteractionCreate, lib database.Store, scope string, attachment *discordgo.MessageAttachment, name, category string) {
+	ref, err := storeAttachment(attachment)
+	if errors.Is(err, database.ErrBlobTooLarge) || errors.Is(err, database.ErrUnsupportedType) {
+		editResponse(s, i, fmt.Sprintf("無法上傳圖片，%v。", err))
+		return
+	}
+	if err != nil {
+		fmt.Println("下載附件失敗:", err)
+		editResponse(s, i, "下載附件失敗，請稍後再試。")
+		return
+	}
+
+	img := database.ImageData{Name: name, Blob: ref}
+	img.Meta, img.PHash = blobs.Analyze(ref)
+	submitImage(s, i, lib, scope, img, category)
+}
+
+// 返回加入圖片的結果訊息
+func addedMessage(img database.ImageData, category string, err error) string {
+	if errors.Is(err, database.ErrNameTaken) {
+		return fmt.Sprintf("無法添加圖片，%v。", err)
+	}
+	if err != nil {
+		fmt.Println("上傳圖片失敗:", err)
+		return "上傳圖片失敗，請稍後再試。"
+	}
+	if img.URL == "" && img.Blob != nil {
+		return fmt.Sprintf("成功上傳圖片 %q，分類為：%s，ID為：%s（%s，%d KB）", img.Name, category, img.ID, img.Blob.ContentType, (img.Blob.Size+1023)/1024)
+	}
+	return fmt.Sprintf("成功添加圖片 %q，分類為：%s，ID為：%s，網址為：%s", img.Name, category, img.ID, img.URL)
+}
+
+// 在同一個交易中分配分類與ID並加入圖片，避免同時新增時拿到相同的ID
+// 分類不存在時會建立；名稱不可與其他圖片的名稱或別名相同，要取代既有的圖片請先刪除（移到回收桶）
+// force 為 false 時若找到重複的圖片則不加入，改為返回重複的圖片；成功加入時會寫入稽核紀錄
+func addImage(s *discordgo.Session, i *discordgo.InteractionCreate, lib database.Store, scope string, img database.ImageData, category string, force bool) (database.ImageData, []database.Duplicate, error) {
+	var dups []database.Duplicate
+	err := lib.Transact(func(db *database.ImageDB) error {
+		// 先檢查名稱再找重複的圖片，名稱已被使用時不需要詢問是否加入
+		if err := db.CheckNames(img, ""); err != nil {
+			return err
+		}
+		if !force {
+			if dups = db.FindDuplicates(img); len(dups) > 0 {
+				return nil
+			}
+		}
+
+		img.Category = db.EnsureCategory(category) //沒有此分類時分配新的編號
+		img.ID = db.AllocateID(img.Category)
+		img.Code = img.ID // 顯示代碼在換分類之前與永久ID相同
+
+		if category != database.UncategorizedName { // 分類同時作為標籤
+			img = img.WithTags(category)
+		}
+		if err := db.AddImage(img); err != nil {
+			return err
+		}
+		db.RecordRevision(nil, img, interactionUser(i).ID, database.AuditAdd, time.Now())
+		return nil
+	})
+	if err == nil && len(dups) == 0 {
+		recordAudit(s, i, scope, database.AuditAdd, nil, &img, "")
+	}
+	return img, dups, err
+}
+
+// 下載附件並存入 BlobStore，格式與大小的檢查以實際內容為準
+func storeAttachment(attachment *discordgo.MessageAttachment) (*database.BlobRef, error) {
+	if int64(attachment.Size) > maxUploadSize {
+		return nil, fmt.Errorf("%w（上限為 %d KB）", database.ErrBlobTooLarge, maxUploadSize/1024)
+	}
+	return downloadImage(attachment.URL)
+}
+
+// 下載網址的內容並存入 BlobStore
+func downloadImage(url string) (*database.BlobRef, error) {
+	resp, err := downloadClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下載時收到 %s", resp.Status)
+	}
+	return blobs.PutImage(resp.Body, maxUploadSize)
+}
+
+// 處理訊息右鍵選單的「加入圖庫」，以表單詢問圖片名稱與分類
+func handleUploadMenu(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	message := data.Resolved.Messages[data.TargetID]
+	attachment := imageAttachment(message, "")
+	if attachment == nil {
+		respondEphemeral(s, i, "這則訊息沒有圖片附件。")
+		return
+	}
+	if !canWrite(i, guildScope(i)) {
+		respondEphemeral(s, i, "你沒有權限修改全域圖庫。")
+		return
+	}
+
+	// 預設名稱為去掉副檔名的檔名
+	defaultName := strings.TrimSuffix(attachment.Filename, path.Ext(attachment.Filename))
+	response := &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: "upload:" + message.ID + ":" + attachment.ID,
+			Title:    "加入圖庫",
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+					discordgo.TextInput{
+						CustomID:  "name",
+						Label:     "圖片的名稱",
+						Style:     discordgo.TextInputShort,
+						Value:     truncate(defaultName, 100),
+						Required:  true,
+						MaxLength: 100,
+					},
+				}},
+				discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+					discordgo.TextInput{
+						CustomID:  "category",
+						Label:     "圖片的分類(可選)",
+						Style:     discordgo.TextInputShort,
+						Required:  false,
+						MaxLength: 100,
+					},
+				}},
+			},
+		},
+	}
+	err := s.InteractionRespond(i.Interaction, response)
+	if err != nil {
+		fmt.Println("發送回應失敗:", err)
+	}
+}
+
+// 處理「加入圖庫」表單的送出，arg 為 "訊息ID:附件ID"
+// 附件網址會過期，因此重新讀取訊息取得目前的網址
+func handleUploadModal(s *discordgo.Session, i *discordgo.InteractionCreate, arg string) {
+	messageID, attachmentID, _ := strings.Cut(arg, ":")
+	values := modalValues(i.ModalSubmitData().Components)
+	name := strings.TrimSpace(values["name"])
+	category := strings.TrimSpace(values["category"])
+	if category == "" {
+		category = database.UncategorizedName
+	}
+
+	scope := guildScope(i)
+	if !canWrite(i, scope) {
+		respondEphemeral(s, i, "你沒有權限修改全域圖庫。")
+		return
+	}
+	lib, err := storeFor(scope)
+	if err != nil {
+		fmt.Println("讀取圖庫失敗:", err)
+		return
+	}
+
+	deferEphemeral(s, i)
+	message, err := s.ChannelMessage(i.ChannelID, messageID)
+	if err != nil {
+		fmt.Println("讀取訊息失敗:", err)
+		editResponse(s, i, "找不到原本的訊息，可能已被刪除。")
+		return
+	}
+	attachment := imageAttachment(message, attachmentID)
+	if attachment == nil {
+		editResponse(s, i, "找不到原本的附件，可能已被刪除。")
+		return
+	}
+	uploadAttachment(s, i, lib, scope, attachment, name, category)
+}
+
+// 返回訊息中ID為 id 的附件，id 為空時返回第一個圖片附件
+func imageAttachment(message *discordgo.Message, id string) *discordgo.MessageAttachment {
+	if message == nil {
+		return nil
+	}
+	for _, attachment := range message.Attachments {
+		if id != "" && attachment.ID == id || id == "" && strings.HasPrefix(attachment.ContentType, "image/") {
+			return attachment
+		}
+	}
+	return nil
+}
+
+// 將表單中的文字欄位轉為以 CustomID 索引的映射
+func modalValues(components []discordgo.MessageComponent) map[string]string {
+	values := make(map[string]string)
+	for _, c := range components {
+		row, ok := c.(*discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+		for _, rc := range row.Components {
+			if input, ok := rc.(*discordgo.TextInput); ok {
+				values[input.CustomID] = input.Value
+			}
+		}
+	}
+	return values
+}
+
+// 延後回應，稍後以 editResponse 填入僅使用者可見的內容
+func deferEphemeral(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	response := &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral, // 僅使用者可見。
+		},
+	}
+	err := s.InteractionRespond(i.Interaction, response)
+	if err != nil {
+		fmt.Println("發送回應失敗:", err)
+	}
+}
+
+// 修改已延後的回應內容
+func editResponse(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	_, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+	if err != nil {
+		fmt.Println("發送回應失敗:", err)
+	}
+}
@@ -8,6 +8,25 @@ import (
 
 type Config struct {
 	Token string `json:"token"`
+
+	// Storage 選擇圖庫的儲存後端："json"（預設）或 "sqlite"
+	Storage string `json:"storage,omitempty"`
+	// SQLitePath 是 SQLite 資料庫檔案的路徑，僅在 Storage 為 "sqlite" 時使用
+	SQLitePath string `json:"sqlite_path,omitempty"`
+	// BackupCount 是 JSON 圖庫保留的輪替備份數量，0 表示使用預設值
+	BackupCount int `json:"backup_count,omitempty"`
+	// GlobalAdmins 是可以修改共用全域圖庫的使用者ID
+	GlobalAdmins []string `json:"global_admins,omitempty"`
+	// MaxUploadMB 是以附件上傳的圖片大小上限（MB），0 表示使用預設值
+	MaxUploadMB int `json:"max_upload_mb,omitempty"`
+	// MirrorIntervalMinutes 是背景下載圖片網址鏡像的間隔（分鐘），0 表示使用預設值，負數表示停用
+	MirrorIntervalMinutes int `json:"mirror_interval_minutes,omitempty"`
+	// LinkCheckIntervalMinutes 是每張圖片網址重新檢查的間隔（分鐘），0 表示使用預設值，負數表示停用
+	LinkCheckIntervalMinutes int `json:"link_check_interval_minutes,omitempty"`
+	// LinkCheckConcurrency 是檢查網址時同時發出的請求數量上限，0 表示使用預設值
+	LinkCheckConcurrency int `json:"link_check_concurrency,omitempty"`
+	// TrashRetentionDays 是刪除的圖片在回收桶中保留的天數，0 表示使用預設值，負數表示永久保留
+	TrashRetentionDays int `json:"trash_retention_days,omitempty"`
 }
 
 func ReadConfig() (*Config, error) {
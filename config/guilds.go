@@ -0,0 +1,100 @@
+package config
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/etas94/godcbot/database"
+)
+
+// GuildSettings 是單一伺服器的設定
+type GuildSettings struct {
+	UseGlobal bool `json:"use_global"` // 是否同時讀取共用的全域圖庫
+
+	// Roles 將 Discord 身分組ID對應到使用圖庫的權限等級（viewer、contributor、curator、admin）
+	Roles map[string]string `json:"roles,omitempty"`
+	// DefaultRole 是沒有對應身分組的成員的權限等級，空字串表示使用預設值
+	DefaultRole string `json:"default_role,omitempty"`
+	// ReviewChannel 是審核投稿的頻道，設定後策展人以下的成員加入的圖片需要先經過審核
+	ReviewChannel string `json:"review_channel,omitempty"`
+	// AuditChannel 是同步張貼修改紀錄的頻道，空字串表示不張貼
+	AuditChannel string `json:"audit_channel,omitempty"`
+}
+
+// clone 返回不與原本共用映射的複本，讓 Get 返回的設定不會被之後的修改影響
+func (g GuildSettings) clone() GuildSettings {
+	if g.Roles != nil {
+		roles := make(map[string]string, len(g.Roles))
+		for id, role := range g.Roles {
+			roles[id] = role
+		}
+		g.Roles = roles
+	}
+	return g
+}
+
+// GuildSettingsStore 保存所有伺服器的設定，修改後立即寫回檔案
+type GuildSettingsStore struct {
+	filePath string
+	mu       sync.RWMutex
+	guilds   map[string]GuildSettings
+}
+
+// LoadGuildSettings 從 filePath 讀取伺服器設定，檔案不存在時返回空的設定
+func LoadGuildSettings(filePath string) (*GuildSettingsStore, error) {
+	s := &GuildSettingsStore{filePath: filePath, guilds: make(map[string]GuildSettings)}
+
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.guilds); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get 返回伺服器的設定，未設定過的伺服器返回預設值
+func (s *GuildSettingsStore) Get(guildID string) GuildSettings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.guilds[guildID]
+}
+
+// Update 交給 fn 修改伺服器的設定並寫回檔案，寫入失敗時維持原本的設定
+func (s *GuildSettingsStore) Update(guildID string, fn func(settings *GuildSettings)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, existed := s.guilds[guildID]
+	settings := old.clone()
+	fn(&settings)
+	s.guilds[guildID] = settings
+	if err := s.save(); err != nil {
+		if existed {
+			s.guilds[guildID] = old
+		} else {
+			delete(s.guilds, guildID)
+		}
+		return err
+	}
+	return nil
+}
+
+// save 將所有伺服器的設定寫回檔案，呼叫者必須持有寫入鎖
+func (s *GuildSettingsStore) save() error {
+	data, err := json.MarshalIndent(s.guilds, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return database.WriteFileAtomic(s.filePath, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
@@ -2,8 +2,10 @@ package database
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"os"
-	"strings"
+	"path/filepath"
 	"sync"
 )
 
@@ -13,31 +15,136 @@ var dbLock sync.Mutex
 // ImageDB 結構保存所有圖片和分類數據
 // Images 是圖片資料映射
 // Categories 是分類名稱與對應編號的映射
+// 修改圖片請使用 PutImage/RemoveImage/ReplaceImage，才能維持索引的一致
 type ImageDB struct {
-	Images     map[string]ImageData `json:"images"`
-	Categories map[string]string    `json:"categories"` // 儲存分類名稱與對應的編號
+	Images        map[string]ImageData `json:"images"`
+	Categories    map[string]string    `json:"categories"`               // 儲存分類名稱與對應的編號
+	SchemaVersion int                  `json:"schema_version,omitempty"` // 資料格式版本，載入時會自動升級
+
+	// CategoryInfo 以分類編號為鍵保存分類的說明與表情符號
+	CategoryInfo map[string]CategoryInfo `json:"category_info,omitempty"`
+
+	// Sequences 記錄每個序號最後分配的值（分類編號與各分類的圖片序號），只會遞增，
+	// 因此刪除的分類或圖片的編號不會再被分配；請使用 EnsureCategory 與 AllocateID 分配
+	Sequences map[string]int `json:"sequences,omitempty"`
+
+	// Redirects 將不再使用的舊ID或顯示代碼對應到圖片的永久ID，讓已經傳出去的舊ID仍然可以使用
+	Redirects map[string]string `json:"redirects,omitempty"`
+
+	// Trash 以永久ID為鍵保存移到回收桶的圖片，這些圖片不會出現在查詢與索引中
+	Trash map[string]TrashedImage `json:"trash,omitempty"`
+
+	// History 以永久ID為鍵保存圖片的版本紀錄（最舊的在前），請使用 RecordRevision 加入
+	History map[string][]Revision `json:"history,omitempty"`
+
+	// 以下為次要索引，不會寫入檔案，載入時重建並在修改時同步更新
+	// 索引中的切片一律整份替換而不原地修改，因此複本可以共用
+	byID       map[string]string   // 圖片ID → Images 的鍵
+	byCode     map[string]string   // 顯示代碼 → 圖片ID
+	byName     map[string][]string // 正規化名稱或別名 → 依ID排序的圖片ID
+	byCategory map[string][]string // 分類編號 → 依ID排序的圖片ID
+	byTag      map[string][]string // 標籤 → 依ID排序的圖片ID
 }
 
 // ImageData 結構保存單張圖片的詳細資訊
 type ImageData struct {
-	URL      string `json:"url"`      // 圖片網址
+	URL      string `json:"url"`      // 圖片網址，以附件上傳的圖片沒有網址
 	Name     string `json:"name"`     // 圖片名稱
-	ID       string `json:"id"`       // 圖片ID
+	ID       string `json:"id"`       // 圖片的永久ID，建立後不會再改變
 	Category string `json:"category"` // 圖片分類的編號
+
+	// Code 是依目前分類編排的顯示代碼，格式與ID相同；建立時與ID相同，換分類時會重新分配
+	Code string `json:"code,omitempty"`
+
+	// Tags 是圖片的標籤（已正規化、不重複），一張圖片可以有任意數量的標籤
+	// 修改時必須建立新的切片，不可原地修改，因為快照之間會共用
+	Tags []string `json:"tags,omitempty"`
+
+	// Aliases 是圖片的其他名稱，依字母排序；與 Name 一樣可用於查詢與搜尋
+	// 別名不可與其他圖片的名稱或別名相同，修改規則與 Tags 相同
+	Aliases []string `json:"aliases,omitempty"`
+
+	// Blob 是以附件上傳、保存在本機 BlobStore 中的圖片檔案，沒有時為 nil
+	Blob *BlobRef `json:"blob,omitempty"`
+
+	// Mirror 是 URL 在本機的鏡像與下載狀態，由 Mirrorer 在背景更新，尚未鏡像時為 nil
+	Mirror *Mirror `json:"mirror,omitempty"`
+
+	// Health 是 URL 最近一次的檢查結果，由 LinkChecker 在背景更新，尚未檢查時為 nil
+	Health *LinkHealth `json:"health,omitempty"`
+
+	// PHash 是圖片的感知雜湊（見 PerceptualHash），用於找出重新壓縮過的重複圖片，未計算時為 0
+	PHash uint64 `json:"phash,omitempty"`
+
+	// Meta 是從圖片檔案讀取的格式、尺寸與大小，尚未下載或無法解碼時為 nil
+	Meta *ImageMeta `json:"meta,omitempty"`
 }
 
+// BackupCount 是 SaveDatabase 保留的輪替備份數量（檔名為 <檔案>.1 到 <檔案>.N，.1 最新）
+var BackupCount = 5
+
 // LoadDatabase 從文件中加載數據庫
+// 如果主檔案損毀，會改用最新的有效備份恢復主檔案並輸出警告
 // 返回 *ImageDB 和錯誤（如果發生）
 func LoadDatabase(filePath string) (*ImageDB, error) {
 	dbLock.Lock()
 	defer dbLock.Unlock() //在當前函數執行完後自動解鎖
 
+	db, err := decodeFile(filePath)
+	if err == nil {
+		db.upgrade()
+		return db, nil
+	}
+	if os.IsNotExist(err) {
+		// 如果文件不存在，創建一個空的數據庫
+		return &ImageDB{
+			Images:        make(map[string]ImageData),
+			Categories:    make(map[string]string),
+			CategoryInfo:  make(map[string]CategoryInfo),
+			Sequences:     make(map[string]int),
+			Redirects:     make(map[string]string),
+			SchemaVersion: CurrentSchemaVersion,
+		}, nil
+	}
+
+	// 主檔案無法讀取或已損毀，依序嘗試備份
+	for n := 1; n <= BackupCount; n++ {
+		backupPath := backupName(filePath, n)
+		backup, backupErr := decodeFile(backupPath)
+		if backupErr != nil {
+			continue
+		}
+		// 以備份恢復主檔案，否則下次保存時損毀的主檔案會被輪替成 .1，擠掉有效的備份
+		if restoreErr := restoreFromBackup(filePath, backupPath); restoreErr != nil {
+			return nil, fmt.Errorf("圖庫 %s 無法讀取（%v），以備份 %s 恢復時失敗: %w", filePath, err, backupPath, restoreErr)
+		}
+		fmt.Printf("!!! 警告：圖庫 %s 無法讀取（%v），已改用備份 %s，損毀的檔案保留為 %s，請盡快檢查 !!!\n", filePath, err, backupPath, corruptName(filePath))
+		backup.upgrade()
+		return backup, nil
+	}
+	return nil, err
+}
+
+// corruptName 返回損毀的主檔案被移開後的檔名
+func corruptName(filePath string) string {
+	return filePath + ".corrupt"
+}
+
+// restoreFromBackup 將損毀的主檔案移到 corruptName，再以備份複製一份新的主檔案
+func restoreFromBackup(filePath, backupPath string) error {
+	if err := os.Rename(filePath, corruptName(filePath)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := copyFile(backupPath, filePath); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(filePath))
+}
+
+// decodeFile 讀取並解析單一數據庫檔案
+func decodeFile(filePath string) (*ImageDB, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		if os.IsNotExist(err) {
-			// 如果文件不存在，創建一個空的數據庫
-			return &ImageDB{Images: make(map[string]ImageData), Categories: make(map[string]string)}, nil
-		}
 		return nil, err
 	}
 	defer file.Close()
@@ -51,43 +158,83 @@ func LoadDatabase(filePath string) (*ImageDB, error) {
 	return &db, nil
 }
 
+// backupName 返回第 n 個備份的檔名
+func backupName(filePath string, n int) string {
+	return fmt.Sprintf("%s.%d", filePath, n)
+}
+
 // SaveDatabase 將數據庫保存到文件中
+// 與 WriteFileAtomic 相同地原子取代原檔，並在取代之前輪替備份
 // 返回錯誤（如果發生）
 func SaveDatabase(filePath string, db *ImageDB) error {
 	dbLock.Lock()
 	defer dbLock.Unlock()
 
-	file, err := os.Create(filePath)
-	if err != nil {
-		return err
+	return replaceFile(filePath, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(db)
+	}, func() error {
+		return rotateBackups(filePath)
+	})
+}
+
+// rotateBackups 將現有的備份往後移一號，並把目前的主檔案保存為 .1
+// 超過 BackupCount 的最舊備份會被刪除
+func rotateBackups(filePath string) error {
+	if BackupCount <= 0 {
+		return nil
+	}
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return nil // 第一次保存，沒有可以備份的檔案
 	}
-	defer file.Close()
 
-	encoder := json.NewEncoder(file)
-	if err := encoder.Encode(db); err != nil {
+	if err := os.Remove(backupName(filePath, BackupCount)); err != nil && !os.IsNotExist(err) {
 		return err
 	}
+	for n := BackupCount - 1; n >= 1; n-- {
+		err := os.Rename(backupName(filePath, n), backupName(filePath, n+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
 
+	// 使用硬連結保留主檔案，讓主檔案在任何時刻都存在；不支援硬連結時改為複製
+	if err := os.Link(filePath, backupName(filePath, 1)); err != nil {
+		return copyFile(filePath, backupName(filePath, 1))
+	}
 	return nil
 }
 
+// copyFile 將 src 複製到 dst 並 fsync
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
 // SearchImageByName 根據部分名稱搜尋圖片
-// 返回第一個匹配的圖片ID（string），如果沒有匹配則返回空字串和nil
+// 返回ID最小的匹配圖片ID（string），如果沒有匹配則返回空字串和nil
 func SearchImageByName(db *ImageDB, searchString string) (string, error) {
-	var matchedID string
-
-	// 遍歷所有圖片資料
-	for _, image := range db.Images {
-		// 檢查圖片名稱是否包含搜尋字串（大小寫不敏感）
-		if strings.Contains(strings.ToLower(image.Name), strings.ToLower(searchString)) {
-			matchedID = image.ID
-			break // 找到一個就停止
-		}
-	}
+	matched := db.SearchName(searchString)
 
 	// 如果沒有找到匹配的圖片，返回空字串
-	if matchedID == "" {
+	if len(matched) == 0 {
 		return "", nil
 	}
-	return matchedID, nil
+	return matched[0].ID, nil
 }
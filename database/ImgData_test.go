@@ -0,0 +1,174 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeFile 將 content 寫入 path，測試失敗時中止
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadDatabaseUpgrades(t *testing.T) {
+	type want struct {
+		id, code string
+		tags     []string
+	}
+	tests := []struct {
+		name    string
+		content string
+		images  map[string]want
+	}{
+		{
+			name: "版本 0",
+			content: `{
+				"categories": {"NULL": "00", "Cats": "01", "Dogs": "02"},
+				"images": {
+					"tabby": {"name": "tabby", "id": "01001", "category": "01"},
+					"rex":   {"name": "rex", "id": "02001", "category": "02"},
+					"stray": {"name": "stray", "id": "7", "category": "02"},
+					"misc":  {"name": "misc", "id": "00001", "category": "00"}
+				}
+			}`,
+			images: map[string]want{
+				"tabby": {"01001", "01001", []string{"cats"}},
+				"rex":   {"02001", "02001", []string{"dogs"}},
+				"stray": {"02002", "02002", []string{"dogs"}},
+				"misc":  {"00001", "00001", nil},
+			},
+		},
+		{
+			// 版本 1 已經把分類轉為標籤，不會再加入一次
+			name: "版本 2",
+			content: `{
+				"schema_version": 2,
+				"categories": {"NULL": "00", "Cats": "01"},
+				"sequences": {"category": 1, "image:01": 1},
+				"images": {
+					"tabby": {"name": "tabby", "id": "01001", "category": "01"}
+				}
+			}`,
+			images: map[string]want{
+				"tabby": {"01001", "01001", nil},
+			},
+		},
+		{
+			name: "目前版本",
+			content: `{
+				"schema_version": 3,
+				"categories": {"NULL": "00", "Cats": "01"},
+				"images": {
+					"tabby": {"name": "tabby", "id": "01001", "code": "01002", "category": "01", "tags": ["cute"]}
+				}
+			}`,
+			images: map[string]want{
+				"tabby": {"01001", "01002", []string{"cute"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "image.json")
+			writeFile(t, path, tt.content)
+			db, err := LoadDatabase(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if db.SchemaVersion != CurrentSchemaVersion {
+				t.Errorf("SchemaVersion = %d，預期 %d", db.SchemaVersion, CurrentSchemaVersion)
+			}
+			if len(db.Images) != len(tt.images) {
+				t.Errorf("有 %d 張圖片，預期 %d", len(db.Images), len(tt.images))
+			}
+			for key, w := range tt.images {
+				img := db.Images[key]
+				if img.ID != w.id || img.Code != w.code || !reflect.DeepEqual(img.Tags, w.tags) {
+					t.Errorf("圖片 %q = ID %s、代碼 %s、標籤 %v，預期 ID %s、代碼 %s、標籤 %v", key, img.ID, img.Code, img.Tags, w.id, w.code, w.tags)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadDatabaseUpgradeInitializesSequences(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "image.json")
+	writeFile(t, path, `{
+		"categories": {"NULL": "00", "Cats": "01", "Dogs": "04"},
+		"images": {"rex": {"name": "rex", "id": "04007", "category": "04"}}
+	}`)
+	db, err := LoadDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := db.EnsureCategory("Birds"); code != "05" {
+		t.Errorf("EnsureCategory(\"Birds\") = %q，預期 05", code)
+	}
+	if id := db.AllocateID("04"); id != "04008" {
+		t.Errorf("AllocateID(\"04\") = %q，預期 04008", id)
+	}
+}
+
+func TestSaveDatabaseRotatesBackups(t *testing.T) {
+	defer func(n int) { BackupCount = n }(BackupCount)
+	BackupCount = 2
+
+	path := filepath.Join(t.TempDir(), "image.json")
+	for _, name := range []string{"a", "b", "c", "d"} {
+		db := &ImageDB{Images: map[string]ImageData{name: {ID: "00001", Name: name, Category: UncategorizedCode}}, SchemaVersion: CurrentSchemaVersion}
+		if err := SaveDatabase(path, db); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 主檔案為最新的版本，.1 與 .2 依序為較舊的版本，更舊的已被刪除
+	for file, name := range map[string]string{path: "d", backupName(path, 1): "c", backupName(path, 2): "b"} {
+		db, err := decodeFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := db.Images[name]; !ok || len(db.Images) != 1 {
+			t.Errorf("%s 的圖片為 %v，預期只有 %q", filepath.Base(file), db.Images, name)
+		}
+	}
+	if _, err := os.Stat(backupName(path, 3)); !os.IsNotExist(err) {
+		t.Errorf("保留了超過 BackupCount 的備份：%v", err)
+	}
+}
+
+func TestLoadDatabaseFallsBackToBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "image.json")
+	writeFile(t, path, `{"images": {`)
+	writeFile(t, backupName(path, 1), `not json`)
+	writeFile(t, backupName(path, 2), `{"schema_version": 3, "images": {"tabby": {"name": "tabby", "id": "00001", "code": "00001", "category": "00"}}}`)
+
+	db, err := LoadDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.Images["tabby"]; !ok {
+		t.Errorf("沒有使用有效的備份：%v", db.Images)
+	}
+
+	// 損毀的主檔案被移開，主檔案以備份恢復
+	corrupt, err := os.ReadFile(corruptName(path))
+	if err != nil || string(corrupt) != `{"images": {` {
+		t.Errorf("損毀的檔案 = %q, %v", corrupt, err)
+	}
+	if _, err := decodeFile(path); err != nil {
+		t.Errorf("主檔案沒有恢復：%v", err)
+	}
+}
+
+func TestLoadDatabaseAllCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "image.json")
+	writeFile(t, path, `{`)
+	if _, err := LoadDatabase(path); err == nil {
+		t.Error("主檔案與備份都無法讀取時沒有返回錯誤")
+	}
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrNameTaken 表示名稱或別名已被其他圖片使用
+var ErrNameTaken = errors.New("名稱或別名已被其他圖片使用")
+
+// names 返回圖片名稱與所有別名正規化後的結果（不重複），用於建立名稱索引
+func (img ImageData) names() []string {
+	names := []string{NormalizeName(img.Name)}
+	for _, alias := range img.Aliases {
+		alias = NormalizeName(alias)
+		dup := false
+		for _, name := range names {
+			if name == alias {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			names = append(names, alias)
+		}
+	}
+	return names
+}
+
+// HasAlias 返回圖片是否有此別名（比對正規化後的結果）
+func (img ImageData) HasAlias(alias string) bool {
+	alias = NormalizeName(alias)
+	for _, a := range img.Aliases {
+		if NormalizeName(a) == alias {
+			return true
+		}
+	}
+	return false
+}
+
+// NameOwner 返回名稱或別名為 name 的圖片中，ID不是 exceptID 的第一張
+func (db *ImageDB) NameOwner(name, exceptID string) (ImageData, bool) {
+	db.ensureIndex()
+	for _, id := range db.byName[NormalizeName(name)] {
+		if id != exceptID {
+			return db.Images[db.byID[id]], true
+		}
+	}
+	return ImageData{}, false
+}
+
+// CheckNames 檢查 img 的名稱與別名是否已被ID不是 exceptID 的圖片使用，已被使用時返回 ErrNameTaken
+func (db *ImageDB) CheckNames(img ImageData, exceptID string) error {
+	for _, name := range append([]string{img.Name}, img.Aliases...) {
+		if owner, ok := db.NameOwner(name, exceptID); ok {
+			return nameTaken(name, owner)
+		}
+	}
+	return nil
+}
+
+// nameTaken 返回 name 已被圖片 owner 使用的 ErrNameTaken
+func nameTaken(name string, owner ImageData) error {
+	return fmt.Errorf("%w：%q 已被圖片 %q（ID：%s）使用", ErrNameTaken, name, owner.Name, owner.ID)
+}
+
+// AddAlias 為ID為 id 的圖片加入別名，返回更新後的圖片
+// 別名與其他圖片的名稱或別名相同時返回 ErrNameTaken，與圖片本身的名稱或別名相同時不做任何修改
+func (db *ImageDB) AddAlias(id, alias string) (ImageData, error) {
+	img, ok := db.ImageByID(id)
+	if !ok {
+		return ImageData{}, ErrNotFound
+	}
+	alias = strings.Join(strings.Fields(alias), " ")
+	if alias == "" {
+		return ImageData{}, errors.New("別名不可為空白")
+	}
+	if owner, ok := db.NameOwner(alias, id); ok {
+		return ImageData{}, fmt.Errorf("%w：%q 已是圖片 %q（ID：%s）的名稱或別名", ErrNameTaken, alias, owner.Name, owner.ID)
+	}
+	if NormalizeName(alias) == NormalizeName(img.Name) || img.HasAlias(alias) {
+		return img, nil
+	}
+
+	// 建立新的切片，快照之間共用舊的切片
+	aliases := append(append([]string(nil), img.Aliases...), alias)
+	sort.Strings(aliases)
+	img.Aliases = aliases
+	db.ReplaceImage(id, img)
+	return img, nil
+}
+
+// RemoveAlias 移除ID為 id 的圖片的別名，返回更新後的圖片與是否有此別名
+func (db *ImageDB) RemoveAlias(id, alias string) (ImageData, bool, error) {
+	img, ok := db.ImageByID(id)
+	if !ok {
+		return ImageData{}, false, ErrNotFound
+	}
+	if !img.HasAlias(alias) {
+		return img, false, nil
+	}
+
+	var aliases []string
+	for _, a := range img.Aliases {
+		if NormalizeName(a) != NormalizeName(alias) {
+			aliases = append(aliases, a)
+		}
+	}
+	img.Aliases = aliases
+	db.ReplaceImage(id, img)
+	return img, true, nil
+}
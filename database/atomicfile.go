@@ -0,0 +1,62 @@
+package database
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// WriteFileAtomic 以 write 寫出的內容取代 filePath
+// 先寫入同目錄的暫存檔並 fsync，再以 rename 原子地取代原檔，
+// 因此中途當機或磁碟已滿都不會留下寫到一半的檔案
+func WriteFileAtomic(filePath string, write func(w io.Writer) error) error {
+	return replaceFile(filePath, write, nil)
+}
+
+// replaceFile 與 WriteFileAtomic 相同，但在暫存檔寫入完成、取代原檔之前呼叫 beforeRename（可為 nil）
+func replaceFile(filePath string, write func(w io.Writer) error, beforeRename func() error) error {
+	dir := filepath.Dir(filePath)
+	tmp, err := os.CreateTemp(dir, filepath.Base(filePath)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // rename 成功後此檔已不存在，Remove 會直接失敗而無影響
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if beforeRename != nil {
+		if err := beforeRename(); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir 對目錄執行 fsync，確保 rename 已寫入磁碟
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && runtime.GOOS != "windows" {
+		return err // Windows 不支援對目錄 fsync，忽略即可
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.json")
+	write := func(content string) func(io.Writer) error {
+		return func(w io.Writer) error {
+			_, err := io.WriteString(w, content)
+			return err
+		}
+	}
+
+	if err := WriteFileAtomic(path, write("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(path, write("second")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 寫入失敗時保留原檔，也不留下暫存檔
+	failed := errors.New("寫入失敗")
+	err := WriteFileAtomic(path, func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("WriteFileAtomic 返回 %v，預期 %v", err, failed)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "second" {
+		t.Errorf("檔案內容為 %q，預期 %q", data, "second")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("目錄中有 %d 個檔案，預期只有 data.json", len(entries))
+	}
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 稽核紀錄的動作
+const (
+	AuditAdd      = "add"      // 新增圖片
+	AuditDelete   = "delete"   // 刪除圖片
+	AuditUpdate   = "update"   // 修改圖片的標籤、別名或網址
+	AuditRestore  = "restore"  // 從回收桶還原圖片
+	AuditRevert   = "revert"   // 將圖片回復成較早的版本
+	AuditClassify = "classify" // 更改圖片的分類
+	AuditCategory = "category" // 分類的變更，實際的動作為以下以 "category." 開頭的動作
+
+	AuditCategoryCreate   = AuditCategory + ".create"   // 建立分類
+	AuditCategoryRename   = AuditCategory + ".rename"   // 重新命名分類
+	AuditCategoryMerge    = AuditCategory + ".merge"    // 合併分類
+	AuditCategoryDelete   = AuditCategory + ".delete"   // 刪除分類
+	AuditCategoryDescribe = AuditCategory + ".describe" // 修改分類的說明
+)
+
+// AuditEntry 是一筆稽核紀錄
+type AuditEntry struct {
+	Time    time.Time  `json:"time"`
+	Action  string     `json:"action"`
+	Actor   string     `json:"actor"`              // 執行操作的使用者ID
+	Guild   string     `json:"guild,omitempty"`    // 執行操作的伺服器，私訊時為空
+	Scope   string     `json:"scope"`              // 被修改的圖庫範圍
+	ImageID string     `json:"image_id,omitempty"` // 圖片的永久ID，分類的變更時為空
+	Before  *ImageData `json:"before,omitempty"`   // 修改前的圖片，新增時為 nil
+	After   *ImageData `json:"after,omitempty"`    // 修改後的圖片，刪除時為 nil
+	Detail  string     `json:"detail,omitempty"`   // 補充說明
+}
+
+// AuditFilter 是查詢稽核紀錄的條件，空白的欄位表示不篩選
+type AuditFilter struct {
+	Scope   string
+	Actor   string
+	Action  string // "category" 會符合所有分類的動作
+	ImageID string
+	Limit   int // 最多返回的筆數，<= 0 表示不限制
+}
+
+// matches 檢查紀錄是否符合條件
+func (f AuditFilter) matches(e AuditEntry) bool {
+	if f.Scope != "" && e.Scope != f.Scope {
+		return false
+	}
+	if f.Actor != "" && e.Actor != f.Actor {
+		return false
+	}
+	if f.Action != "" && e.Action != f.Action && !strings.HasPrefix(e.Action, f.Action+".") {
+		return false
+	}
+	return f.ImageID == "" || e.ImageID == f.ImageID
+}
+
+// AuditLog 是只能附加的稽核紀錄，每筆紀錄為檔案中的一行 JSON
+// 紀錄寫入後不會被修改或刪除
+type AuditLog struct {
+	filePath string
+	mu       sync.Mutex
+	file     *os.File
+}
+
+// OpenAuditLog 開啟（或建立）filePath 作為稽核紀錄
+func OpenAuditLog(filePath string) (*AuditLog, error) {
+	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{filePath: filePath, file: f}, nil
+}
+
+// Append 附加一筆紀錄並確保寫入磁碟
+func (l *AuditLog) Append(e AuditEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(data); err != nil {
+		return err
+	}
+	return l.file.Sync()
+}
+
+// Query 返回符合條件的紀錄，最新的在前
+func (l *AuditLog) Query(filter AuditFilter) ([]AuditEntry, error) {
+	f, err := os.Open(l.filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var matched []AuditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4<<20) // 紀錄包含完整的圖片資料，可能超過預設的行長度
+	for scanner.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue // 寫到一半就中斷的最後一行
+		}
+		if !filter.matches(e) {
+			continue
+		}
+		matched = append(matched, e)
+		if filter.Limit > 0 && len(matched) > filter.Limit {
+			matched = matched[1:] // 只保留最新的 Limit 筆
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for a, b := 0, len(matched)-1; a < b; a, b = a+1, b-1 {
+		matched[a], matched[b] = matched[b], matched[a]
+	}
+	return matched, nil
+}
+
+// Close 關閉檔案
+func (l *AuditLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// markBlobs 將圖片本身與其鏡像使用的檔案加入 inUse
+func (img ImageData) markBlobs(inUse map[string]bool) {
+	if img.Blob != nil {
+		inUse[img.Blob.Hash] = true
+	}
+	if img.Mirror != nil && img.Mirror.Blob != nil {
+		inUse[img.Mirror.Blob.Hash] = true
+	}
+}
+
+// MarkBlobs 將圖庫中的圖片、回收桶與版本紀錄使用的檔案加入 inUse
+func (db *ImageDB) MarkBlobs(inUse map[string]bool) {
+	for _, img := range db.Images {
+		img.markBlobs(inUse)
+	}
+	for _, entry := range db.Trash {
+		entry.Image.markBlobs(inUse)
+	}
+	for _, history := range db.History {
+		for _, rev := range history {
+			rev.Image.markBlobs(inUse)
+		}
+	}
+}
+
+// Sweep 刪除不在 inUse 中、且修改時間早於 cutoff 的檔案，返回刪除的數量
+// 較新的檔案可能剛由 PutImage 保存而還沒寫入圖庫，因此一律保留
+func (b *BlobStore) Sweep(inUse map[string]bool, cutoff time.Time) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dirs, err := os.ReadDir(b.dir)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 {
+			continue // 上傳中的暫存檔
+		}
+		files, err := os.ReadDir(filepath.Join(b.dir, dir.Name()))
+		if err != nil {
+			return removed, err
+		}
+		for _, file := range files {
+			if inUse[file.Name()] {
+				continue
+			}
+			info, err := file.Info()
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return removed, err
+			}
+			if !info.ModTime().Before(cutoff) {
+				continue
+			}
+			if err := os.Remove(filepath.Join(b.dir, dir.Name(), file.Name())); err != nil && !os.IsNotExist(err) {
+				return removed, err
+			}
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// BlobCollector 定期刪除 BlobStore 中沒有任何圖庫或投稿使用的檔案（mark-and-sweep）
+// 退回的投稿、永久刪除的圖片與更換過的鏡像留下的檔案都由此回收
+type BlobCollector struct {
+	registry    *Registry
+	blobs       *BlobStore
+	submissions *SubmissionStore // 可為 nil
+	grace       time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewBlobCollector 建立 BlobCollector，修改時間在 grace 之內的檔案不會被刪除
+func NewBlobCollector(registry *Registry, blobs *BlobStore, submissions *SubmissionStore, grace time.Duration) *BlobCollector {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &BlobCollector{
+		registry:    registry,
+		blobs:       blobs,
+		submissions: submissions,
+		grace:       grace,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Start 啟動背景 goroutine，立即執行一輪之後每隔 interval 執行一次
+func (c *BlobCollector) Start(interval time.Duration) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := c.RunOnce(); err != nil {
+				fmt.Println("回收圖片檔案失敗:", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-c.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop 等待背景 goroutine 結束
+func (c *BlobCollector) Stop() {
+	c.cancel()
+	c.wg.Wait()
+}
+
+// RunOnce 標記所有範圍（包含尚未開啟的圖庫）與投稿使用的檔案，再刪除其餘過了寬限期的檔案
+// 任何一個範圍無法讀取時不會刪除任何檔案
+func (c *BlobCollector) RunOnce() (int, error) {
+	cutoff := time.Now().Add(-c.grace) // 在標記之前決定，標記期間保存的檔案一定比 cutoff 新
+	scopes, err := c.registry.Scopes()
+	if err != nil {
+		return 0, err
+	}
+	inUse := make(map[string]bool)
+	for _, scope := range scopes {
+		err := c.registry.View(scope, func(db *ImageDB) error {
+			db.MarkBlobs(inUse)
+			return nil
+		})
+		if err != nil {
+			return 0, fmt.Errorf("讀取圖庫 %q 失敗: %w", scope, err)
+		}
+	}
+	if c.submissions != nil {
+		c.submissions.MarkBlobs(inUse)
+	}
+
+	n, err := c.blobs.Sweep(inUse, cutoff)
+	if n > 0 {
+		fmt.Printf("已刪除 %d 個沒有使用的圖片檔案\n", n)
+	}
+	return n, err
+}
@@ -0,0 +1,154 @@
+package database
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testPNG 返回以 shade 著色的小 PNG，不同的 shade 內容不同
+func testPNG(t *testing.T, shade uint8) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 4, 4))
+	for i := range img.Pix {
+		img.Pix[i] = shade
+	}
+	img.Set(0, 0, color.Gray{Y: shade + 1})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// putTestBlob 保存 testPNG(shade)，修改時間設為 age 之前
+func putTestBlob(t *testing.T, blobs *BlobStore, shade uint8, age time.Duration) *BlobRef {
+	t.Helper()
+	ref, err := blobs.PutImage(bytes.NewReader(testPNG(t, shade)), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	when := time.Now().Add(-age)
+	if err := os.Chtimes(blobs.path(ref.Hash), when, when); err != nil {
+		t.Fatal(err)
+	}
+	return ref
+}
+
+// newTestRegistry 返回以 dir 中的 JSON 檔案為持久化層的 Registry，會列出目錄中所有的範圍
+func newTestRegistry(t *testing.T, dir string) *Registry {
+	t.Helper()
+	registry := NewRegistry(func(scope string) (Backend, error) {
+		return NewJSONStore(filepath.Join(dir, scope+".json")), nil
+	}, func() ([]string, error) {
+		matches, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		var scopes []string
+		for _, m := range matches {
+			scopes = append(scopes, filepath.Base(m[:len(m)-len(".json")]))
+		}
+		return scopes, err
+	}, nil)
+	t.Cleanup(func() { registry.Close() })
+	return registry
+}
+
+func TestBlobCollector(t *testing.T) {
+	dir := t.TempDir()
+	blobs, err := OpenBlobStore(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const old = 2 * time.Hour
+	opened := putTestBlob(t, blobs, 10, old)
+	closed := putTestBlob(t, blobs, 20, old)
+	trashed := putTestBlob(t, blobs, 30, old)
+	mirrored := putTestBlob(t, blobs, 40, old)
+	submitted := putTestBlob(t, blobs, 50, old)
+	unused := putTestBlob(t, blobs, 60, old)
+	fresh := putTestBlob(t, blobs, 70, 0)
+
+	// 尚未開啟的範圍直接寫入檔案
+	err = SaveDatabase(filepath.Join(dir, "closed.json"), &ImageDB{
+		Images: map[string]ImageData{"b": {ID: "00001", Name: "b", Category: UncategorizedCode, Blob: closed}},
+		Trash:  map[string]TrashedImage{"00002": {Image: ImageData{ID: "00002", Name: "c", Category: UncategorizedCode, Blob: trashed}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := newTestRegistry(t, dir)
+	lib, err := registry.Library("open")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = lib.Transact(func(db *ImageDB) error {
+		db.PutImage(ImageData{ID: "01001", Name: "a", Blob: opened})
+		db.PutImage(ImageData{ID: "01002", Name: "m", URL: "https://example.com/m.png", Mirror: &Mirror{Status: MirrorOK, Blob: mirrored}})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	submissions, err := LoadSubmissions(filepath.Join(dir, "submissions.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := submissions.Put(Submission{ID: "1", Scope: "open", Image: ImageData{Name: "s", Blob: submitted}}); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := NewBlobCollector(registry, blobs, submissions, time.Hour).RunOnce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("刪除了 %d 個檔案，預期 1 個", n)
+	}
+	for _, tt := range []struct {
+		name string
+		ref  *BlobRef
+		kept bool
+	}{
+		{"已開啟的圖庫", opened, true},
+		{"尚未開啟的圖庫", closed, true},
+		{"回收桶", trashed, true},
+		{"鏡像", mirrored, true},
+		{"投稿", submitted, true},
+		{"沒有使用", unused, false},
+		{"寬限期內", fresh, true},
+	} {
+		_, err := os.Stat(blobs.path(tt.ref.Hash))
+		if kept := err == nil; kept != tt.kept {
+			t.Errorf("%s的檔案保留 = %v，預期 %v", tt.name, kept, tt.kept)
+		}
+	}
+	if _, ok := registry.Opened()["closed"]; ok {
+		t.Error("回收檔案時不應開啟尚未使用的圖庫")
+	}
+}
+
+func TestPutImageRefreshesExistingBlob(t *testing.T) {
+	blobs, err := OpenBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := putTestBlob(t, blobs, 10, 2*time.Hour)
+	again, err := blobs.PutImage(bytes.NewReader(testPNG(t, 10)), 1<<20) // 相同內容，修改時間應更新為現在
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Hash != ref.Hash {
+		t.Fatalf("相同內容的雜湊不同：%s、%s", ref.Hash, again.Hash)
+	}
+	n, err := blobs.Sweep(map[string]bool{}, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Error("重新保存的檔案在寬限期內被刪除")
+	}
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrBlobTooLarge 表示檔案超過大小上限
+	ErrBlobTooLarge = errors.New("檔案太大")
+	// ErrUnsupportedType 表示檔案不是支援的圖片格式
+	ErrUnsupportedType = errors.New("不支援的檔案格式")
+)
+
+// imageTypes 是可以存入 BlobStore 的圖片格式與對應的副檔名
+var imageTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// BlobRef 指向 BlobStore 中的檔案，建立後不可修改（快照之間會共用）
+type BlobRef struct {
+	Hash        string `json:"hash"`         // 內容的 SHA-256（十六進位），同時決定檔案位置
+	ContentType string `json:"content_type"` // 依內容判斷的格式，而不是上傳者宣稱的格式
+	Size        int64  `json:"size"`
+}
+
+// FileName 返回傳送檔案時使用的檔名
+func (ref *BlobRef) FileName() string {
+	return ref.Hash[:16] + imageTypes[ref.ContentType]
+}
+
+// BlobStore 以內容的雜湊值為鍵把圖片保存在本機目錄中，相同內容只會保存一份
+// 檔案寫入後不再修改，因此可以同時讀取；不再使用的檔案由 Sweep 回收
+type BlobStore struct {
+	dir string
+	mu  sync.Mutex // 讓 PutImage 與 Sweep 不會同時處理同一個檔案
+}
+
+// OpenBlobStore 開啟（或建立）dir 目錄作為 BlobStore
+func OpenBlobStore(dir string) (*BlobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &BlobStore{dir: dir}, nil
+}
+
+// path 返回雜湊值為 hash 的檔案位置，以前兩個字元分目錄，避免單一目錄中檔案過多
+func (b *BlobStore) path(hash string) string {
+	return filepath.Join(b.dir, hash[:2], hash)
+}
+
+// PutImage 讀取 r 的內容並保存，返回檔案的參照
+// 內容超過 maxSize 位元組時返回 ErrBlobTooLarge，不是支援的圖片格式時返回 ErrUnsupportedType
+func (b *BlobStore) PutImage(r io.Reader, maxSize int64) (*BlobRef, error) {
+	tmp, err := os.CreateTemp(b.dir, "upload-*")
+	if err != nil {
+		return nil, err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // rename 成功後此檔已不存在，Remove 會直接失敗而無影響
+
+	// 多讀一個位元組，才能分辨剛好等於上限與超過上限
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(r, maxSize+1))
+	if err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if size > maxSize {
+		tmp.Close()
+		return nil, fmt.Errorf("%w（上限為 %d KB）", ErrBlobTooLarge, maxSize/1024)
+	}
+
+	// 依檔案開頭判斷格式，不相信上傳者提供的 Content-Type
+	head := make([]byte, 512)
+	n, err := tmp.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		tmp.Close()
+		return nil, err
+	}
+	contentType := http.DetectContentType(head[:n])
+	if _, ok := imageTypes[contentType]; !ok {
+		tmp.Close()
+		return nil, fmt.Errorf("%w：%s", ErrUnsupportedType, contentType)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	ref := &BlobRef{Hash: hex.EncodeToString(hash.Sum(nil)), ContentType: contentType, Size: size}
+	dest := b.path(ref.Hash)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, err := os.Stat(dest); err == nil {
+		// 相同內容已經保存過；更新修改時間，讓 Sweep 在寬限期內不會刪除這個還沒寫入圖庫的參照
+		now := time.Now()
+		if err := os.Chtimes(dest, now, now); err != nil {
+			return nil, err
+		}
+		return ref, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, dest); err != nil {
+		return nil, err
+	}
+	return ref, nil
+}
+
+// Location 返回檔案在 BlobStore 目錄中的相對路徑
+func (b *BlobStore) Location(ref *BlobRef) string {
+	return filepath.ToSlash(filepath.Join(ref.Hash[:2], ref.Hash))
+}
+
+// Open 開啟參照指向的檔案，呼叫者必須關閉返回的檔案
+func (b *BlobStore) Open(ref *BlobRef) (*os.File, error) {
+	return os.Open(b.path(ref.Hash))
+}
@@ -0,0 +1,233 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrCategoryNotFound 表示找不到分類
+	ErrCategoryNotFound = errors.New("找不到分類")
+	// ErrCategoryExists 表示已有同名的分類
+	ErrCategoryExists = errors.New("分類已存在")
+	// ErrCategoryNotEmpty 表示分類中還有圖片，刪除時必須指定圖片要移到哪個分類
+	ErrCategoryNotEmpty = errors.New("分類中還有圖片")
+	// ErrInvalidCategory 表示不允許的分類操作，例如修改未分類或名稱為空白
+	ErrInvalidCategory = errors.New("無法執行此分類操作")
+)
+
+// CategoryInfo 是分類的說明與代表的表情符號，以分類編號為鍵保存，因此改名後仍然保留
+type CategoryInfo struct {
+	Description string `json:"description,omitempty"`
+	Emoji       string `json:"emoji,omitempty"`
+}
+
+// CategoryName 返回分類編號對應的名稱，找不到時返回空字串
+func (db *ImageDB) CategoryName(code string) string {
+	for name, c := range db.Categories {
+		if c == code {
+			return name
+		}
+	}
+	return ""
+}
+
+// categoryCode 返回分類名稱的編號，找不到時返回 ErrCategoryNotFound
+func (db *ImageDB) categoryCode(name string) (string, error) {
+	code, ok := db.Categories[name]
+	if !ok {
+		return "", fmt.Errorf("%w：%q", ErrCategoryNotFound, name)
+	}
+	return code, nil
+}
+
+// checkCategoryName 檢查新的分類名稱是否可以使用
+func (db *ImageDB) checkCategoryName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("%w：分類名稱不可為空白", ErrInvalidCategory)
+	}
+	if name == UncategorizedName {
+		return fmt.Errorf("%w：%q 是保留給未分類的名稱", ErrInvalidCategory, name)
+	}
+	if _, ok := db.Categories[name]; ok {
+		return fmt.Errorf("%w：%q", ErrCategoryExists, name)
+	}
+	return nil
+}
+
+// CreateCategory 建立新的分類並返回分配的編號
+func (db *ImageDB) CreateCategory(name string) (string, error) {
+	db.ensureMaps()
+	if err := db.checkCategoryName(name); err != nil {
+		return "", err
+	}
+	return db.EnsureCategory(name), nil
+}
+
+// ChangedImage 是分類的修改連帶改變的圖片，呼叫者可以據此記錄版本與稽核紀錄
+type ChangedImage struct {
+	Before ImageData
+	After  ImageData
+}
+
+// RenameCategory 將分類 oldName 改名為 newName，編號、圖片ID與說明都不變，圖片上的分類標籤一併改名
+// 返回標籤被改名的圖片
+func (db *ImageDB) RenameCategory(oldName, newName string) ([]ChangedImage, error) {
+	db.ensureMaps()
+	code, err := db.categoryCode(oldName)
+	if err != nil {
+		return nil, err
+	}
+	if oldName == UncategorizedName {
+		return nil, fmt.Errorf("%w：不能修改未分類的名稱", ErrInvalidCategory)
+	}
+	if err := db.checkCategoryName(newName); err != nil {
+		return nil, err
+	}
+
+	var changed []ChangedImage
+	for _, img := range db.ImagesInCategory(code) {
+		if img.HasTag(oldName) {
+			after := img.WithoutTags(oldName).WithTags(newName)
+			db.ReplaceImage(img.ID, after)
+			changed = append(changed, ChangedImage{Before: img, After: after})
+		}
+	}
+	delete(db.Categories, oldName)
+	db.Categories[newName] = code
+	return changed, nil
+}
+
+// moveImages 將分類編號 code 中的所有圖片移到分類 target，返回移動的圖片
+func (db *ImageDB) moveImages(code, target string) []ChangedImage {
+	images := db.ImagesInCategory(code)
+	moved := make([]ChangedImage, 0, len(images))
+	for _, img := range images {
+		after, _ := db.Reclassify(img.ID, target)
+		moved = append(moved, ChangedImage{Before: img, After: after})
+	}
+	return moved
+}
+
+// removeCategory 刪除分類名稱與其說明
+func (db *ImageDB) removeCategory(name, code string) {
+	delete(db.Categories, name)
+	delete(db.CategoryInfo, code)
+}
+
+// MergeCategories 將分類 source 的圖片全部移到 target 並刪除 source，返回移動的圖片
+// 圖片的永久ID不變，舊的顯示代碼會轉址到圖片
+func (db *ImageDB) MergeCategories(source, target string) ([]ChangedImage, error) {
+	db.ensureMaps()
+	code, err := db.categoryCode(source)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.categoryCode(target); err != nil {
+		return nil, err
+	}
+	if source == target {
+		return nil, fmt.Errorf("%w：不能將分類合併到自己", ErrInvalidCategory)
+	}
+	if source == UncategorizedName {
+		return nil, fmt.Errorf("%w：不能合併未分類", ErrInvalidCategory)
+	}
+
+	moved := db.moveImages(code, target)
+	db.removeCategory(source, code)
+	return moved, nil
+}
+
+// DeleteCategory 刪除分類，返回移動的圖片
+// 分類中還有圖片時必須以 reassign 指定圖片要移到的分類（可以是 UncategorizedName），否則返回 ErrCategoryNotEmpty
+func (db *ImageDB) DeleteCategory(name, reassign string) ([]ChangedImage, error) {
+	db.ensureMaps()
+	code, err := db.categoryCode(name)
+	if err != nil {
+		return nil, err
+	}
+	if name == UncategorizedName {
+		return nil, fmt.Errorf("%w：不能刪除未分類", ErrInvalidCategory)
+	}
+	if reassign == name {
+		return nil, fmt.Errorf("%w：不能將圖片移到要刪除的分類", ErrInvalidCategory)
+	}
+
+	var moved []ChangedImage
+	if n := len(db.ImagesInCategory(code)); n > 0 {
+		if reassign == "" {
+			return nil, fmt.Errorf("%w（%d 張），請指定要移到的分類", ErrCategoryNotEmpty, n)
+		}
+		if _, ok := db.Categories[reassign]; !ok && reassign != UncategorizedName {
+			return nil, fmt.Errorf("%w：%q", ErrCategoryNotFound, reassign)
+		}
+		moved = db.moveImages(code, reassign)
+	}
+	db.removeCategory(name, code)
+	return moved, nil
+}
+
+// SetCategoryInfo 設定分類的說明與表情符號，兩者皆為空時移除說明
+func (db *ImageDB) SetCategoryInfo(name string, info CategoryInfo) error {
+	db.ensureMaps()
+	code, err := db.categoryCode(name)
+	if err != nil {
+		return err
+	}
+	if info == (CategoryInfo{}) {
+		delete(db.CategoryInfo, code)
+	} else {
+		db.CategoryInfo[code] = info
+	}
+	return nil
+}
+
+// CategoryNames 返回依編號排序的分類名稱
+func (db *ImageDB) CategoryNames() []string {
+	names := make([]string, 0, len(db.Categories))
+	for name := range db.Categories {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return CompareCodes(db.Categories[names[i]], db.Categories[names[j]]) < 0
+	})
+	return names
+}
+
+// CompareCodes 依數值比較兩個分類編號（編號可能超過兩位數，不能直接比較字串）
+func CompareCodes(a, b string) int {
+	if len(a) != len(b) {
+		return len(a) - len(b)
+	}
+	return strings.Compare(a, b)
+}
+
+// Reclassify 將ID為 id 的圖片移到分類 category（不存在時建立），返回更新後的圖片
+// 永久ID維持不變，只重新分配顯示代碼，舊的代碼會轉址到此圖片；分類名稱的標籤也一併替換
+func (db *ImageDB) Reclassify(id, category string) (ImageData, bool) {
+	img, ok := db.ImageByID(id)
+	if !ok {
+		return ImageData{}, false
+	}
+	code := db.EnsureCategory(category)
+	if code == img.Category {
+		return img, true
+	}
+
+	if old := db.CategoryName(img.Category); old != "" && img.Category != UncategorizedCode {
+		img = img.WithoutTags(old)
+	}
+	if category != UncategorizedName {
+		img = img.WithTags(category)
+	}
+
+	if img.Code != "" && img.Code != img.ID {
+		db.Redirects[img.Code] = img.ID
+	}
+	img.Code = db.AllocateID(code)
+	img.Category = code
+	db.ReplaceImage(id, img)
+	return img, true
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// similarThreshold 是視為同一張圖片的感知雜湊最大差異位元數（共 64 位元）
+const similarThreshold = 6
+
+// 重複的原因，依可信程度由高到低排列
+const (
+	DuplicateURL     = "網址相同"
+	DuplicateContent = "檔案內容相同"
+	DuplicateSimilar = "外觀相似"
+)
+
+// Duplicate 是與新圖片重複的既有圖片
+type Duplicate struct {
+	Image    ImageData
+	Reason   string // DuplicateURL、DuplicateContent 或 DuplicateSimilar
+	Distance int    // 感知雜湊的差異位元數，僅 DuplicateSimilar 使用
+}
+
+// 追蹤用的查詢參數，比較網址時忽略
+var trackingParams = map[string]bool{
+	"fbclid": true,
+	"gclid":  true,
+	// Discord CDN 的附件網址帶有會過期的簽章
+	"ex": true,
+	"is": true,
+	"hm": true,
+}
+
+// NormalizeURL 將網址轉為比較用的形式：
+// 協定與主機名稱轉為小寫、移除預設連接埠、片段與追蹤參數，查詢參數依名稱排序
+// 無法解析的網址只去除前後空白
+func NormalizeURL(raw string) string {
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return raw
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme == "http" {
+		u.Scheme = "https" // 同一個網址常以兩種協定分享
+	}
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+	if host == "media.discordapp.net" { // Discord 附件的兩個網域指向相同的檔案
+		host = "cdn.discordapp.com"
+	}
+	u.Host = host
+	u.Fragment = ""
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	query := u.Query()
+	for key := range query {
+		if trackingParams[key] || strings.HasPrefix(key, "utm_") {
+			query.Del(key)
+		}
+	}
+	u.RawQuery = query.Encode() // Encode 會依名稱排序
+	return u.String()
+}
+
+// contentHash 返回圖片檔案內容的雜湊（見 LocalBlob），沒有本機檔案時返回空字串
+func (img ImageData) contentHash() string {
+	if ref := img.LocalBlob(); ref != nil {
+		return ref.Hash
+	}
+	return ""
+}
+
+// FindDuplicates 返回與 img 重複的既有圖片，依可信程度與ID排序，每張圖片只列出最可信的原因
+// 比較網址、檔案內容的雜湊與感知雜湊（img.PHash 為 0 時不比較外觀）
+func (db *ImageDB) FindDuplicates(img ImageData) []Duplicate {
+	normalized := ""
+	if img.URL != "" {
+		normalized = NormalizeURL(img.URL)
+	}
+	hash := img.contentHash()
+
+	var dups []Duplicate
+	for _, existing := range db.AllImages() {
+		switch {
+		case normalized != "" && existing.URL != "" && NormalizeURL(existing.URL) == normalized:
+			dups = append(dups, Duplicate{Image: existing, Reason: DuplicateURL})
+		case hash != "" && existing.contentHash() == hash:
+			dups = append(dups, Duplicate{Image: existing, Reason: DuplicateContent})
+		case img.PHash != 0 && existing.PHash != 0:
+			if d := HammingDistance(img.PHash, existing.PHash); d <= similarThreshold {
+				dups = append(dups, Duplicate{Image: existing, Reason: DuplicateSimilar, Distance: d})
+			}
+		}
+	}
+
+	rank := map[string]int{DuplicateURL: 0, DuplicateContent: 1, DuplicateSimilar: 2}
+	sort.SliceStable(dups, func(i, j int) bool {
+		if rank[dups[i].Reason] != rank[dups[j].Reason] {
+			return rank[dups[i].Reason] < rank[dups[j].Reason]
+		}
+		return dups[i].Distance < dups[j].Distance
+	})
+	return dups
+}
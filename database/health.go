@@ -0,0 +1,219 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 網址檢查的結果
+const (
+	LinkOK     = "ok"     // 網址可以取得圖片
+	LinkBroken = "broken" // 網址無法連線、回應錯誤或不是圖片
+)
+
+// LinkHealth 記錄圖片網址最近一次的檢查結果，建立後不可修改（快照之間會共用）
+type LinkHealth struct {
+	URL         string    `json:"url"`                    // 檢查時的網址，圖片網址改變後會重新檢查
+	Status      string    `json:"status"`                 // LinkOK 或 LinkBroken
+	HTTPStatus  int       `json:"http_status,omitempty"`  // 伺服器回應的狀態碼，無法連線時為 0
+	ContentType string    `json:"content_type,omitempty"` // 伺服器回應的內容格式
+	Error       string    `json:"error,omitempty"`        // 失效的原因
+	CheckedAt   time.Time `json:"checked_at"`             // 檢查的時間
+}
+
+// Broken 返回網址在最近一次檢查時是否已失效
+func (h *LinkHealth) Broken() bool {
+	return h != nil && h.Status == LinkBroken
+}
+
+// BrokenImages 返回網址已失效的圖片，依ID排序
+func (db *ImageDB) BrokenImages() []ImageData {
+	var broken []ImageData
+	for _, img := range db.AllImages() {
+		if img.URL != "" && img.Health.Broken() && img.Health.URL == img.URL {
+			broken = append(broken, img)
+		}
+	}
+	return broken
+}
+
+// LinkChecker 定期確認圖庫中的圖片網址是否仍然有效，並把結果記錄在 ImageData.Health
+// 與 Mirrorer 相同，只處理 Registry 中已開啟的圖庫：檢查需要對外連線，不值得為沒有使用的伺服器執行，
+// 尚未開啟的圖庫在開啟後的下一輪就會被檢查（/health 會開啟圖庫，因此看到的結果不會漏掉）
+type LinkChecker struct {
+	registry    *Registry
+	client      *http.Client
+	interval    time.Duration
+	concurrency int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewLinkChecker 建立 LinkChecker，每張圖片每隔 interval 檢查一次，同時最多發出 concurrency 個請求
+// client 可以替換成測試用的客戶端，nil 表示使用逾時 15 秒、只能連線到公開位址的客戶端
+func NewLinkChecker(registry *Registry, client *http.Client, interval time.Duration, concurrency int) *LinkChecker {
+	if client == nil {
+		client = NewPublicClient(15 * time.Second)
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &LinkChecker{
+		registry:    registry,
+		client:      client,
+		interval:    interval,
+		concurrency: concurrency,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Start 啟動背景 goroutine，定期檢查到期的網址
+// 每輪只檢查距離上次檢查超過 interval 的圖片，因此以較短的間隔執行讓新圖片能盡快被檢查
+func (c *LinkChecker) Start() {
+	tick := c.interval / 10
+	if tick < time.Minute {
+		tick = time.Minute
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		for {
+			c.RunOnce()
+			select {
+			case <-ticker.C:
+			case <-c.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop 中斷進行中的檢查並等待背景 goroutine 結束
+func (c *LinkChecker) Stop() {
+	c.cancel()
+	c.wg.Wait()
+}
+
+// NeedsCheck 返回圖片的網址是否從未檢查、上次檢查的是其他網址或結果已過期
+func (c *LinkChecker) NeedsCheck(img ImageData, now time.Time) bool {
+	if img.URL == "" {
+		return false
+	}
+	h := img.Health
+	return h == nil || h.URL != img.URL || now.Sub(h.CheckedAt) >= c.interval
+}
+
+// RunOnce 檢查所有已開啟圖庫中到期的網址，並把結果寫回各自的圖庫（尚未開啟的圖庫不會被開啟）
+func (c *LinkChecker) RunOnce() {
+	type job struct {
+		scope string
+		img   ImageData
+	}
+	libs := c.registry.Opened()
+	now := time.Now()
+	var jobs []job
+	for scope, lib := range libs {
+		for _, img := range lib.Snapshot().AllImages() {
+			if c.NeedsCheck(img, now) {
+				jobs = append(jobs, job{scope, img})
+			}
+		}
+	}
+	if len(jobs) == 0 {
+		return
+	}
+
+	var mu sync.Mutex
+	results := make(map[string]map[string]*LinkHealth) // 範圍 → 圖片ID → 檢查結果
+	sem := make(chan struct{}, c.concurrency)
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		if c.ctx.Err() != nil {
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(j job) {
+			defer func() { <-sem; wg.Done() }()
+			health := c.Check(j.img.URL)
+			if c.ctx.Err() != nil {
+				return // 正在關閉，不記錄被中斷的檢查
+			}
+			mu.Lock()
+			if results[j.scope] == nil {
+				results[j.scope] = make(map[string]*LinkHealth)
+			}
+			results[j.scope][j.img.ID] = health
+			mu.Unlock()
+		}(j)
+	}
+	wg.Wait()
+
+	for scope, healths := range results {
+		err := libs[scope].Transact(func(db *ImageDB) error {
+			for id, health := range healths {
+				img, ok := db.ImageByID(id)
+				if !ok || img.URL != health.URL {
+					continue // 檢查期間圖片已被刪除或修改網址
+				}
+				img.Health = health
+				db.ReplaceImage(id, img)
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, ErrClosed) {
+			fmt.Printf("保存圖庫 %q 的網址檢查結果失敗: %v\n", scope, err)
+		}
+	}
+}
+
+// Check 檢查單一網址，先以 HEAD 請求，伺服器不支援 HEAD 時改用 GET
+func (c *LinkChecker) Check(url string) *LinkHealth {
+	health := &LinkHealth{URL: url, Status: LinkBroken, CheckedAt: time.Now()}
+
+	resp, err := c.request(http.MethodHead, url)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp, err = c.request(http.MethodGet, url)
+	}
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+
+	health.HTTPStatus = resp.StatusCode
+	health.ContentType = resp.Header.Get("Content-Type")
+	switch {
+	case resp.StatusCode >= 400:
+		health.Error = fmt.Sprintf("伺服器回應 %s", resp.Status)
+	case !strings.HasPrefix(health.ContentType, "image/"):
+		health.Error = fmt.Sprintf("內容不是圖片（%s）", health.ContentType)
+	default:
+		health.Status = LinkOK
+	}
+	return health
+}
+
+// request 發出請求並立即關閉回應內容，只保留狀態碼與標頭
+func (c *LinkChecker) request(method, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(c.ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newHealthServer 返回測試用的伺服器，依路徑回應不同的結果
+func newHealthServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+	})
+	mux.HandleFunc("/missing.png", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/page.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	})
+	mux.HandleFunc("/no-head.gif", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "image/gif")
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestLinkCheckerCheck(t *testing.T) {
+	srv := newHealthServer(t)
+	checker := NewLinkChecker(nil, srv.Client(), time.Hour, 1)
+
+	tests := []struct {
+		path        string
+		status      string
+		httpStatus  int
+		contentType string
+	}{
+		{"/ok.png", LinkOK, http.StatusOK, "image/png"},
+		{"/missing.png", LinkBroken, http.StatusNotFound, "text/plain; charset=utf-8"},
+		{"/page.html", LinkBroken, http.StatusOK, "text/html; charset=utf-8"},
+		{"/no-head.gif", LinkOK, http.StatusOK, "image/gif"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			url := srv.URL + tt.path
+			h := checker.Check(url)
+			if h.URL != url || h.Status != tt.status || h.HTTPStatus != tt.httpStatus || h.ContentType != tt.contentType {
+				t.Errorf("Check(%q) = %+v，預期狀態 %s、HTTP %d、格式 %q", tt.path, h, tt.status, tt.httpStatus, tt.contentType)
+			}
+			if (h.Status == LinkBroken) != (h.Error != "") {
+				t.Errorf("Check(%q) 的錯誤訊息 %q 與狀態 %s 不一致", tt.path, h.Error, h.Status)
+			}
+		})
+	}
+}
+
+func TestLinkCheckerRunOnce(t *testing.T) {
+	srv := newHealthServer(t)
+	dir := t.TempDir() // 必須在 registry.Close 之前建立，清理時才會先關閉圖庫再刪除目錄
+	registry := NewRegistry(func(scope string) (Backend, error) {
+		return NewJSONStore(filepath.Join(dir, scope+".json")), nil
+	}, nil, nil)
+	t.Cleanup(func() { registry.Close() })
+
+	lib, err := registry.Library(GlobalScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = lib.Transact(func(db *ImageDB) error {
+		db.PutImage(ImageData{ID: "01001", Name: "ok", URL: srv.URL + "/ok.png"})
+		db.PutImage(ImageData{ID: "01002", Name: "missing", URL: srv.URL + "/missing.png"})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	NewLinkChecker(registry, srv.Client(), time.Hour, 2).RunOnce()
+
+	tests := []struct {
+		id          string
+		status      string
+		contentType string
+	}{
+		{"01001", LinkOK, "image/png"},
+		{"01002", LinkBroken, "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		img, err := lib.GetByID(tt.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := img.Health
+		if h == nil {
+			t.Fatalf("圖片 %s 沒有寫入檢查結果", tt.id)
+		}
+		if h.Status != tt.status || h.ContentType != tt.contentType || h.URL != img.URL {
+			t.Errorf("圖片 %s 的檢查結果 = %+v，預期狀態 %s、格式 %q", tt.id, h, tt.status, tt.contentType)
+		}
+		if h.CheckedAt.Before(start) {
+			t.Errorf("圖片 %s 的檢查時間 %v 早於開始檢查的時間 %v", tt.id, h.CheckedAt, start)
+		}
+	}
+}
+
+// 尚未開啟的圖庫不會被檢查，也不會因此開啟
+func TestLinkCheckerSkipsClosedScopes(t *testing.T) {
+	srv := newHealthServer(t)
+	dir := t.TempDir()
+	err := SaveDatabase(filepath.Join(dir, "closed.json"), &ImageDB{
+		Images: map[string]ImageData{"ok": {ID: "00001", Name: "ok", Category: UncategorizedCode, URL: srv.URL + "/ok.png"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := newTestRegistry(t, dir)
+
+	NewLinkChecker(registry, srv.Client(), time.Hour, 1).RunOnce()
+	if _, ok := registry.Opened()["closed"]; ok {
+		t.Fatal("檢查網址時不應開啟尚未使用的圖庫")
+	}
+	err = registry.View("closed", func(db *ImageDB) error {
+		if img, _ := db.ImageByID("00001"); img.Health != nil {
+			t.Error("尚未開啟的圖庫被檢查")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// ErrRevisionNotFound 表示圖片沒有此版本
+var ErrRevisionNotFound = errors.New("找不到此版本")
+
+// maxRevisions 是每張圖片保留的版本數量上限，超過時捨棄最舊的版本
+const maxRevisions = 100
+
+// Revision 是圖片的一個版本，記錄修改後的完整內容
+type Revision struct {
+	Number int       `json:"number"`          // 版本編號，從 1 開始遞增，捨棄舊版本後也不會重複
+	Time   time.Time `json:"time"`            // 修改的時間，開始記錄之前的版本為零值
+	Actor  string    `json:"actor,omitempty"` // 修改者的 Discord 使用者ID，開始記錄之前的版本為空
+	Action string    `json:"action"`          // 與稽核紀錄相同的動作，開始記錄之前的版本為空
+	Image  ImageData `json:"image"`
+}
+
+// RecordRevision 在圖片的版本紀錄中加入修改後的內容 after
+// 圖片還沒有任何版本時，會先以 before（可為 nil）作為開始記錄之前的版本，讓第一次修改也可以回復
+// 內容與最新的版本相同時不會加入新的版本
+func (db *ImageDB) RecordRevision(before *ImageData, after ImageData, actor, action string, now time.Time) {
+	history := db.History[after.ID]
+	if len(history) == 0 && before != nil && before.ID == after.ID {
+		history = []Revision{{Number: 1, Image: *before}}
+	}
+	if len(history) > 0 && sameContent(history[len(history)-1].Image, after) {
+		return
+	}
+
+	number := 1
+	if len(history) > 0 {
+		number = history[len(history)-1].Number + 1
+	}
+	if len(history) >= maxRevisions {
+		history = history[len(history)-maxRevisions+1:]
+	}
+	// 與 Tags 相同，建立新的切片而不原地修改，因為快照之間會共用
+	next := make([]Revision, 0, len(history)+1)
+	next = append(next, history...)
+	db.History[after.ID] = append(next, Revision{Number: number, Time: now, Actor: actor, Action: action, Image: after})
+}
+
+// sameContent 比較使用者可以修改的欄位，背景更新的鏡像與檢查結果不算是新的版本
+func sameContent(a, b ImageData) bool {
+	return a.Name == b.Name && a.URL == b.URL && a.Category == b.Category &&
+		reflect.DeepEqual(a.Tags, b.Tags) && reflect.DeepEqual(a.Aliases, b.Aliases) &&
+		reflect.DeepEqual(a.Blob, b.Blob)
+}
+
+// Revisions 返回圖片的所有版本，最舊的在前
+func (db *ImageDB) Revisions(id string) []Revision {
+	return db.History[id]
+}
+
+// RevertImage 將ID為 id 的圖片的名稱、網址、檔案、分類、標籤與別名回復成第 number 版，返回回復後的圖片
+// 永久ID不變；分類不同時與 Reclassify 相同會重新分配顯示代碼，該分類已刪除時改為未分類
+// 名稱或別名已被其他圖片使用時返回 ErrNameTaken
+func (db *ImageDB) RevertImage(id string, number int) (ImageData, error) {
+	img, ok := db.ImageByID(id)
+	if !ok {
+		return ImageData{}, ErrNotFound
+	}
+	var target *ImageData
+	for _, rev := range db.History[id] {
+		if rev.Number == number {
+			target = &rev.Image
+			break
+		}
+	}
+	if target == nil {
+		return ImageData{}, fmt.Errorf("%w：第 %d 版", ErrRevisionNotFound, number)
+	}
+	if err := db.CheckNames(*target, id); err != nil {
+		return ImageData{}, err
+	}
+
+	if img.URL != target.URL || !reflect.DeepEqual(img.Blob, target.Blob) {
+		// 鏡像與圖片資訊跟著圖片來源回復；當時的檢查結果可能已經過時，清除後由 LinkChecker 重新檢查
+		img.Mirror, img.Meta, img.PHash, img.Health = target.Mirror, target.Meta, target.PHash, nil
+	}
+	img.Name, img.URL, img.Blob = target.Name, target.URL, target.Blob
+	img.Tags, img.Aliases = target.Tags, target.Aliases
+	db.ReplaceImage(id, img)
+
+	category := UncategorizedName
+	if name := db.CategoryName(target.Category); name != "" {
+		category = name
+	}
+	img, _ = db.Reclassify(id, category)
+	return img, nil
+}
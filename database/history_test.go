@@ -0,0 +1,154 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newHistoryDB 返回有一張圖片與兩個版本的圖庫：
+// 第 1 版為分類 Cats 的 "Tabby"，第 2 版改名為 "Tiger"、換了網址與標籤並移到分類 Dogs
+func newHistoryDB(t *testing.T) (*ImageDB, string) {
+	t.Helper()
+	db := &ImageDB{}
+	db.ensureMaps()
+	cats, _ := db.CreateCategory("Cats")
+	if _, err := db.CreateCategory("Dogs"); err != nil {
+		t.Fatal(err)
+	}
+	id := db.AllocateID(cats)
+	original := ImageData{
+		ID: id, Code: id, Name: "Tabby", Category: cats, URL: "https://example.com/tabby.png",
+		Tags: []string{"cats"}, Aliases: []string{"stripes"},
+		Mirror: &Mirror{URL: "https://example.com/tabby.png", Status: MirrorOK},
+	}
+	if err := db.AddImage(original); err != nil {
+		t.Fatal(err)
+	}
+	db.RecordRevision(nil, original, "alice", AuditAdd, time.Unix(1, 0))
+
+	changed := original
+	changed.Name, changed.URL, changed.Aliases = "Tiger", "https://example.com/tiger.png", nil
+	changed.Mirror = nil
+	changed.Health = &LinkHealth{URL: changed.URL, Status: LinkOK}
+	db.ReplaceImage(id, changed)
+	changed, _ = db.Reclassify(id, "Dogs")
+	db.RecordRevision(&original, changed, "bob", AuditUpdate, time.Unix(2, 0))
+	return db, id
+}
+
+func TestRecordRevision(t *testing.T) {
+	db, id := newHistoryDB(t)
+	revisions := db.Revisions(id)
+	if len(revisions) != 2 || revisions[0].Number != 1 || revisions[1].Number != 2 || revisions[1].Actor != "bob" {
+		t.Fatalf("版本紀錄為 %+v", revisions)
+	}
+
+	// 只有背景更新的欄位改變時不算是新的版本
+	img, _ := db.ImageByID(id)
+	img.Health = &LinkHealth{URL: img.URL, Status: LinkBroken}
+	db.RecordRevision(nil, img, "checker", AuditUpdate, time.Unix(3, 0))
+	if n := len(db.Revisions(id)); n != 2 {
+		t.Errorf("有 %d 個版本，預期 2", n)
+	}
+
+	// 超過上限時捨棄最舊的版本，版本編號不會重複
+	for n := 0; n < maxRevisions; n++ {
+		img.Tags = []string{string(rune('a' + n%26)), string(rune('a' + n/26))}
+		db.RecordRevision(nil, img, "carol", AuditUpdate, time.Unix(int64(4+n), 0))
+	}
+	revisions = db.Revisions(id)
+	if len(revisions) != maxRevisions || revisions[0].Number != 3 || revisions[len(revisions)-1].Number != maxRevisions+2 {
+		t.Errorf("有 %d 個版本，編號 %d 到 %d", len(revisions), revisions[0].Number, revisions[len(revisions)-1].Number)
+	}
+}
+
+func TestRevertImage(t *testing.T) {
+	tests := []struct {
+		name     string
+		prepare  func(t *testing.T, db *ImageDB)
+		id       string // 空字串表示使用圖庫中的圖片
+		number   int
+		wantErr  error
+		wantName string
+		wantCat  string
+	}{
+		{name: "回復第一版", number: 1, wantName: "Tabby", wantCat: "Cats"},
+		{name: "回復最新版", number: 2, wantName: "Tiger", wantCat: "Dogs"},
+		{
+			name: "分類已刪除",
+			prepare: func(t *testing.T, db *ImageDB) {
+				if _, err := db.DeleteCategory("Cats", ""); err != nil {
+					t.Fatal(err)
+				}
+			},
+			number: 1, wantName: "Tabby", wantCat: UncategorizedName,
+		},
+		{
+			name: "名稱已被使用",
+			prepare: func(t *testing.T, db *ImageDB) {
+				other := db.AllocateID(UncategorizedCode)
+				db.PutImage(ImageData{ID: other, Code: other, Name: "Other", Category: UncategorizedCode, Aliases: []string{"STRIPES"}})
+			},
+			number: 1, wantErr: ErrNameTaken,
+		},
+		{name: "版本不存在", number: 5, wantErr: ErrRevisionNotFound},
+		{name: "圖片不存在", id: "09999", number: 1, wantErr: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, id := newHistoryDB(t)
+			if tt.prepare != nil {
+				tt.prepare(t, db)
+			}
+			if tt.id != "" {
+				id = tt.id
+			}
+			before, _ := db.ImageByID(id)
+			img, err := db.RevertImage(id, tt.number)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("RevertImage() 的錯誤 = %v，預期 %v", err, tt.wantErr)
+				}
+				if after, _ := db.ImageByID(id); !reflect.DeepEqual(after, before) {
+					t.Errorf("失敗時圖片被修改：%+v", after)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.ID != id || img.Name != tt.wantName || db.CategoryName(img.Category) != tt.wantCat {
+				t.Errorf("RevertImage() = %s %q（分類 %q），預期 %s %q（分類 %q）", img.ID, img.Name, db.CategoryName(img.Category), id, tt.wantName, tt.wantCat)
+			}
+			if got, ok := db.ImageByName(tt.wantName); !ok || got.ID != id {
+				t.Errorf("ImageByName(%q) = %+v, %v", tt.wantName, got, ok)
+			}
+			// 顯示代碼屬於目前的分類，舊的代碼轉址到圖片
+			if code, _, _ := ParseID(img.Code); code != img.Category {
+				t.Errorf("顯示代碼 %s 不屬於分類 %s", img.Code, img.Category)
+			}
+			if before.Code != img.Code {
+				if resolved, ok := db.ResolveID(before.Code); !ok || resolved.ID != id {
+					t.Errorf("舊的代碼 %s 沒有轉址到圖片", before.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestRevertImageRestoresSource(t *testing.T) {
+	db, id := newHistoryDB(t)
+	img, err := db.RevertImage(id, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 網址改變時鏡像跟著回復，舊的檢查結果清除
+	if img.URL != "https://example.com/tabby.png" || img.Mirror == nil || img.Mirror.URL != img.URL || img.Health != nil {
+		t.Errorf("網址 %s、鏡像 %+v、檢查結果 %+v", img.URL, img.Mirror, img.Health)
+	}
+	if !reflect.DeepEqual(img.Tags, []string{"cats"}) || !reflect.DeepEqual(img.Aliases, []string{"stripes"}) {
+		t.Errorf("標籤 %v、別名 %v", img.Tags, img.Aliases)
+	}
+}
@@ -0,0 +1,223 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// UncategorizedName 是未分類在 Categories 中的名稱
+	UncategorizedName = "NULL"
+	// UncategorizedCode 是未分類圖片的分類編號
+	UncategorizedCode = "00"
+)
+
+// categorySequence 是分類編號的序號名稱，圖片序號則以 imageSequence 依分類分開計算
+const categorySequence = "category"
+
+func imageSequence(code string) string {
+	return "image:" + code
+}
+
+// formatCategoryCode 將分類序號格式化為至少兩位數的分類編號，超過 99 時自動加寬
+func formatCategoryCode(n int) string {
+	return fmt.Sprintf("%02d", n)
+}
+
+// parseCategoryCode 解析分類編號，只接受 formatCategoryCode 產生的格式
+func parseCategoryCode(code string) (int, bool) {
+	n, err := strconv.Atoi(code)
+	if err != nil || n < 0 || formatCategoryCode(n) != code {
+		return 0, false
+	}
+	return n, true
+}
+
+// FormatID 由分類編號與分類內的序號組成圖片ID
+// 分類編號為兩位數且序號不超過三位數時沿用原本的格式（例如 02007），
+// 否則以 "-" 分隔（例如 100-001、02-1000），兩種格式不會產生相同的ID
+func FormatID(code string, n int) string {
+	if len(code) == 2 && n < 1000 {
+		return fmt.Sprintf("%s%03d", code, n)
+	}
+	return fmt.Sprintf("%s-%03d", code, n)
+}
+
+// ParseID 解析 FormatID 產生的圖片ID，返回分類編號與序號
+func ParseID(id string) (code string, n int, ok bool) {
+	var number string
+	if c, num, found := strings.Cut(id, "-"); found {
+		code, number = c, num
+	} else if len(id) == 5 {
+		code, number = id[:2], id[2:]
+	} else {
+		return "", 0, false
+	}
+	if _, ok := parseCategoryCode(code); !ok {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 1 || FormatID(code, n) != id {
+		return "", 0, false
+	}
+	return code, n, true
+}
+
+// nextSequence 從序號 name 目前的值往後找出第一個 format 結果未被使用的序號，並更新序號
+// 序號只會遞增，因此刪除的分類編號或圖片ID不會再被分配
+func (db *ImageDB) nextSequence(name string, format func(n int) string, taken func(s string) bool) string {
+	if db.Sequences == nil {
+		db.Sequences = make(map[string]int)
+	}
+	n := db.Sequences[name]
+	for {
+		n++
+		if s := format(n); !taken(s) {
+			db.Sequences[name] = n
+			return s
+		}
+	}
+}
+
+// EnsureCategory 返回分類名稱的編號，分類不存在時分配新的編號
+// 未分類（UncategorizedName）固定使用 UncategorizedCode
+func (db *ImageDB) EnsureCategory(name string) string {
+	db.ensureMaps()
+	if code, ok := db.Categories[name]; ok {
+		return code
+	}
+	code := UncategorizedCode
+	if name != UncategorizedName {
+		used := make(map[string]bool, len(db.Categories))
+		for _, c := range db.Categories {
+			used[c] = true
+		}
+		code = db.nextSequence(categorySequence, formatCategoryCode, func(c string) bool {
+			return used[c] || c == UncategorizedCode
+		})
+	}
+	db.Categories[name] = code
+	return code
+}
+
+// AllocateID 為分類編號 code 分配一個從未使用過的圖片ID
+// 新圖片的永久ID與顯示代碼，以及換分類後的顯示代碼都由此分配，因此三者不會互相重複
+func (db *ImageDB) AllocateID(code string) string {
+	db.ensureMaps()
+	return db.nextSequence(imageSequence(code), func(n int) string { return FormatID(code, n) }, func(id string) bool {
+		_, isID := db.byID[id]
+		_, isCode := db.byCode[id]
+		_, isRedirect := db.Redirects[id]
+		return isID || isCode || isRedirect
+	})
+}
+
+// repairIDs 檢查分類編號與圖片ID，修正格式錯誤、重複或與分類不符的部分，並初始化序號
+// 必須在建立索引之前呼叫；返回被更改的圖片ID（舊 → 新）
+func repairIDs(db *ImageDB) map[string]string {
+	if db.Images == nil {
+		db.Images = make(map[string]ImageData)
+	}
+	if db.Categories == nil {
+		db.Categories = make(map[string]string)
+	}
+	if db.Sequences == nil {
+		db.Sequences = make(map[string]int)
+	}
+
+	// 序號從目前最大的有效編號開始，新分配的編號才不會與既有的重複
+	for _, code := range db.Categories {
+		if n, ok := parseCategoryCode(code); ok && n > db.Sequences[categorySequence] {
+			db.Sequences[categorySequence] = n
+		}
+	}
+
+	// 未分類優先，其餘依名稱排序，編號重複時由先處理的分類保留
+	names := make([]string, 0, len(db.Categories))
+	for name := range db.Categories {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == UncategorizedName) != (names[j] == UncategorizedName) {
+			return names[i] == UncategorizedName
+		}
+		return names[i] < names[j]
+	})
+
+	owner := make(map[string]string, len(names)) // 分類編號 → 分類名稱
+	remap := make(map[string]string)             // 格式錯誤的分類編號 → 新編號
+	for _, name := range names {
+		code := db.Categories[name]
+		_, valid := parseCategoryCode(code)
+		if name == UncategorizedName {
+			valid = code == UncategorizedCode
+		} else if code == UncategorizedCode {
+			valid = false
+		}
+		if valid && owner[code] == "" {
+			owner[code] = name
+			continue
+		}
+
+		newCode := db.nextSequence(categorySequence, formatCategoryCode, func(c string) bool {
+			return owner[c] != "" || c == UncategorizedCode
+		})
+		if name == UncategorizedName {
+			newCode = UncategorizedCode
+		}
+		fmt.Printf("修正分類 %q 的編號：%s → %s\n", name, code, newCode)
+		// 編號重複時無法分辨圖片原本屬於哪個分類，圖片留在保留編號的分類；只有格式錯誤時才一併移動圖片
+		if owner[code] == "" {
+			remap[code] = newCode
+		}
+		owner[newCode] = name
+		db.Categories[name] = newCode
+	}
+
+	keys := make([]string, 0, len(db.Images))
+	used := make(map[string]bool, len(db.Images))
+	for key, img := range db.Images {
+		keys = append(keys, key)
+		used[img.ID] = true
+		if code, n, ok := ParseID(img.ID); ok && n > db.Sequences[imageSequence(code)] {
+			db.Sequences[imageSequence(code)] = n
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := db.Images[keys[i]], db.Images[keys[j]]
+		if a.ID != b.ID {
+			return a.ID < b.ID
+		}
+		return keys[i] < keys[j]
+	})
+
+	renamed := make(map[string]string)
+	seen := make(map[string]bool, len(db.Images))
+	for _, key := range keys {
+		img := db.Images[key]
+		if code, ok := remap[img.Category]; ok {
+			img.Category = code
+		} else if _, ok := parseCategoryCode(img.Category); !ok {
+			img.Category = UncategorizedCode
+		}
+		if code, _, ok := ParseID(img.ID); ok && code == img.Category && !seen[img.ID] {
+			seen[img.ID] = true
+			db.Images[key] = img
+			continue
+		}
+
+		category := img.Category
+		newID := db.nextSequence(imageSequence(category), func(n int) string { return FormatID(category, n) }, func(id string) bool {
+			return used[id]
+		})
+		fmt.Printf("修正圖片 %q 的ID：%s → %s\n", img.Name, img.ID, newID)
+		renamed[img.ID] = newID
+		used[newID] = true
+		seen[newID] = true
+		img.ID = newID
+		db.Images[key] = img
+	}
+	return renamed
+}
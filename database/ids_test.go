@@ -0,0 +1,153 @@
+package database
+
+import "testing"
+
+func TestFormatParseID(t *testing.T) {
+	tests := []struct {
+		code string
+		n    int
+		id   string
+	}{
+		{"02", 7, "02007"},
+		{"00", 1, "00001"},
+		{"02", 999, "02999"},
+		{"02", 1000, "02-1000"},
+		{"100", 1, "100-001"},
+		{"100", 1234, "100-1234"},
+	}
+	for _, tt := range tests {
+		if id := FormatID(tt.code, tt.n); id != tt.id {
+			t.Errorf("FormatID(%q, %d) = %q，預期 %q", tt.code, tt.n, id, tt.id)
+		}
+		code, n, ok := ParseID(tt.id)
+		if !ok || code != tt.code || n != tt.n {
+			t.Errorf("ParseID(%q) = %q, %d, %v，預期 %q, %d", tt.id, code, n, ok, tt.code, tt.n)
+		}
+	}
+
+	// 只接受 FormatID 產生的格式，同一個ID不會有兩種寫法
+	for _, id := range []string{"", "0200", "020001", "02000", "ab001", "2-001", "02-007", "02-0999", "100001", "100-01", "02-", "-001", "02-abc"} {
+		if code, n, ok := ParseID(id); ok {
+			t.Errorf("ParseID(%q) = %q, %d，預期無效", id, code, n)
+		}
+	}
+}
+
+func TestAllocateID(t *testing.T) {
+	db := &ImageDB{
+		Images: map[string]ImageData{
+			"a": {ID: "01001", Code: "01001", Name: "a", Category: "01"},
+			"b": {ID: "01002", Code: "01004", Name: "b", Category: "01"},
+		},
+		Categories: map[string]string{"Cats": "01"},
+		Redirects:  map[string]string{"01003": "01002"},
+	}
+	db.Sequences = map[string]int{imageSequence("01"): 1}
+
+	// 跳過已使用的永久ID、顯示代碼與轉址
+	for _, want := range []string{"01005", "01006"} {
+		if id := db.AllocateID("01"); id != want {
+			t.Errorf("AllocateID(\"01\") = %q，預期 %q", id, want)
+		}
+	}
+
+	// 刪除後的ID不會再被分配
+	db.RemoveImage("01001")
+	if id := db.AllocateID("01"); id != "01007" {
+		t.Errorf("刪除圖片後 AllocateID(\"01\") = %q，預期 01007", id)
+	}
+
+	// 序號超過三位數時改用以 "-" 分隔的格式
+	db.Sequences[imageSequence("01")] = 999
+	if id := db.AllocateID("01"); id != "01-1000" {
+		t.Errorf("AllocateID(\"01\") = %q，預期 01-1000", id)
+	}
+	if id := db.AllocateID("05"); id != "05001" {
+		t.Errorf("AllocateID(\"05\") = %q，預期 05001", id)
+	}
+}
+
+func TestEnsureCategory(t *testing.T) {
+	db := &ImageDB{Categories: map[string]string{UncategorizedName: UncategorizedCode, "Cats": "01", "Dogs": "03"}}
+	db.Sequences = map[string]int{categorySequence: 1}
+
+	tests := []struct {
+		name string
+		code string
+	}{
+		{"Cats", "01"},
+		{UncategorizedName, UncategorizedCode},
+		{"Birds", "02"},
+		{"Fish", "04"}, // 03 已被使用
+		{"Birds", "02"},
+	}
+	for _, tt := range tests {
+		if code := db.EnsureCategory(tt.name); code != tt.code {
+			t.Errorf("EnsureCategory(%q) = %q，預期 %q", tt.name, code, tt.code)
+		}
+	}
+}
+
+func TestRepairIDs(t *testing.T) {
+	db := &ImageDB{
+		Images: map[string]ImageData{
+			"a": {ID: "01001", Name: "a", Category: "01"},
+			"b": {ID: "01001", Name: "b", Category: "01"}, // ID重複
+			"c": {ID: "bad", Name: "c", Category: "01"},   // ID格式錯誤
+			"d": {ID: "x001", Name: "d", Category: "x"},   // 分類編號格式錯誤
+			"e": {ID: "01002", Name: "e", Category: ""},   // 未分類但ID屬於其他分類
+		},
+		Categories: map[string]string{
+			UncategorizedName: UncategorizedCode,
+			"Bad":             "x",
+			"Cats":            "01",
+			"Dogs":            "01", // 編號重複
+		},
+	}
+
+	renamed := repairIDs(db)
+
+	wantCategories := map[string]string{UncategorizedName: "00", "Bad": "02", "Cats": "01", "Dogs": "03"}
+	for name, code := range wantCategories {
+		if db.Categories[name] != code {
+			t.Errorf("分類 %q 的編號為 %q，預期 %q", name, db.Categories[name], code)
+		}
+	}
+
+	wantImages := map[string]struct{ id, category string }{
+		"a": {"01001", "01"},
+		"b": {"01003", "01"},
+		"c": {"01004", "01"},
+		"d": {"02001", "02"},
+		"e": {"00001", "00"},
+	}
+	for key, want := range wantImages {
+		img := db.Images[key]
+		if img.ID != want.id || img.Category != want.category {
+			t.Errorf("圖片 %q 為 %s（分類 %s），預期 %s（分類 %s）", key, img.ID, img.Category, want.id, want.category)
+		}
+	}
+	if renamed["bad"] != "01004" || renamed["x001"] != "02001" || renamed["01002"] != "00001" {
+		t.Errorf("renamed = %v", renamed)
+	}
+
+	wantSequences := map[string]int{categorySequence: 3, imageSequence("00"): 1, imageSequence("01"): 4, imageSequence("02"): 1}
+	for name, n := range wantSequences {
+		if db.Sequences[name] != n {
+			t.Errorf("序號 %q 為 %d，預期 %d", name, db.Sequences[name], n)
+		}
+	}
+
+	// 修正後新分配的編號不會與既有的重複
+	if code := db.EnsureCategory("Birds"); code != "04" {
+		t.Errorf("EnsureCategory(\"Birds\") = %q，預期 04", code)
+	}
+	if id := db.AllocateID("01"); id != "01005" {
+		t.Errorf("AllocateID(\"01\") = %q，預期 01005", id)
+	}
+
+	// 已經正確的資料再修正一次不會有任何變更
+	if renamed := repairIDs(db); len(renamed) != 0 {
+		t.Errorf("第二次修正時更改了 %v", renamed)
+	}
+}
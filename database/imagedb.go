@@ -0,0 +1,323 @@
+package database
+
+import (
+	"sort"
+	"strings"
+)
+
+// 以下為 ImageDB 的查詢與修改方法，由各個 Store 實作與 Transact 的呼叫者共用
+
+// NormalizeName 返回用於比對名稱的正規化字串（去除前後空白、合併連續空白並轉為小寫）
+func NormalizeName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// ensureMaps 確保映射已初始化（空檔案或舊格式可能缺少欄位）並建立索引
+// 快照在發佈給其他 goroutine 之前必須先呼叫此方法，之後的讀取才不會寫入索引
+func (db *ImageDB) ensureMaps() {
+	if db.Images == nil {
+		db.Images = make(map[string]ImageData)
+	}
+	if db.Categories == nil {
+		db.Categories = make(map[string]string)
+	}
+	if db.CategoryInfo == nil {
+		db.CategoryInfo = make(map[string]CategoryInfo)
+	}
+	if db.Sequences == nil {
+		db.Sequences = make(map[string]int)
+	}
+	if db.Redirects == nil {
+		db.Redirects = make(map[string]string)
+	}
+	if db.Trash == nil {
+		db.Trash = make(map[string]TrashedImage)
+	}
+	if db.History == nil {
+		db.History = make(map[string][]Revision)
+	}
+	db.ensureIndex()
+}
+
+// ensureIndex 在索引尚未建立時根據 Images 重建
+func (db *ImageDB) ensureIndex() {
+	if db.byID != nil {
+		return
+	}
+	if db.Images == nil {
+		db.Images = make(map[string]ImageData)
+	}
+
+	db.byID = make(map[string]string, len(db.Images))
+	db.byCode = make(map[string]string, len(db.Images))
+	db.byName = make(map[string][]string)
+	db.byCategory = make(map[string][]string)
+	db.byTag = make(map[string][]string)
+
+	// 依鍵排序後建立，ID重複時結果才會固定
+	keys := make([]string, 0, len(db.Images))
+	for key := range db.Images {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		db.indexImage(key, db.Images[key])
+	}
+}
+
+// indexImage 將圖片加入索引
+func (db *ImageDB) indexImage(key string, img ImageData) {
+	if _, exists := db.byID[img.ID]; exists {
+		return // ID重複時保留先建立的索引
+	}
+	db.byID[img.ID] = key
+	if img.Code != "" {
+		db.byCode[img.Code] = img.ID
+	}
+	for _, name := range img.names() {
+		db.byName[name] = insertSorted(db.byName[name], img.ID)
+	}
+	db.byCategory[img.Category] = insertSorted(db.byCategory[img.Category], img.ID)
+	for _, tag := range img.Tags {
+		db.byTag[tag] = insertSorted(db.byTag[tag], img.ID)
+	}
+}
+
+// unindexImage 將鍵為 key 的圖片從索引移除
+func (db *ImageDB) unindexImage(key string, img ImageData) {
+	if db.byID[img.ID] != key {
+		return // 此圖片因ID重複而未被索引
+	}
+	delete(db.byID, img.ID)
+	if db.byCode[img.Code] == img.ID {
+		delete(db.byCode, img.Code)
+	}
+	for _, name := range img.names() {
+		if db.byName[name] = removeSorted(db.byName[name], img.ID); len(db.byName[name]) == 0 {
+			delete(db.byName, name)
+		}
+	}
+	if db.byCategory[img.Category] = removeSorted(db.byCategory[img.Category], img.ID); len(db.byCategory[img.Category]) == 0 {
+		delete(db.byCategory, img.Category)
+	}
+	for _, tag := range img.Tags {
+		if db.byTag[tag] = removeSorted(db.byTag[tag], img.ID); len(db.byTag[tag]) == 0 {
+			delete(db.byTag, tag)
+		}
+	}
+}
+
+// insertSorted 返回加入 id 後仍維持排序的新切片（不修改原切片）
+func insertSorted(ids []string, id string) []string {
+	n := sort.SearchStrings(ids, id)
+	if n < len(ids) && ids[n] == id {
+		return ids
+	}
+	out := make([]string, 0, len(ids)+1)
+	out = append(out, ids[:n]...)
+	out = append(out, id)
+	return append(out, ids[n:]...)
+}
+
+// removeSorted 返回移除 id 後的新切片（不修改原切片）
+func removeSorted(ids []string, id string) []string {
+	n := sort.SearchStrings(ids, id)
+	if n >= len(ids) || ids[n] != id {
+		return ids
+	}
+	out := make([]string, 0, len(ids)-1)
+	out = append(out, ids[:n]...)
+	return append(out, ids[n+1:]...)
+}
+
+// Clone 返回數據庫的深層複製，修改複本不會影響原本的數據庫
+func (db *ImageDB) Clone() *ImageDB {
+	db.ensureIndex()
+	clone := *db // 複製其他欄位（例如 SchemaVersion），映射在下面另外複製
+	clone.Images = make(map[string]ImageData, len(db.Images))
+	clone.Categories = make(map[string]string, len(db.Categories))
+	clone.CategoryInfo = make(map[string]CategoryInfo, len(db.CategoryInfo))
+	clone.Sequences = make(map[string]int, len(db.Sequences))
+	clone.Redirects = make(map[string]string, len(db.Redirects))
+	clone.Trash = make(map[string]TrashedImage, len(db.Trash))
+	clone.History = make(map[string][]Revision, len(db.History))
+	clone.byID = make(map[string]string, len(db.byID))
+	clone.byCode = make(map[string]string, len(db.byCode))
+	clone.byName = make(map[string][]string, len(db.byName))
+	clone.byCategory = make(map[string][]string, len(db.byCategory))
+	clone.byTag = make(map[string][]string, len(db.byTag))
+
+	for key, img := range db.Images {
+		clone.Images[key] = img
+	}
+	for name, code := range db.Categories {
+		clone.Categories[name] = code
+	}
+	for code, info := range db.CategoryInfo {
+		clone.CategoryInfo[code] = info
+	}
+	for name, n := range db.Sequences {
+		clone.Sequences[name] = n
+	}
+	for old, id := range db.Redirects {
+		clone.Redirects[old] = id
+	}
+	for id, entry := range db.Trash {
+		clone.Trash[id] = entry
+	}
+	for id, revisions := range db.History {
+		clone.History[id] = revisions
+	}
+	for id, key := range db.byID {
+		clone.byID[id] = key
+	}
+	for code, id := range db.byCode {
+		clone.byCode[code] = id
+	}
+	for name, ids := range db.byName {
+		clone.byName[name] = ids
+	}
+	for code, ids := range db.byCategory {
+		clone.byCategory[code] = ids
+	}
+	for tag, ids := range db.byTag {
+		clone.byTag[tag] = ids
+	}
+	return &clone
+}
+
+// imagesByIDs 將ID列表轉為圖片
+func (db *ImageDB) imagesByIDs(ids []string) []ImageData {
+	images := make([]ImageData, 0, len(ids))
+	for _, id := range ids {
+		images = append(images, db.Images[db.byID[id]])
+	}
+	return images
+}
+
+// ImageByID 返回ID為 id 的圖片
+func (db *ImageDB) ImageByID(id string) (ImageData, bool) {
+	db.ensureIndex()
+	key, ok := db.byID[id]
+	if !ok {
+		return ImageData{}, false
+	}
+	return db.Images[key], true
+}
+
+// ResolveID 依序以永久ID、顯示代碼與舊ID的轉址尋找圖片
+// 圖片換分類後，之前記下的ID或代碼仍然會找到同一張圖片
+func (db *ImageDB) ResolveID(ref string) (ImageData, bool) {
+	db.ensureIndex()
+	if img, ok := db.ImageByID(ref); ok {
+		return img, true
+	}
+	if id, ok := db.byCode[ref]; ok {
+		return db.ImageByID(id)
+	}
+	if id, ok := db.Redirects[ref]; ok {
+		return db.ImageByID(id)
+	}
+	return ImageData{}, false
+}
+
+// FindImage 以ID（包含顯示代碼與舊ID）或名稱、別名尋找圖片，ID優先
+func (db *ImageDB) FindImage(identifier string) (ImageData, bool) {
+	if img, ok := db.ResolveID(identifier); ok {
+		return img, true
+	}
+	return db.ImageByName(identifier)
+}
+
+// ImageByName 返回名稱或別名相符（比對正規化後的結果）的圖片
+// 有多張圖片時優先返回名稱完全相同的，否則返回ID最小的
+func (db *ImageDB) ImageByName(name string) (ImageData, bool) {
+	db.ensureIndex()
+	ids := db.byName[NormalizeName(name)]
+	if len(ids) == 0 {
+		return ImageData{}, false
+	}
+	if img, ok := db.Images[name]; ok {
+		return img, true
+	}
+	return db.Images[db.byID[ids[0]]], true
+}
+
+// SearchName 返回名稱或別名包含 query（大小寫不敏感）且依ID排序的圖片
+func (db *ImageDB) SearchName(query string) []ImageData {
+	db.ensureIndex()
+	query = NormalizeName(query)
+	seen := make(map[string]bool)
+	var matched []ImageData
+	for name, ids := range db.byName {
+		if !strings.Contains(name, query) {
+			continue
+		}
+		for _, id := range ids {
+			if !seen[id] { // 名稱與別名可能同時相符
+				seen[id] = true
+				matched = append(matched, db.Images[db.byID[id]])
+			}
+		}
+	}
+	sortByID(matched)
+	return matched
+}
+
+// AllImages 返回依ID排序的所有圖片
+func (db *ImageDB) AllImages() []ImageData {
+	db.ensureIndex()
+	ids := make([]string, 0, len(db.byID))
+	for id := range db.byID {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return db.imagesByIDs(ids)
+}
+
+// ImagesInCategory 返回指定分類編號中依ID排序的圖片
+func (db *ImageDB) ImagesInCategory(categoryCode string) []ImageData {
+	db.ensureIndex()
+	return db.imagesByIDs(db.byCategory[categoryCode])
+}
+
+// AddImage 新增圖片，名稱或別名已被其他圖片使用時返回 ErrNameTaken
+func (db *ImageDB) AddImage(img ImageData) error {
+	if err := db.CheckNames(img, ""); err != nil {
+		return err
+	}
+	db.PutImage(img)
+	return nil
+}
+
+// PutImage 寫入圖片，若已有同名圖片則覆蓋
+// 覆蓋會讓舊圖片失去永久ID、轉址與版本紀錄，新增圖片請使用 AddImage
+func (db *ImageDB) PutImage(img ImageData) {
+	db.ensureIndex()
+	if old, ok := db.Images[img.Name]; ok {
+		db.unindexImage(img.Name, old)
+	}
+	db.Images[img.Name] = img
+	db.indexImage(img.Name, img)
+}
+
+// RemoveImage 刪除ID為 id 的圖片，返回是否有找到
+func (db *ImageDB) RemoveImage(id string) bool {
+	db.ensureIndex()
+	key, ok := db.byID[id]
+	if !ok {
+		return false
+	}
+	db.unindexImage(key, db.Images[key])
+	delete(db.Images, key)
+	return true
+}
+
+// ReplaceImage 以 img 取代ID為 id 的圖片（允許更改ID與名稱），返回是否有找到
+func (db *ImageDB) ReplaceImage(id string, img ImageData) bool {
+	if !db.RemoveImage(id) { // 名稱可能已改變，先移除舊的鍵
+		return false
+	}
+	db.PutImage(img)
+	return true
+}
@@ -0,0 +1,204 @@
+package database
+
+import (
+	"sync"
+)
+
+// JSONStore 是以單一 JSON 檔案保存圖庫的 Store 實作
+// 每次操作都會重新讀取檔案，修改後再整份寫回
+// JSONStore 同時實作 Backend，可作為 Library 的持久化層
+type JSONStore struct {
+	filePath string
+	mu       sync.Mutex // 確保「讀取-修改-寫回」的過程不會被其他操作打斷
+}
+
+// NewJSONStore 建立以 filePath 為檔案的 JSONStore
+func NewJSONStore(filePath string) *JSONStore {
+	return &JSONStore{filePath: filePath}
+}
+
+// load 讀取數據庫並確保映射已初始化
+func (s *JSONStore) load() (*ImageDB, error) {
+	db, err := LoadDatabase(s.filePath)
+	if err != nil {
+		return nil, err
+	}
+	db.ensureMaps()
+	return db, nil
+}
+
+// view 在鎖定狀態下讀取數據庫並交給 fn 處理
+func (s *JSONStore) view(fn func(db *ImageDB) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	db, err := s.load()
+	if err != nil {
+		return err
+	}
+	return fn(db)
+}
+
+func (s *JSONStore) GetByID(id string) (ImageData, error) {
+	var found ImageData
+	err := s.view(func(db *ImageDB) error {
+		var ok bool
+		if found, ok = db.ResolveID(id); !ok {
+			return ErrNotFound
+		}
+		return nil
+	})
+	return found, err
+}
+
+func (s *JSONStore) GetByName(name string) (ImageData, error) {
+	var found ImageData
+	err := s.view(func(db *ImageDB) error {
+		var ok bool
+		if found, ok = db.ImageByName(name); !ok {
+			return ErrNotFound
+		}
+		return nil
+	})
+	return found, err
+}
+
+func (s *JSONStore) Search(query string) ([]ImageData, error) {
+	var matched []ImageData
+	err := s.view(func(db *ImageDB) error {
+		matched = db.SearchName(query)
+		return nil
+	})
+	return matched, err
+}
+
+func (s *JSONStore) RankedSearch(query string, limit int) ([]SearchResult, error) {
+	var results []SearchResult
+	err := s.view(func(db *ImageDB) error {
+		results = db.RankedSearch(query, limit)
+		return nil
+	})
+	return results, err
+}
+
+func (s *JSONStore) Add(img ImageData) error {
+	return s.Transact(func(db *ImageDB) error {
+		return db.AddImage(img)
+	})
+}
+
+func (s *JSONStore) Delete(id string) error {
+	return s.Transact(func(db *ImageDB) error {
+		if !db.RemoveImage(id) {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (s *JSONStore) Update(id string, img ImageData) error {
+	return s.Transact(func(db *ImageDB) error {
+		if !db.ReplaceImage(id, img) {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (s *JSONStore) List() ([]ImageData, error) {
+	var all []ImageData
+	err := s.view(func(db *ImageDB) error {
+		all = db.AllImages()
+		return nil
+	})
+	return all, err
+}
+
+func (s *JSONStore) ListByCategory(categoryCode string) ([]ImageData, error) {
+	var filtered []ImageData
+	err := s.view(func(db *ImageDB) error {
+		filtered = db.ImagesInCategory(categoryCode)
+		return nil
+	})
+	return filtered, err
+}
+
+func (s *JSONStore) ListByTags(tags []string, matchAll bool) ([]ImageData, error) {
+	var filtered []ImageData
+	err := s.view(func(db *ImageDB) error {
+		filtered = db.ImagesWithTags(tags, matchAll)
+		return nil
+	})
+	return filtered, err
+}
+
+func (s *JSONStore) Tags() (map[string]int, error) {
+	var tags map[string]int
+	err := s.view(func(db *ImageDB) error {
+		tags = db.AllTags()
+		return nil
+	})
+	return tags, err
+}
+
+func (s *JSONStore) Categories() (map[string]string, error) {
+	categories := make(map[string]string)
+	err := s.view(func(db *ImageDB) error {
+		for name, code := range db.Categories {
+			categories[name] = code
+		}
+		return nil
+	})
+	return categories, err
+}
+
+func (s *JSONStore) CategoryInfos() (map[string]CategoryInfo, error) {
+	infos := make(map[string]CategoryInfo)
+	err := s.view(func(db *ImageDB) error {
+		for code, info := range db.CategoryInfo {
+			infos[code] = info
+		}
+		return nil
+	})
+	return infos, err
+}
+
+func (s *JSONStore) AddCategory(name, code string) error {
+	return s.Transact(func(db *ImageDB) error {
+		db.Categories[name] = code
+		return nil
+	})
+}
+
+// Transact 在鎖定狀態下讀取數據庫，交給 fn 修改後寫回檔案
+func (s *JSONStore) Transact(fn func(db *ImageDB) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	db, err := s.load()
+	if err != nil {
+		return err
+	}
+	if err := fn(db); err != nil {
+		return err
+	}
+	return SaveDatabase(s.filePath, db)
+}
+
+func (s *JSONStore) View(fn func(db *ImageDB) error) error {
+	return s.view(fn)
+}
+
+// Load 讀取完整的圖庫（實作 Backend）
+func (s *JSONStore) Load() (*ImageDB, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+// Persist 將整份快照寫回檔案（實作 Backend），JSON 檔案無法局部更新因此忽略 changes
+func (s *JSONStore) Persist(snapshot *ImageDB, changes []Change) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SaveDatabase(s.filePath, snapshot)
+}
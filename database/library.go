@@ -0,0 +1,373 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Backend 是 Library 的持久化層
+type Backend interface {
+	// Load 讀取完整的圖庫
+	Load() (*ImageDB, error)
+	// Persist 保存圖庫，snapshot 為目前完整的圖庫，
+	// changes 為上次成功保存之後累積的變更（可局部更新的後端只需套用 changes）
+	Persist(snapshot *ImageDB, changes []Change) error
+}
+
+// ChangeKind 是單筆變更的種類
+type ChangeKind int
+
+const (
+	ChangePutImage           ChangeKind = iota // 新增或修改圖片
+	ChangeDeleteImage                          // 刪除圖片
+	ChangePutCategory                          // 新增或修改分類
+	ChangeDeleteCategory                       // 刪除分類
+	ChangePutCategoryInfo                      // 新增或修改分類說明
+	ChangeDeleteCategoryInfo                   // 刪除分類說明
+	ChangePutSequence                          // 更新序號
+	ChangePutRedirect                          // 新增或修改舊ID的轉址
+	ChangeDeleteRedirect                       // 刪除舊ID的轉址
+	ChangePutTrash                             // 將圖片移到回收桶
+	ChangeDeleteTrash                          // 從回收桶移除圖片（還原或永久刪除）
+	ChangePutHistory                           // 更新圖片的版本紀錄
+	ChangeDeleteHistory                        // 刪除圖片的版本紀錄
+)
+
+// Change 描述一筆對圖庫的變更
+type Change struct {
+	Kind         ChangeKind
+	Image        ImageData // ChangePutImage 的新內容；ChangeDeleteImage 只使用 Image.ID
+	CategoryName string
+	CategoryCode string
+	CategoryInfo CategoryInfo // ChangePutCategoryInfo 的新內容，以 CategoryCode 為鍵
+	Sequence     string       // ChangePutSequence 的序號名稱
+	Value        int          // ChangePutSequence 的新值
+	OldID        string       // ChangePutRedirect 與 ChangeDeleteRedirect 的舊ID，轉址目標為 Image.ID
+	Trash        TrashedImage // ChangePutTrash 的新內容；ChangeDeleteTrash 只使用 Trash.Image.ID
+	Revisions    []Revision   // ChangePutHistory 的完整版本紀錄，圖片為 Image.ID
+}
+
+// diff 比較兩份圖庫，返回由 old 變成 new 所需的變更（刪除在前，新增/修改在後）
+func diff(old, new *ImageDB) []Change {
+	var deletes, puts []Change
+
+	oldByID := make(map[string]ImageData, len(old.Images))
+	for _, img := range old.Images {
+		oldByID[img.ID] = img
+	}
+	newIDs := make(map[string]bool, len(new.Images))
+	for _, img := range new.Images {
+		newIDs[img.ID] = true
+		if prev, ok := oldByID[img.ID]; !ok || !reflect.DeepEqual(prev, img) {
+			puts = append(puts, Change{Kind: ChangePutImage, Image: img})
+		}
+	}
+	for id := range oldByID {
+		if !newIDs[id] {
+			deletes = append(deletes, Change{Kind: ChangeDeleteImage, Image: ImageData{ID: id}})
+		}
+	}
+
+	for name, code := range new.Categories {
+		if prev, ok := old.Categories[name]; !ok || prev != code {
+			puts = append(puts, Change{Kind: ChangePutCategory, CategoryName: name, CategoryCode: code})
+		}
+	}
+	for name := range old.Categories {
+		if _, ok := new.Categories[name]; !ok {
+			deletes = append(deletes, Change{Kind: ChangeDeleteCategory, CategoryName: name})
+		}
+	}
+
+	for code, info := range new.CategoryInfo {
+		if prev, ok := old.CategoryInfo[code]; !ok || prev != info {
+			puts = append(puts, Change{Kind: ChangePutCategoryInfo, CategoryCode: code, CategoryInfo: info})
+		}
+	}
+	for code := range old.CategoryInfo {
+		if _, ok := new.CategoryInfo[code]; !ok {
+			deletes = append(deletes, Change{Kind: ChangeDeleteCategoryInfo, CategoryCode: code})
+		}
+	}
+	for oldID, id := range new.Redirects {
+		if prev, ok := old.Redirects[oldID]; !ok || prev != id {
+			puts = append(puts, Change{Kind: ChangePutRedirect, OldID: oldID, Image: ImageData{ID: id}})
+		}
+	}
+	for oldID := range old.Redirects {
+		if _, ok := new.Redirects[oldID]; !ok {
+			deletes = append(deletes, Change{Kind: ChangeDeleteRedirect, OldID: oldID})
+		}
+	}
+	for id, entry := range new.Trash {
+		if prev, ok := old.Trash[id]; !ok || !reflect.DeepEqual(prev, entry) {
+			puts = append(puts, Change{Kind: ChangePutTrash, Trash: entry})
+		}
+	}
+	for id := range old.Trash {
+		if _, ok := new.Trash[id]; !ok {
+			deletes = append(deletes, Change{Kind: ChangeDeleteTrash, Trash: TrashedImage{Image: ImageData{ID: id}}})
+		}
+	}
+	for id, revisions := range new.History {
+		if prev, ok := old.History[id]; !ok || !reflect.DeepEqual(prev, revisions) {
+			puts = append(puts, Change{Kind: ChangePutHistory, Image: ImageData{ID: id}, Revisions: revisions})
+		}
+	}
+	for id := range old.History {
+		if _, ok := new.History[id]; !ok {
+			deletes = append(deletes, Change{Kind: ChangeDeleteHistory, Image: ImageData{ID: id}})
+		}
+	}
+	for name, n := range new.Sequences {
+		if old.Sequences[name] != n {
+			puts = append(puts, Change{Kind: ChangePutSequence, Sequence: name, Value: n})
+		}
+	}
+
+	return append(deletes, puts...)
+}
+
+// ErrClosed 表示圖庫已經關閉，不能再修改
+var ErrClosed = errors.New("圖庫已關閉")
+
+// persistRetryDelay 是保存失敗後重試前的等待時間（測試時會縮短）
+var persistRetryDelay = 5 * time.Second
+
+// Library 是保存在記憶體中的圖庫，實作 Store
+//
+// 讀取操作直接使用目前的快照，不需要任何鎖；
+// 修改操作在複本上進行（copy-on-write），完成後才原子地替換快照，
+// 並由單一的寫入 goroutine 把變更保存到 Backend。
+type Library struct {
+	backend  Backend
+	snapshot atomic.Pointer[ImageDB] // 目前的快照，發佈後不可再修改
+
+	txMu   sync.Mutex // 讓修改操作依序執行，避免同時修改互相覆蓋
+	closed bool       // 由 txMu 保護
+
+	pendingMu sync.Mutex
+	pending   []Change      // 尚未保存的變更
+	wake      chan struct{} // 通知寫入 goroutine 有新的變更
+	closing   chan struct{} // Close 時關閉，讓寫入 goroutine 停止無限重試
+	done      chan struct{} // 寫入 goroutine 結束時關閉
+	closeOnce sync.Once
+	closeErr  error // 關閉時最後一次保存的錯誤，在 done 關閉之前寫入
+}
+
+// OpenLibrary 從 backend 讀取圖庫並啟動寫入 goroutine
+func OpenLibrary(backend Backend) (*Library, error) {
+	db, err := backend.Load()
+	if err != nil {
+		return nil, err
+	}
+	db.ensureMaps()
+
+	l := &Library{
+		backend: backend,
+		wake:    make(chan struct{}, 1),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	l.snapshot.Store(db)
+	go l.writer()
+	return l, nil
+}
+
+// Snapshot 返回目前圖庫的唯讀快照，呼叫者不可修改返回的數據庫
+func (l *Library) Snapshot() *ImageDB {
+	return l.snapshot.Load()
+}
+
+// Transact 在目前快照的複本上執行 fn，成功後替換快照並排程保存
+// 所有修改操作依序執行，因此 fn 內的讀取與修改不會被其他修改打斷
+func (l *Library) Transact(fn func(db *ImageDB) error) error {
+	l.txMu.Lock()
+	defer l.txMu.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+
+	old := l.snapshot.Load()
+	next := old.Clone()
+	if err := fn(next); err != nil {
+		return err
+	}
+
+	changes := diff(old, next)
+	if len(changes) == 0 {
+		return nil
+	}
+	l.snapshot.Store(next)
+
+	l.pendingMu.Lock()
+	l.pending = append(l.pending, changes...)
+	l.pendingMu.Unlock()
+
+	select {
+	case l.wake <- struct{}{}:
+	default: // 寫入 goroutine 已經收到通知，稍後會一併保存
+	}
+	return nil
+}
+
+// writer 是唯一負責保存的 goroutine，會把短時間內的多次修改合併成一次保存
+// 保存失敗時持續重試，直到成功或圖庫關閉
+func (l *Library) writer() {
+	defer close(l.done)
+	for retrying := false; ; {
+		var retry <-chan time.Time
+		if retrying {
+			retry = time.After(persistRetryDelay)
+		}
+		select {
+		case <-l.wake:
+		case <-retry:
+		case <-l.closing:
+			l.closeErr = l.finalFlush()
+			return
+		}
+		retrying = l.flush() != nil
+	}
+}
+
+// finalFlush 在關閉時保存最後剩下的變更，最多嘗試三次，返回最後一次的錯誤
+func (l *Library) finalFlush() error {
+	err := l.flush()
+	for i := 1; i < 3 && err != nil; i++ {
+		time.Sleep(persistRetryDelay)
+		err = l.flush()
+	}
+	return err
+}
+
+// flush 保存目前累積的變更（失敗時變更會保留到下次重試）
+func (l *Library) flush() error {
+	l.pendingMu.Lock()
+	changes := l.pending
+	l.pending = nil
+	snapshot := l.snapshot.Load()
+	l.pendingMu.Unlock()
+
+	if len(changes) == 0 {
+		return nil
+	}
+	if err := l.backend.Persist(snapshot, changes); err != nil {
+		fmt.Println("保存圖庫失敗，稍後重試:", err)
+		l.pendingMu.Lock()
+		l.pending = append(changes, l.pending...)
+		l.pendingMu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Close 保存所有尚未寫入的變更並停止寫入 goroutine
+// 最後仍無法保存時返回錯誤，表示有修改沒有寫入 backend
+// backend 由呼叫者負責關閉（多個圖庫可能共用同一個資料庫連線）
+func (l *Library) Close() error {
+	l.closeOnce.Do(func() {
+		l.txMu.Lock() // 確保不會再有新的修改
+		l.closed = true
+		close(l.closing)
+		l.txMu.Unlock()
+	})
+	<-l.done
+	return l.closeErr
+}
+
+// View 直接使用目前的快照，不需要任何鎖
+func (l *Library) View(fn func(db *ImageDB) error) error {
+	return fn(l.Snapshot())
+}
+
+func (l *Library) GetByID(id string) (ImageData, error) {
+	img, ok := l.Snapshot().ResolveID(id)
+	if !ok {
+		return ImageData{}, ErrNotFound
+	}
+	return img, nil
+}
+
+func (l *Library) GetByName(name string) (ImageData, error) {
+	img, ok := l.Snapshot().ImageByName(name)
+	if !ok {
+		return ImageData{}, ErrNotFound
+	}
+	return img, nil
+}
+
+func (l *Library) Search(query string) ([]ImageData, error) {
+	return l.Snapshot().SearchName(query), nil
+}
+
+func (l *Library) RankedSearch(query string, limit int) ([]SearchResult, error) {
+	return l.Snapshot().RankedSearch(query, limit), nil
+}
+
+func (l *Library) Add(img ImageData) error {
+	return l.Transact(func(db *ImageDB) error {
+		return db.AddImage(img)
+	})
+}
+
+func (l *Library) Delete(id string) error {
+	return l.Transact(func(db *ImageDB) error {
+		if !db.RemoveImage(id) {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (l *Library) Update(id string, img ImageData) error {
+	return l.Transact(func(db *ImageDB) error {
+		if !db.ReplaceImage(id, img) {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (l *Library) List() ([]ImageData, error) {
+	return l.Snapshot().AllImages(), nil
+}
+
+func (l *Library) ListByCategory(categoryCode string) ([]ImageData, error) {
+	return l.Snapshot().ImagesInCategory(categoryCode), nil
+}
+
+func (l *Library) ListByTags(tags []string, matchAll bool) ([]ImageData, error) {
+	return l.Snapshot().ImagesWithTags(tags, matchAll), nil
+}
+
+func (l *Library) Tags() (map[string]int, error) {
+	return l.Snapshot().AllTags(), nil
+}
+
+func (l *Library) Categories() (map[string]string, error) {
+	categories := make(map[string]string)
+	for name, code := range l.Snapshot().Categories {
+		categories[name] = code
+	}
+	return categories, nil
+}
+
+func (l *Library) CategoryInfos() (map[string]CategoryInfo, error) {
+	infos := make(map[string]CategoryInfo)
+	for code, info := range l.Snapshot().CategoryInfo {
+		infos[code] = info
+	}
+	return infos, nil
+}
+
+func (l *Library) AddCategory(name, code string) error {
+	return l.Transact(func(db *ImageDB) error {
+		db.Categories[name] = code
+		return nil
+	})
+}
@@ -0,0 +1,154 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// persistedJSON 以 JSON 表示圖庫中會被保存的內容，空的與 nil 的映射視為相同
+func persistedJSON(t *testing.T, db *ImageDB) string {
+	t.Helper()
+	db = db.Clone()
+	db.ensureMaps()
+	data, err := json.Marshal(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// TestLibraryPersistRoundTrip 在每種 Backend 上依序執行各種修改，
+// 每一步都關閉圖庫後重新讀取，確認保存的內容與記憶體中的快照相同
+func TestLibraryPersistRoundTrip(t *testing.T) {
+	backends := map[string]func(t *testing.T) func() Backend{
+		"JSONStore": func(t *testing.T) func() Backend {
+			path := filepath.Join(t.TempDir(), "library.json")
+			return func() Backend { return NewJSONStore(path) }
+		},
+		"SQLiteStore": func(t *testing.T) func() Backend {
+			s := openTestSQLite(t)
+			return func() Backend { return s.Scope("guild") }
+		},
+	}
+
+	at := func(minute int) time.Time {
+		return time.Date(2026, 1, 2, 3, minute, 0, 0, time.UTC)
+	}
+	blob := &BlobRef{Hash: "abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789", ContentType: "image/png", Size: 1234}
+	steps := []struct {
+		name string
+		fn   func(db *ImageDB) error
+	}{
+		{"新增", func(db *ImageDB) error {
+			cats, err := db.CreateCategory("Cats")
+			if err != nil {
+				return err
+			}
+			dogs, err := db.CreateCategory("Dogs")
+			if err != nil {
+				return err
+			}
+			if err := db.SetCategoryInfo("Cats", CategoryInfo{Description: "貓", Emoji: "🐱"}); err != nil {
+				return err
+			}
+			id := db.AllocateID(cats)
+			tabby := ImageData{
+				ID: id, Code: id, Name: "Tabby", Category: cats, URL: "https://example.com/tabby.png",
+				Tags: []string{"cats", "cute"}, Aliases: []string{"tiger"},
+				Mirror: &Mirror{URL: "https://example.com/tabby.png", Status: MirrorOK, Blob: blob, Location: "ab/cd", CheckedAt: at(1)},
+				Health: &LinkHealth{URL: "https://example.com/tabby.png", Status: LinkOK, HTTPStatus: 200, ContentType: "image/png", CheckedAt: at(2)},
+				PHash:  1 << 63,
+				Meta:   &ImageMeta{ContentType: "image/png", Width: 10, Height: 20, Size: 1234, Hash: blob.Hash},
+			}
+			id = db.AllocateID(dogs)
+			rex := ImageData{ID: id, Code: id, Name: "Rex", Category: dogs, Blob: blob, Tags: []string{"dogs"}}
+			id = db.AllocateID(UncategorizedCode)
+			misc := ImageData{ID: id, Code: id, Name: "Misc", Category: UncategorizedCode, URL: "https://example.com/misc.png"}
+			for _, img := range []ImageData{tabby, rex, misc} {
+				if err := db.AddImage(img); err != nil {
+					return err
+				}
+				db.RecordRevision(nil, img, "user", AuditAdd, at(3))
+			}
+			return nil
+		}},
+		{"修改", func(db *ImageDB) error {
+			tabby, _ := db.ImageByName("Tabby")
+			// 第二次換分類時舊的顯示代碼會轉址到圖片
+			moved, _ := db.Reclassify(tabby.ID, "Dogs")
+			after, _ := db.Reclassify(tabby.ID, "Birds")
+			if len(db.Redirects) != 1 {
+				return fmt.Errorf("轉址為 %v，預期只有 %s", db.Redirects, moved.Code)
+			}
+			db.RecordRevision(&tabby, after, "user", AuditClassify, at(4))
+			if _, err := db.AddAlias(after.ID, "stripes"); err != nil {
+				return err
+			}
+			misc, _ := db.ImageByName("Misc")
+			if _, ok := db.AddTags(misc.ID, "other"); !ok {
+				return ErrNotFound
+			}
+			return db.SetCategoryInfo("Cats", CategoryInfo{Description: "貓咪"})
+		}},
+		{"刪除", func(db *ImageDB) error {
+			rex, _ := db.ImageByName("Rex")
+			if _, ok := db.TrashImage(rex.ID, "user", at(5)); !ok {
+				return ErrNotFound
+			}
+			misc, _ := db.ImageByName("Misc")
+			db.RemoveImage(misc.ID)
+			delete(db.History, misc.ID)
+			tabby, _ := db.ImageByName("Tabby")
+			if _, _, err := db.RemoveAlias(tabby.ID, "tiger"); err != nil {
+				return err
+			}
+			for oldID := range db.Redirects {
+				delete(db.Redirects, oldID)
+			}
+			_, err := db.DeleteCategory("Cats", "")
+			return err
+		}},
+		{"還原與清理", func(db *ImageDB) error {
+			rex, _ := db.FindTrashed("Rex")
+			if _, err := db.RestoreImage(rex.Image.ID); err != nil {
+				return err
+			}
+			tabby, _ := db.ImageByName("Tabby")
+			if _, ok := db.TrashImage(tabby.ID, "user", at(6)); !ok {
+				return ErrNotFound
+			}
+			db.PurgeTrash(at(7))
+			_, err := db.RenameCategory("Dogs", "Hounds")
+			return err
+		}},
+	}
+
+	for name, newBackend := range backends {
+		t.Run(name, func(t *testing.T) {
+			backend := newBackend(t)
+			for _, step := range steps {
+				lib, err := OpenLibrary(backend())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := lib.Transact(step.fn); err != nil {
+					t.Fatalf("%s: %v", step.name, err)
+				}
+				if err := lib.Close(); err != nil {
+					t.Fatalf("%s: Close() = %v", step.name, err)
+				}
+
+				loaded, err := backend().Load()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, want := persistedJSON(t, loaded), persistedJSON(t, lib.Snapshot()); got != want {
+					t.Fatalf("%s 之後重新讀取的內容不同\n讀取: %s\n快照: %s", step.name, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// failingBackend 的 Persist 在 fail 為 true 時一律失敗
+type failingBackend struct {
+	mu    sync.Mutex
+	fail  bool
+	saved *ImageDB
+}
+
+func (b *failingBackend) Load() (*ImageDB, error) { return &ImageDB{}, nil }
+
+func (b *failingBackend) Persist(snapshot *ImageDB, changes []Change) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.fail {
+		return errors.New("磁碟已滿")
+	}
+	b.saved = snapshot
+	return nil
+}
+
+func (b *failingBackend) setFail(fail bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fail = fail
+}
+
+func shortRetryDelay(t *testing.T) {
+	t.Helper()
+	old := persistRetryDelay
+	persistRetryDelay = 10 * time.Millisecond
+	t.Cleanup(func() { persistRetryDelay = old })
+}
+
+func TestLibraryCloseReportsPersistFailure(t *testing.T) {
+	shortRetryDelay(t)
+	backend := &failingBackend{fail: true}
+	lib, err := OpenLibrary(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = lib.Transact(func(db *ImageDB) error {
+		db.PutImage(ImageData{ID: "01001", Name: "a"})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond) // 讓寫入 goroutine 進入重試
+
+	closed := make(chan error, 1)
+	go func() { closed <- lib.Close() }()
+	select {
+	case err := <-closed:
+		if err == nil {
+			t.Error("Close 沒有返回保存失敗的錯誤")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("保存一直失敗時 Close 沒有結束")
+	}
+	if err := lib.Transact(func(db *ImageDB) error { return nil }); !errors.Is(err, ErrClosed) {
+		t.Errorf("關閉後 Transact 的錯誤 = %v，預期 ErrClosed", err)
+	}
+}
+
+func TestLibraryRetriesUntilPersisted(t *testing.T) {
+	shortRetryDelay(t)
+	backend := &failingBackend{fail: true}
+	lib, err := OpenLibrary(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = lib.Transact(func(db *ImageDB) error {
+		db.PutImage(ImageData{ID: "01001", Name: "a"})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	backend.setFail(false)
+	if err := lib.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if _, ok := backend.saved.ImageByID("01001"); !ok {
+		t.Error("恢復之後沒有保存失敗時的修改")
+	}
+}
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+)
+
+// ImageMeta 是從圖片檔案讀取的資訊，建立後不可修改（快照之間會共用）
+type ImageMeta struct {
+	ContentType string `json:"content_type"`       // 依內容判斷的格式
+	Width       int    `json:"width"`              // 寬度（像素）
+	Height      int    `json:"height"`             // 高度（像素）
+	Size        int64  `json:"size"`               // 檔案大小（位元組）
+	Animated    bool   `json:"animated,omitempty"` // 是否為多格的動態 GIF 或 WebP
+	Hash        string `json:"hash"`               // 內容的 SHA-256（十六進位）
+}
+
+// ImageFormats 是可以用來篩選的格式名稱與對應的 MIME 類型
+var ImageFormats = map[string]string{
+	"png":  "image/png",
+	"jpeg": "image/jpeg",
+	"gif":  "image/gif",
+	"webp": "image/webp",
+}
+
+// Format 返回顯示用的格式名稱，例如 "GIF（動態）"
+func (m *ImageMeta) Format() string {
+	name := strings.ToUpper(strings.TrimPrefix(m.ContentType, "image/"))
+	if name == "WEBP" {
+		name = "WebP"
+	}
+	if m.Animated {
+		name += "（動態）"
+	}
+	return name
+}
+
+// LocalBlob 返回圖片在本機的檔案：上傳的檔案或目前網址的鏡像，沒有時返回 nil
+func (img ImageData) LocalBlob() *BlobRef {
+	if img.Blob != nil {
+		return img.Blob
+	}
+	if img.Mirror.Available() && img.Mirror.URL == img.URL {
+		return img.Mirror.Blob
+	}
+	return nil
+}
+
+// Meta 讀取檔案的尺寸與是否為動態圖片
+func (b *BlobStore) Meta(ref *BlobRef) (*ImageMeta, error) {
+	f, err := b.Open(ref)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	meta := &ImageMeta{
+		ContentType: ref.ContentType,
+		Width:       config.Width,
+		Height:      config.Height,
+		Size:        ref.Size,
+		Hash:        ref.Hash,
+	}
+	switch ref.ContentType {
+	case "image/gif":
+		meta.Animated, err = gifAnimated(bufio.NewReader(f))
+	case "image/webp":
+		meta.Animated, err = webpAnimated(f)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// Analyze 讀取檔案的圖片資訊與感知雜湊，無法解碼時分別返回 nil 與 0
+func (b *BlobStore) Analyze(ref *BlobRef) (*ImageMeta, uint64) {
+	meta, err := b.Meta(ref)
+	if err != nil {
+		fmt.Printf("讀取圖片檔案 %s 的資訊失敗: %v\n", ref.Hash, err)
+	}
+	phash, _ := b.PerceptualHash(ref)
+	return meta, phash
+}
+
+// gifAnimated 逐一略過 GIF 的區塊並計算影像的數量，不需要解碼像素
+func gifAnimated(r *bufio.Reader) (bool, error) {
+	var header [13]byte // 簽章（6）與邏輯螢幕描述（7）
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return false, err
+	}
+	if err := skipColorTable(r, header[10]); err != nil {
+		return false, err
+	}
+
+	frames := 0
+	for {
+		introducer, err := r.ReadByte()
+		if err != nil {
+			return false, err
+		}
+		switch introducer {
+		case 0x21: // 擴充區塊：標籤後接資料子區塊
+			if _, err := r.ReadByte(); err != nil {
+				return false, err
+			}
+			if err := skipSubBlocks(r); err != nil {
+				return false, err
+			}
+		case 0x2C: // 影像描述
+			if frames++; frames > 1 {
+				return true, nil
+			}
+			var desc [9]byte
+			if _, err := io.ReadFull(r, desc[:]); err != nil {
+				return false, err
+			}
+			if err := skipColorTable(r, desc[8]); err != nil {
+				return false, err
+			}
+			if _, err := r.ReadByte(); err != nil { // LZW 最小編碼長度
+				return false, err
+			}
+			if err := skipSubBlocks(r); err != nil {
+				return false, err
+			}
+		case 0x3B: // 結尾
+			return false, nil
+		default:
+			return false, fmt.Errorf("無效的 GIF 區塊 0x%02x", introducer)
+		}
+	}
+}
+
+// skipColorTable 依旗標略過 GIF 的色彩表
+func skipColorTable(r *bufio.Reader, flags byte) error {
+	if flags&0x80 == 0 {
+		return nil
+	}
+	_, err := r.Discard(3 << ((flags & 0x07) + 1))
+	return err
+}
+
+// skipSubBlocks 略過以長度為 0 的子區塊結尾的資料
+func skipSubBlocks(r *bufio.Reader) error {
+	for {
+		n, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		if _, err := r.Discard(int(n)); err != nil {
+			return err
+		}
+	}
+}
+
+// webpAnimated 讀取 WebP 的 VP8X 區塊，動態圖片會設定其中的動畫旗標
+func webpAnimated(r io.Reader) (bool, error) {
+	var header [21]byte // RIFF 標頭（12）、第一個區塊的類型與長度（8）與 VP8X 的旗標（1）
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return false, err
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WEBP" {
+		return false, fmt.Errorf("無效的 WebP 檔案")
+	}
+	if string(header[12:16]) != "VP8X" || binary.LittleEndian.Uint32(header[16:20]) < 10 {
+		return false, nil // 簡單格式的 WebP 只有一格
+	}
+	return header[20]&0x02 != 0, nil
+}
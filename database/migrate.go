@@ -0,0 +1,50 @@
+package database
+
+// CurrentSchemaVersion 是 JSON 圖庫目前的資料格式版本
+const CurrentSchemaVersion = 3
+
+// upgrades 依序列出 JSON 圖庫的格式升級，第 n 個元素把版本 n 升級到 n+1
+// 升級在載入時於記憶體中進行，下次保存時才寫回檔案；已發佈的升級不可修改，只能在後面追加
+var upgrades = []func(db *ImageDB){
+	// 版本 1：把每張圖片的分類轉為標籤，分類編號與圖片ID維持不變，舊的ID仍然可以使用
+	func(db *ImageDB) {
+		names := make(map[string]string, len(db.Categories))
+		for name, code := range db.Categories {
+			names[code] = name
+		}
+		for key, img := range db.Images {
+			name, ok := names[img.Category]
+			if !ok || img.Category == UncategorizedCode {
+				continue
+			}
+			img.Tags = addTags(img.Tags, name)
+			db.Images[key] = img
+		}
+	},
+	// 版本 2：修正重複或格式錯誤的分類編號與圖片ID，並以目前最大的編號初始化序號
+	func(db *ImageDB) {
+		repairIDs(db)
+	},
+	// 版本 3：既有的ID成為永久ID，顯示代碼從與ID相同開始
+	func(db *ImageDB) {
+		for key, img := range db.Images {
+			if img.Code == "" {
+				img.Code = img.ID
+				db.Images[key] = img
+			}
+		}
+	},
+}
+
+// upgrade 將舊版格式的數據庫升級到目前的版本，返回是否有升級
+// 必須在建立索引之前呼叫
+func (db *ImageDB) upgrade() bool {
+	if db.SchemaVersion >= len(upgrades) {
+		return false
+	}
+	for v := db.SchemaVersion; v < len(upgrades); v++ {
+		upgrades[v](db)
+	}
+	db.SchemaVersion = len(upgrades)
+	return true
+}
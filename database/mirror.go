@@ -0,0 +1,237 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 鏡像的狀態
+const (
+	MirrorOK     = "ok"     // 已下載到本機
+	MirrorFailed = "failed" // 下載失敗，稍後會再重試
+)
+
+// Mirror 記錄圖片網址在本機的鏡像，建立後不可修改（快照之間會共用）
+type Mirror struct {
+	URL       string    `json:"url"`                // 鏡像的來源網址，圖片網址改變後會重新鏡像
+	Status    string    `json:"status"`             // MirrorOK 或 MirrorFailed
+	Blob      *BlobRef  `json:"blob,omitempty"`     // 下載的檔案，包含內容雜湊與格式
+	Location  string    `json:"location,omitempty"` // 檔案在 BlobStore 中的相對路徑
+	Error     string    `json:"error,omitempty"`    // 最近一次失敗的原因
+	Attempts  int       `json:"attempts,omitempty"` // 連續失敗的次數
+	CheckedAt time.Time `json:"checked_at"`         // 最近一次下載的時間
+}
+
+// Available 返回鏡像的檔案是否可以使用
+func (m *Mirror) Available() bool {
+	return m != nil && m.Status == MirrorOK && m.Blob != nil
+}
+
+const (
+	// mirrorBatchSize 是每一輪最多下載的圖片數量，避免一次對外發出太多請求
+	mirrorBatchSize = 50
+	// mirrorMaxRetryDelay 是下載失敗後重試間隔的上限
+	mirrorMaxRetryDelay = 24 * time.Hour
+)
+
+// needsMirror 返回圖片是否需要（重新）下載鏡像
+func needsMirror(img ImageData, now time.Time) bool {
+	if img.URL == "" {
+		return false
+	}
+	m := img.Mirror
+	if m == nil || m.URL != img.URL {
+		return true
+	}
+	if m.Status == MirrorOK {
+		return false
+	}
+	// 失敗後以指數增加的間隔重試：1 小時、2 小時、4 小時……最多 24 小時
+	delay := mirrorMaxRetryDelay
+	// attempts 省略時為 0，視為失敗一次，避免負數的位移
+	if attempts := max(m.Attempts, 1); attempts < 6 {
+		delay = time.Hour << (attempts - 1)
+	}
+	return now.Sub(m.CheckedAt) >= delay
+}
+
+// Mirrorer 在背景把圖庫中的圖片網址下載到 BlobStore，原始網址失效時仍可使用本機的檔案
+// 只處理 Registry 中已開啟的圖庫，尚未使用過的伺服器圖庫會在開啟後的下一輪處理
+type Mirrorer struct {
+	registry *Registry
+	blobs    *BlobStore
+	client   *http.Client
+	maxSize  int64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewMirrorer 建立 Mirrorer，maxSize 是單一檔案的大小上限（位元組）
+func NewMirrorer(registry *Registry, blobs *BlobStore, maxSize int64) *Mirrorer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Mirrorer{
+		registry: registry,
+		blobs:    blobs,
+		client:   NewPublicClient(30 * time.Second),
+		maxSize:  maxSize,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Start 啟動背景 goroutine，立即執行一輪之後每隔 interval 執行一次
+func (m *Mirrorer) Start(interval time.Duration) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			m.RunOnce()
+			select {
+			case <-ticker.C:
+			case <-m.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop 中斷進行中的下載並等待背景 goroutine 結束
+func (m *Mirrorer) Stop() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// RunOnce 為每個已開啟的圖庫下載需要鏡像的圖片，並補上已有本機檔案但缺少資訊的圖片（尚未開啟的圖庫不會被開啟）
+func (m *Mirrorer) RunOnce() {
+	libs := m.registry.Opened()
+	scopes := make([]string, 0, len(libs))
+	for scope := range libs {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+
+	for _, scope := range scopes {
+		if err := m.analyzeLocal(libs[scope]); err != nil && !errors.Is(err, ErrClosed) {
+			fmt.Printf("保存圖庫 %q 的圖片資訊失敗: %v\n", scope, err)
+		}
+	}
+
+	remaining := mirrorBatchSize
+	for _, scope := range scopes {
+		now := time.Now()
+		for _, img := range libs[scope].Snapshot().AllImages() {
+			if remaining == 0 || m.ctx.Err() != nil {
+				return
+			}
+			if !needsMirror(img, now) {
+				continue
+			}
+			remaining--
+			if err := m.mirror(libs[scope], img); err != nil && !errors.Is(err, ErrClosed) {
+				fmt.Printf("保存圖片 %q 的鏡像狀態失敗: %v\n", img.Name, err)
+			}
+		}
+	}
+}
+
+// analyzeLocal 為已有本機檔案但還沒有 Meta 的圖片（例如在記錄圖片資訊之前加入的）讀取資訊
+// 只讀取本機的檔案，不會發出網路請求
+func (m *Mirrorer) analyzeLocal(lib *Library) error {
+	type result struct {
+		meta  *ImageMeta
+		phash uint64
+		blob  *BlobRef
+	}
+	results := make(map[string]result)
+	for _, img := range lib.Snapshot().AllImages() {
+		if ref := img.LocalBlob(); ref != nil && img.Meta == nil {
+			if meta, phash := m.blobs.Analyze(ref); meta != nil {
+				results[img.ID] = result{meta, phash, ref}
+			}
+		}
+	}
+	if len(results) == 0 {
+		return nil
+	}
+
+	return lib.Transact(func(db *ImageDB) error {
+		for id, r := range results {
+			img, ok := db.ImageByID(id)
+			if !ok || img.LocalBlob() != r.blob {
+				continue // 讀取期間圖片已被刪除或更換檔案
+			}
+			img.Meta = r.meta
+			if img.PHash == 0 {
+				img.PHash = r.phash
+			}
+			db.ReplaceImage(id, img)
+		}
+		return nil
+	})
+}
+
+// mirror 下載單張圖片並記錄結果
+func (m *Mirrorer) mirror(lib *Library, img ImageData) error {
+	ref, fetchErr := m.fetch(img.URL)
+	if m.ctx.Err() != nil {
+		return nil // 正在關閉，不記錄被中斷的下載
+	}
+	var meta *ImageMeta
+	var phash uint64
+	if fetchErr == nil {
+		meta, phash = m.blobs.Analyze(ref)
+	}
+
+	return lib.Transact(func(db *ImageDB) error {
+		current, ok := db.ImageByID(img.ID)
+		if !ok || current.URL != img.URL {
+			return nil // 下載期間圖片已被刪除或修改網址
+		}
+
+		mirror := &Mirror{URL: img.URL, CheckedAt: time.Now()}
+		if fetchErr != nil {
+			mirror.Status = MirrorFailed
+			mirror.Error = fetchErr.Error()
+			mirror.Attempts = 1
+			if prev := current.Mirror; prev != nil && prev.URL == img.URL {
+				mirror.Attempts = prev.Attempts + 1
+			}
+		} else {
+			mirror.Status = MirrorOK
+			mirror.Blob = ref
+			mirror.Location = m.blobs.Location(ref)
+			// 網址可能換成了另一張圖片，以新下載的檔案為準
+			current.Meta = meta
+			current.PHash = phash
+		}
+		current.Mirror = mirror
+		db.ReplaceImage(current.ID, current)
+		return nil
+	})
+}
+
+// fetch 下載網址的內容並存入 BlobStore
+func (m *Mirrorer) fetch(url string) (*BlobRef, error) {
+	req, err := http.NewRequestWithContext(m.ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("伺服器回應 %s", resp.Status)
+	}
+	return m.blobs.PutImage(resp.Body, m.maxSize)
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNeedsMirrorBackoff(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		mirror *Mirror
+		want   bool
+	}{
+		{"尚未鏡像", nil, true},
+		{"網址已改變", &Mirror{URL: "https://example.com/old.png", Status: MirrorOK, CheckedAt: now}, true},
+		{"已鏡像", &Mirror{URL: "https://example.com/a.png", Status: MirrorOK, CheckedAt: now}, false},
+		{"剛失敗", &Mirror{URL: "https://example.com/a.png", Status: MirrorFailed, Attempts: 1, CheckedAt: now.Add(-30 * time.Minute)}, false},
+		{"失敗後一小時", &Mirror{URL: "https://example.com/a.png", Status: MirrorFailed, Attempts: 1, CheckedAt: now.Add(-time.Hour)}, true},
+		{"沒有記錄次數", &Mirror{URL: "https://example.com/a.png", Status: MirrorFailed, CheckedAt: now.Add(-time.Hour)}, true},
+	}
+	for _, tt := range tests {
+		img := ImageData{URL: "https://example.com/a.png", Mirror: tt.mirror}
+		if got := needsMirror(img, now); got != tt.want {
+			t.Errorf("%s：needsMirror() = %v，預期 %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// 尚未開啟的圖庫不會被鏡像，開啟之後的下一輪才會處理
+func TestMirrorerOnlyOpenedScopes(t *testing.T) {
+	dir := t.TempDir()
+	data := testPNG(t, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+
+	err := SaveDatabase(filepath.Join(dir, "closed.json"), &ImageDB{
+		Images: map[string]ImageData{"a": {ID: "00001", Name: "a", Category: UncategorizedCode, URL: srv.URL + "/a.png"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs, err := OpenBlobStore(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := newTestRegistry(t, dir)
+	m := NewMirrorer(registry, blobs, 1<<20)
+	m.client = srv.Client() // 測試伺服器在本機，預設的客戶端會拒絕連線
+
+	m.RunOnce()
+	if _, ok := registry.Opened()["closed"]; ok {
+		t.Fatal("鏡像時不應開啟尚未使用的圖庫")
+	}
+	err = registry.View("closed", func(db *ImageDB) error {
+		if img, _ := db.ImageByID("00001"); img.Mirror != nil {
+			t.Error("尚未開啟的圖庫被鏡像")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lib, err := registry.Library("closed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.RunOnce()
+	img, err := lib.GetByID("00001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !img.Mirror.Available() {
+		t.Errorf("開啟後沒有鏡像圖片：%+v", img.Mirror)
+	}
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math/bits"
+
+	// 註冊圖片解碼器，與 BlobStore 接受的格式相同
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+// MaxImagePixels 是 DecodeImage 願意解碼的像素數量上限
+// 高度壓縮的小檔案可能宣告極大的尺寸，完整解碼會用盡記憶體
+const MaxImagePixels = 40_000_000
+
+// ErrImageTooLarge 表示圖片的尺寸超過 MaxImagePixels
+var ErrImageTooLarge = errors.New("圖片尺寸太大")
+
+// DecodeImage 先讀取圖片標頭檢查尺寸，不超過 MaxImagePixels 時才解碼整張圖片
+func DecodeImage(r io.Reader) (image.Image, error) {
+	// 記錄讀取標頭時消耗的內容，解碼時再接回去，因此 r 不需要支援 Seek
+	var head bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(r, &head))
+	if err != nil {
+		return nil, err
+	}
+	if int64(config.Width)*int64(config.Height) > MaxImagePixels {
+		return nil, fmt.Errorf("%w（%d×%d）", ErrImageTooLarge, config.Width, config.Height)
+	}
+	img, _, err := image.Decode(io.MultiReader(&head, r))
+	return img, err
+}
+
+// PerceptualHash 計算圖片的差異雜湊（dHash）：縮小成 9×8 的灰階後比較左右相鄰的亮度
+// 同一張圖片重新壓縮或縮放後雜湊值幾乎不變，以 HammingDistance 比較相似程度
+// 尺寸超過 MaxImagePixels 的圖片返回 ErrImageTooLarge
+func PerceptualHash(r io.Reader) (uint64, error) {
+	img, err := DecodeImage(r)
+	if err != nil {
+		return 0, err
+	}
+
+	const w, h = 9, 8
+	var gray [h][w]float64
+	b := img.Bounds()
+	for y := 0; y < h; y++ {
+		y0, y1 := cell(b.Min.Y, b.Dy(), y, h)
+		for x := 0; x < w; x++ {
+			x0, x1 := cell(b.Min.X, b.Dx(), x, w)
+			// 以區塊內所有像素的平均亮度縮小，避免只取樣單一像素造成的誤差
+			var sum float64
+			for py := y0; py < y1; py++ {
+				for px := x0; px < x1; px++ {
+					r, g, b, _ := img.At(px, py).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+				}
+			}
+			gray[y][x] = sum / float64((y1-y0)*(x1-x0))
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			hash <<= 1
+			if gray[y][x] < gray[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash, nil
+}
+
+// cell 返回把長度 size 分成 n 等份後第 i 份的範圍，圖片比格子小時每份至少包含一個像素
+func cell(min, size, i, n int) (int, int) {
+	start := min + i*size/n
+	end := min + (i+1)*size/n
+	if end <= start {
+		end = start + 1
+	}
+	if end > min+size {
+		start, end = min+size-1, min+size
+	}
+	return start, end
+}
+
+// HammingDistance 返回兩個雜湊值不同的位元數，0 表示完全相同
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// PerceptualHash 計算 BlobStore 中檔案的感知雜湊
+func (b *BlobStore) PerceptualHash(ref *BlobRef) (uint64, error) {
+	f, err := b.Open(ref)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return PerceptualHash(f)
+}
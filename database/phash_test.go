@@ -0,0 +1,61 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// pngHeader 返回只有檔頭與 IHDR 區塊、宣告尺寸為 width×height 的 PNG
+func pngHeader(width, height uint32) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	data := make([]byte, 13)
+	binary.BigEndian.PutUint32(data[0:], width)
+	binary.BigEndian.PutUint32(data[4:], height)
+	data[8], data[9] = 8, 2 // 8 位元 RGB
+	chunk := append([]byte("IHDR"), data...)
+	binary.Write(&buf, binary.BigEndian, uint32(len(data)))
+	buf.Write(chunk)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	return buf.Bytes()
+}
+
+func TestDecodeImageRejectsOversized(t *testing.T) {
+	_, err := DecodeImage(bytes.NewReader(pngHeader(50000, 50000)))
+	if !errors.Is(err, ErrImageTooLarge) {
+		t.Fatalf("DecodeImage 的錯誤 = %v，預期 ErrImageTooLarge", err)
+	}
+	if _, err := PerceptualHash(bytes.NewReader(pngHeader(50000, 50000))); !errors.Is(err, ErrImageTooLarge) {
+		t.Fatalf("PerceptualHash 的錯誤 = %v，預期 ErrImageTooLarge", err)
+	}
+}
+
+func TestDecodeImage(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	for x := 0; x < 32; x++ {
+		for y := 0; y < 16; y++ {
+			src.Set(x, y, color.RGBA{uint8(x * 8), uint8(y * 16), 0, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := DecodeImage(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != src.Bounds() {
+		t.Errorf("解碼後的尺寸 = %v，預期 %v", img.Bounds(), src.Bounds())
+	}
+	if got, want := img.At(20, 10), src.At(20, 10); got != want {
+		t.Errorf("解碼後的像素 = %v，預期 %v", got, want)
+	}
+}
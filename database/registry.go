@@ -0,0 +1,162 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// GlobalScope 是共用的全域圖庫範圍，其他範圍以伺服器ID命名
+const GlobalScope = "global"
+
+// Registry 管理每個範圍（伺服器）各自的 Library，第一次使用時才開啟
+type Registry struct {
+	open   func(scope string) (Backend, error)
+	scopes func() ([]string, error) // 列出持久化層中所有的範圍，可為 nil
+	closer io.Closer                // 所有圖庫關閉後要一併關閉的共用資源，可為 nil
+
+	mu   sync.Mutex
+	libs map[string]*Library
+}
+
+// NewRegistry 建立 Registry，open 負責為指定範圍建立持久化層，
+// scopes（可為 nil）列出持久化層中所有的範圍，包含尚未開啟的，
+// closer（可為 nil）會在 Close 時於所有圖庫保存完畢後關閉
+func NewRegistry(open func(scope string) (Backend, error), scopes func() ([]string, error), closer io.Closer) *Registry {
+	return &Registry{
+		open:   open,
+		scopes: scopes,
+		closer: closer,
+		libs:   make(map[string]*Library),
+	}
+}
+
+// Library 返回 scope 的圖庫，尚未開啟時會先從持久化層讀取
+func (r *Registry) Library(scope string) (*Library, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if lib, ok := r.libs[scope]; ok {
+		return lib, nil
+	}
+
+	backend, err := r.open(scope)
+	if err != nil {
+		return nil, err
+	}
+	lib, err := OpenLibrary(backend)
+	if err != nil {
+		return nil, err
+	}
+	r.libs[scope] = lib
+	return lib, nil
+}
+
+// Opened 返回目前已開啟的圖庫（範圍 → 圖庫）
+func (r *Registry) Opened() map[string]*Library {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	libs := make(map[string]*Library, len(r.libs))
+	for scope, lib := range r.libs {
+		libs[scope] = lib
+	}
+	return libs
+}
+
+// Scopes 返回持久化層中所有的範圍與已開啟的範圍，依名稱排序
+func (r *Registry) Scopes() ([]string, error) {
+	set := make(map[string]bool)
+	if r.scopes != nil {
+		scopes, err := r.scopes()
+		if err != nil {
+			return nil, err
+		}
+		for _, scope := range scopes {
+			set[scope] = true
+		}
+	}
+	for scope := range r.Opened() {
+		set[scope] = true
+	}
+	scopes := make([]string, 0, len(set))
+	for scope := range set {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	return scopes, nil
+}
+
+// View 以唯讀的方式讀取 scope 的圖庫；尚未開啟的圖庫直接從持久化層讀取一份，不會因此開啟
+func (r *Registry) View(scope string, fn func(db *ImageDB) error) error {
+	r.mu.Lock()
+	lib, ok := r.libs[scope]
+	r.mu.Unlock()
+	if ok {
+		return lib.View(fn)
+	}
+
+	backend, err := r.open(scope)
+	if err != nil {
+		return err
+	}
+	db, err := backend.Load()
+	if err != nil {
+		return err
+	}
+	db.ensureMaps()
+	return fn(db)
+}
+
+// Transact 修改 scope 的圖庫；尚未開啟的圖庫直接在持久化層上修改，不會因此開啟
+// 修改期間會暫停開啟圖庫，避免同時從兩處寫入同一個範圍
+func (r *Registry) Transact(scope string, fn func(db *ImageDB) error) error {
+	r.mu.Lock()
+	lib, ok := r.libs[scope]
+	if ok {
+		r.mu.Unlock()
+		return lib.Transact(fn)
+	}
+	defer r.mu.Unlock()
+
+	backend, err := r.open(scope)
+	if err != nil {
+		return err
+	}
+	old, err := backend.Load()
+	if err != nil {
+		return err
+	}
+	old.ensureMaps()
+	next := old.Clone()
+	if err := fn(next); err != nil {
+		return err
+	}
+	changes := diff(old, next)
+	if len(changes) == 0 {
+		return nil
+	}
+	return backend.Persist(next, changes)
+}
+
+// Close 保存並關閉所有已開啟的圖庫，有圖庫最後仍無法保存時返回錯誤
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var errs []error
+	for scope, lib := range r.libs {
+		if err := lib.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("圖庫 %q 有尚未保存的修改: %w", scope, err))
+		}
+		delete(r.libs, scope)
+	}
+	if r.closer != nil {
+		if err := r.closer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
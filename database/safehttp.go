@@ -0,0 +1,65 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress 表示網址指向本機或內部網路，不允許下載
+var ErrForbiddenAddress = errors.New("不允許連線到本機或內部網路的位址")
+
+// sharedAddressSpace 是電信業者級 NAT 使用的位址（RFC 6598），與私有位址相同不應從外部連線
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// NewPublicClient 返回只能連線到公開網址的 http.Client，用於下載或檢查使用者提供的網址
+// 只接受 http 與 https（包含轉址），並在連線時檢查解析後的 IP，
+// 因此網址或 DNS 指向本機、私有或鏈路本地位址時都會返回 ErrForbiddenAddress
+func NewPublicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if !publicAddr(addr) {
+				return fmt.Errorf("%w：%s", ErrForbiddenAddress, addr)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // 經過代理伺服器時連線的是代理的位址，無法檢查目標
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: schemeChecker{transport},
+	}
+}
+
+// publicAddr 返回位址是否可以從公開網路連線
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// schemeChecker 拒絕 http 與 https 以外的網址，轉址的每一個請求也會經過檢查
+type schemeChecker struct {
+	next http.RoundTripper
+}
+
+func (c schemeChecker) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return nil, fmt.Errorf("不支援的網址類型 %q", req.URL.Scheme)
+	}
+	return c.next.RoundTrip(req)
+}
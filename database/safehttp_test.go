@@ -0,0 +1,52 @@
+package database
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"0.0.0.0", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"100.64.0.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"::ffff:127.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := publicAddr(netip.MustParseAddr(tt.addr)); got != tt.public {
+			t.Errorf("publicAddr(%s) = %v，預期 %v", tt.addr, got, tt.public)
+		}
+	}
+}
+
+func TestPublicClientRejectsLoopback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(srv.Close)
+
+	_, err := NewPublicClient(5 * time.Second).Get(srv.URL)
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("連線到 %s 的錯誤 = %v，預期 ErrForbiddenAddress", srv.URL, err)
+	}
+}
+
+func TestPublicClientRejectsScheme(t *testing.T) {
+	if _, err := NewPublicClient(5 * time.Second).Get("file:///etc/passwd"); err == nil {
+		t.Error("預期拒絕 file 網址")
+	}
+}
@@ -0,0 +1,193 @@
+package database
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SearchResult 是一筆搜尋結果，Score 介於 0 到 1 之間，越高越相符
+type SearchResult struct {
+	Image ImageData
+	Score float64
+}
+
+// 各種比對方式的分數上限，完全相符 > ID前綴 > 名稱前綴 > 子字串 > 編輯距離 / 字詞重疊
+const (
+	scoreExact     = 1.0
+	scoreIDPrefix  = 0.9
+	scorePrefix    = 0.85
+	scoreSubstring = 0.75
+	scoreFuzzy     = 0.7
+
+	// minSearchScore 以下的候選不列入結果
+	minSearchScore = 0.4
+)
+
+// RankedSearch 為每張圖片評分，返回依分數由高到低（同分時依ID）排序的結果
+// 評分綜合名稱、別名或ID完全相符、前綴、子字串、編輯距離與字詞重疊；limit <= 0 表示不限制數量
+func (db *ImageDB) RankedSearch(query string, limit int) []SearchResult {
+	db.ensureIndex()
+	q := NormalizeName(query)
+	if q == "" {
+		return nil
+	}
+	qRunes := []rune(q)
+	qTokens := tokenize(q)
+
+	// 名稱與每個別名分別評分，每張圖片取最高分
+	best := make(map[string]float64)
+	for name, ids := range db.byName {
+		nameScore := scoreName(q, qRunes, qTokens, name)
+		for _, id := range ids {
+			score := nameScore
+			if s := scoreID(query, id); s > score {
+				score = s
+			}
+			if code := db.Images[db.byID[id]].Code; code != "" && code != id {
+				if s := scoreID(query, code); s > score {
+					score = s
+				}
+			}
+			if score > best[id] {
+				best[id] = score
+			}
+		}
+	}
+
+	var results []SearchResult
+	for id, score := range best {
+		if score >= minSearchScore {
+			results = append(results, SearchResult{Image: db.Images[db.byID[id]], Score: score})
+		}
+	}
+
+	SortResults(results)
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// SortResults 依分數由高到低排序，同分時依ID排序，讓結果固定
+func SortResults(results []SearchResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Image.ID < results[j].Image.ID
+	})
+}
+
+// scoreID 比對圖片ID或顯示代碼，只有完全相符或前綴兩種情況
+func scoreID(query, id string) float64 {
+	query = strings.TrimSpace(query)
+	switch {
+	case query == id:
+		return scoreExact
+	case query != "" && strings.HasPrefix(id, query):
+		return scoreIDPrefix * float64(len(query)) / float64(len(id))
+	}
+	return 0
+}
+
+// scoreName 比對正規化後的查詢與名稱
+func scoreName(q string, qRunes []rune, qTokens []string, name string) float64 {
+	if q == name {
+		return scoreExact
+	}
+
+	nameRunes := []rune(name)
+	// 涵蓋比例越高（查詢越接近完整名稱）分數越高
+	coverage := float64(len(qRunes)) / float64(len(nameRunes))
+	if coverage > 1 {
+		coverage = 1
+	}
+
+	if strings.HasPrefix(name, q) {
+		return scorePrefix * (0.5 + 0.5*coverage)
+	}
+	if strings.Contains(name, q) {
+		return scoreSubstring * (0.5 + 0.5*coverage)
+	}
+
+	best := 0.0
+	// 編輯距離：允許錯字與漏字
+	longest := len(qRunes)
+	if len(nameRunes) > longest {
+		longest = len(nameRunes)
+	}
+	if sim := 1 - float64(levenshtein(qRunes, nameRunes))/float64(longest); sim > 0 {
+		best = scoreFuzzy * sim
+	}
+	// 字詞重疊：順序不同或只記得部分字詞
+	if overlap := tokenOverlap(qTokens, tokenize(name)); scoreFuzzy*overlap > best {
+		best = scoreFuzzy * overlap
+	}
+	return best
+}
+
+// tokenize 將名稱切成字詞，中日韓文字沒有空白分隔，因此每個字視為一個字詞
+func tokenize(s string) []string {
+	var tokens []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+			word = word[:0]
+		}
+	}
+	for _, r := range s {
+		switch {
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+			unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r):
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word = append(word, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return tokens
+}
+
+// tokenOverlap 返回查詢的字詞中有多少比例出現在名稱中
+func tokenOverlap(query, name []string) float64 {
+	if len(query) == 0 {
+		return 0
+	}
+	set := make(map[string]bool, len(name))
+	for _, t := range name {
+		set[t] = true
+	}
+	hit := 0
+	for _, t := range query {
+		if set[t] {
+			hit++
+		}
+	}
+	return float64(hit) / float64(len(query))
+}
+
+// levenshtein 計算兩個字串（以字元為單位）的編輯距離
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRankedSearch(t *testing.T) {
+	db := &ImageDB{}
+	for _, img := range []ImageData{
+		{ID: "00001", Name: "Happy Cat"},
+		{ID: "00002", Name: "cat"},
+		{ID: "00003", Name: "Category Chart"},
+		{ID: "00004", Name: "貓咪跳舞"},
+		{ID: "00005", Name: "dog", Aliases: []string{"puppy"}},
+		{ID: "00006", Name: "moved", Code: "01001"},
+	} {
+		img.Category = UncategorizedCode
+		if err := db.AddImage(img); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		limit int
+		want  []string // 依序預期的圖片ID
+	}{
+		{"cat", 0, []string{"00002", "00003", "00001"}}, // 完全相符 > 前綴 > 子字串
+		{"hapy cat", 1, []string{"00001"}},              // 錯字
+		{"cat happy", 1, []string{"00001"}},             // 字詞順序不同
+		{"PUPPY", 0, []string{"00005"}},                 // 別名
+		{"跳舞", 0, []string{"00004"}},
+		{"00004", 1, []string{"00004"}},
+		{"0000", 3, []string{"00001", "00002", "00003"}}, // ID前綴同分時依ID排序
+		{"01001", 1, []string{"00006"}},                  // 顯示代碼
+		{"", 0, nil},
+		{"zzzzzz", 0, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, r := range db.RankedSearch(tt.query, tt.limit) {
+			got = append(got, r.Image.ID)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("RankedSearch(%q, %d) = %v，預期 %v", tt.query, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"cat", "", 3},
+		{"cat", "cat", 0},
+		{"cat", "cut", 1},
+		{"happy", "hapy", 1},
+		{"kitten", "sitting", 3},
+		{"貓咪", "貓", 1},
+	}
+	for _, tt := range tests {
+		if got := levenshtein([]rune(tt.a), []rune(tt.b)); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d，預期 %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
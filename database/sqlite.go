@@ -0,0 +1,755 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // 純 Go 的 SQLite 驅動，不需要 cgo
+)
+
+// SQLiteStore 是以 SQLite 資料庫保存圖庫的 Store 實作
+// 同一個資料庫檔案保存所有範圍（伺服器）的圖庫，每個 SQLiteStore 只存取其中一個範圍
+type SQLiteStore struct {
+	db    *sql.DB
+	scope string
+}
+
+// OpenSQLiteStore 開啟（或建立）filePath 的 SQLite 資料庫，並執行尚未套用的遷移
+// 返回的 SQLiteStore 存取全域圖庫，其他範圍請使用 Scope
+func OpenSQLiteStore(filePath string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", filePath)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite 同一時間只允許一個寫入者，使用單一連線避免 "database is locked"
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteStore{db: db, scope: GlobalScope}, nil
+}
+
+// Scope 返回共用同一個資料庫連線、但只存取 scope 圖庫的 SQLiteStore
+func (s *SQLiteStore) Scope(scope string) *SQLiteStore {
+	return &SQLiteStore{db: s.db, scope: scope}
+}
+
+// Close 關閉共用的資料庫連線，所有範圍的 SQLiteStore 都會一併失效
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// imageSelect 讀取圖片的欄位，標籤與別名以依字母排序的 JSON 陣列一併讀出
+const imageSelect = `SELECT id, name, url, category, code, blob_hash, blob_type, blob_size, mirror, health, phash, meta,
+	(SELECT json_group_array(tag) FROM (
+		SELECT tag FROM image_tags t WHERE t.scope = images.scope AND t.image_id = images.id ORDER BY tag
+	)),
+	(SELECT json_group_array(alias) FROM (
+		SELECT alias FROM image_aliases a WHERE a.scope = images.scope AND a.image_id = images.id ORDER BY alias
+	))
+	FROM images`
+
+// rowScanner 是 *sql.Row 與 *sql.Rows 共有的方法
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanImage(row rowScanner) (ImageData, error) {
+	var img ImageData
+	var tags, aliases, mirror, health, meta string
+	var phash int64
+	var blob BlobRef
+	if err := row.Scan(&img.ID, &img.Name, &img.URL, &img.Category, &img.Code, &blob.Hash, &blob.ContentType, &blob.Size, &mirror, &health, &phash, &meta, &tags, &aliases); err != nil {
+		return ImageData{}, err
+	}
+	if blob.Hash != "" {
+		img.Blob = &blob
+	}
+	if mirror != "" {
+		if err := json.Unmarshal([]byte(mirror), &img.Mirror); err != nil {
+			return ImageData{}, err
+		}
+	}
+	if health != "" {
+		if err := json.Unmarshal([]byte(health), &img.Health); err != nil {
+			return ImageData{}, err
+		}
+	}
+	img.PHash = uint64(phash)
+	if meta != "" {
+		if err := json.Unmarshal([]byte(meta), &img.Meta); err != nil {
+			return ImageData{}, err
+		}
+	}
+	if err := json.Unmarshal([]byte(tags), &img.Tags); err != nil {
+		return ImageData{}, err
+	}
+	if err := json.Unmarshal([]byte(aliases), &img.Aliases); err != nil {
+		return ImageData{}, err
+	}
+	// 與 JSON 圖庫一致，沒有標籤或別名時為 nil
+	if len(img.Tags) == 0 {
+		img.Tags = nil
+	}
+	if len(img.Aliases) == 0 {
+		img.Aliases = nil
+	}
+	return img, nil
+}
+
+// queryImages 執行查詢並讀出所有圖片
+func (s *SQLiteStore) queryImages(query string, args ...any) ([]ImageData, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []ImageData
+	for rows.Next() {
+		img, err := scanImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	return images, rows.Err()
+}
+
+// queryImage 執行查詢並讀出單張圖片，沒有結果時返回 ErrNotFound
+func (s *SQLiteStore) queryImage(query string, args ...any) (ImageData, error) {
+	img, err := scanImage(s.db.QueryRow(query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ImageData{}, ErrNotFound
+	}
+	return img, err
+}
+
+// withTx 在交易中執行 fn，fn 返回錯誤時回滾
+func (s *SQLiteStore) withTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// putImage 寫入圖片與其標籤、別名，並移除同一範圍中其他同名的圖片（與 JSON 以名稱為鍵的行為一致）
+func putImage(tx *sql.Tx, scope string, img ImageData) error {
+	var sameName []string
+	rows, err := tx.Query("SELECT id FROM images WHERE scope = ? AND name = ? AND id <> ?", scope, img.Name, img.ID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		sameName = append(sameName, id)
+	}
+	rows.Close()
+	for _, id := range sameName {
+		if _, err := deleteImage(tx, scope, id); err != nil {
+			return err
+		}
+	}
+
+	var blob BlobRef
+	if img.Blob != nil {
+		blob = *img.Blob
+	}
+	var mirror, health, meta []byte
+	if img.Mirror != nil {
+		if mirror, err = json.Marshal(img.Mirror); err != nil {
+			return err
+		}
+	}
+	if img.Health != nil {
+		if health, err = json.Marshal(img.Health); err != nil {
+			return err
+		}
+	}
+	if img.Meta != nil {
+		if meta, err = json.Marshal(img.Meta); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(
+		"INSERT OR REPLACE INTO images (scope, id, name, name_key, url, category, code, blob_hash, blob_type, blob_size, mirror, health, phash, meta) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		scope, img.ID, img.Name, NormalizeName(img.Name), img.URL, img.Category, img.Code, blob.Hash, blob.ContentType, blob.Size, string(mirror), string(health), int64(img.PHash), string(meta),
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM image_tags WHERE scope = ? AND image_id = ?", scope, img.ID); err != nil {
+		return err
+	}
+	for _, tag := range img.Tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO image_tags (scope, image_id, tag) VALUES (?, ?, ?)", scope, img.ID, tag); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM image_aliases WHERE scope = ? AND image_id = ?", scope, img.ID); err != nil {
+		return err
+	}
+	for _, alias := range img.Aliases {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO image_aliases (scope, image_id, alias, alias_key) VALUES (?, ?, ?, ?)", scope, img.ID, alias, NormalizeName(alias)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteImage 刪除圖片與其標籤、別名，返回刪除的圖片數量
+func deleteImage(tx *sql.Tx, scope, id string) (int64, error) {
+	if _, err := tx.Exec("DELETE FROM image_tags WHERE scope = ? AND image_id = ?", scope, id); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM image_aliases WHERE scope = ? AND image_id = ?", scope, id); err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec("DELETE FROM images WHERE scope = ? AND id = ?", scope, id)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// putCategory 寫入分類名稱與編號的對應
+func putCategory(tx *sql.Tx, scope, name, code string) error {
+	_, err := tx.Exec("INSERT OR REPLACE INTO categories (scope, name, code) VALUES (?, ?, ?)", scope, name, code)
+	return err
+}
+
+// putCategoryInfo 寫入分類的說明
+func putCategoryInfo(tx *sql.Tx, scope, code string, info CategoryInfo) error {
+	_, err := tx.Exec(
+		"INSERT OR REPLACE INTO category_info (scope, code, description, emoji) VALUES (?, ?, ?, ?)",
+		scope, code, info.Description, info.Emoji,
+	)
+	return err
+}
+
+// queryCategoryInfo 讀取範圍中所有分類的說明
+func queryCategoryInfo(q interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}, scope string) (map[string]CategoryInfo, error) {
+	rows, err := q.Query("SELECT code, description, emoji FROM category_info WHERE scope = ?", scope)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	infos := make(map[string]CategoryInfo)
+	for rows.Next() {
+		var code string
+		var info CategoryInfo
+		if err := rows.Scan(&code, &info.Description, &info.Emoji); err != nil {
+			return nil, err
+		}
+		infos[code] = info
+	}
+	return infos, rows.Err()
+}
+
+// putRedirect 寫入舊ID到永久ID的轉址
+func putRedirect(tx *sql.Tx, scope, oldID, id string) error {
+	_, err := tx.Exec("INSERT OR REPLACE INTO redirects (scope, old_id, image_id) VALUES (?, ?, ?)", scope, oldID, id)
+	return err
+}
+
+// putTrash 寫入回收桶中的圖片，刪除時間以 Unix 毫秒保存
+func putTrash(tx *sql.Tx, scope string, entry TrashedImage) error {
+	image, err := json.Marshal(entry.Image)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"INSERT OR REPLACE INTO trash (scope, image_id, image, deleted_at, deleted_by) VALUES (?, ?, ?, ?, ?)",
+		scope, entry.Image.ID, string(image), entry.DeletedAt.UnixMilli(), entry.DeletedBy,
+	)
+	return err
+}
+
+// putHistory 寫入圖片的完整版本紀錄
+func putHistory(tx *sql.Tx, scope, id string, revisions []Revision) error {
+	data, err := json.Marshal(revisions)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT OR REPLACE INTO image_history (scope, image_id, revisions) VALUES (?, ?, ?)", scope, id, string(data))
+	return err
+}
+
+// GetByID 永久ID優先，其次是顯示代碼，最後是舊ID的轉址
+func (s *SQLiteStore) GetByID(id string) (ImageData, error) {
+	return s.queryImage(
+		imageSelect+` WHERE scope = ? AND (id = ? OR code = ? OR id IN (
+			SELECT image_id FROM redirects WHERE scope = ? AND old_id = ?
+		)) ORDER BY id <> ?, code <> ? LIMIT 1`,
+		s.scope, id, id, s.scope, id, id, id,
+	)
+}
+
+// GetByName 以 NormalizeName 後的 name_key 與 alias_key 比對，與其他實作相同；
+// 名稱完全相同的圖片優先，其次依ID排序
+func (s *SQLiteStore) GetByName(name string) (ImageData, error) {
+	key := NormalizeName(name)
+	return s.queryImage(
+		imageSelect+` WHERE scope = ? AND (name_key = ? OR id IN (
+			SELECT image_id FROM image_aliases WHERE scope = ? AND alias_key = ?
+		)) ORDER BY name <> ?, id LIMIT 1`,
+		s.scope, key, s.scope, key, name,
+	)
+}
+
+func (s *SQLiteStore) Search(query string) ([]ImageData, error) {
+	// 使用 instr 而非 LIKE，避免 % 與 _ 被當成萬用字元；SQLite 的 lower 只處理 ASCII，因此比對正規化後的欄位
+	q := NormalizeName(query)
+	return s.queryImages(
+		imageSelect+` WHERE scope = ? AND (instr(name_key, ?) > 0 OR id IN (
+			SELECT image_id FROM image_aliases WHERE scope = ? AND instr(alias_key, ?) > 0
+		)) ORDER BY id`,
+		s.scope, q, s.scope, q,
+	)
+}
+
+// RankedSearch 模糊比對無法以 SQL 表達，因此讀出整個範圍後在記憶體中評分
+func (s *SQLiteStore) RankedSearch(query string, limit int) ([]SearchResult, error) {
+	db, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+	return db.RankedSearch(query, limit), nil
+}
+
+func (s *SQLiteStore) Add(img ImageData) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		for _, name := range append([]string{img.Name}, img.Aliases...) {
+			key := NormalizeName(name)
+			var owner ImageData
+			err := tx.QueryRow(
+				`SELECT id, name FROM images WHERE scope = ? AND (name_key = ? OR id IN (
+					SELECT image_id FROM image_aliases WHERE scope = ? AND alias_key = ?
+				)) ORDER BY id LIMIT 1`,
+				s.scope, key, s.scope, key,
+			).Scan(&owner.ID, &owner.Name)
+			if err == nil {
+				return nameTaken(name, owner)
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+		}
+		return putImage(tx, s.scope, img)
+	})
+}
+
+func (s *SQLiteStore) Delete(id string) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		n, err := deleteImage(tx, s.scope, id)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (s *SQLiteStore) Update(id string, img ImageData) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		if n, err := deleteImage(tx, s.scope, id); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		return putImage(tx, s.scope, img)
+	})
+}
+
+func (s *SQLiteStore) List() ([]ImageData, error) {
+	return s.queryImages(imageSelect+" WHERE scope = ? ORDER BY id", s.scope)
+}
+
+func (s *SQLiteStore) ListByCategory(categoryCode string) ([]ImageData, error) {
+	return s.queryImages(imageSelect+" WHERE scope = ? AND category = ? ORDER BY id", s.scope, categoryCode)
+}
+
+func (s *SQLiteStore) ListByTags(tags []string, matchAll bool) ([]ImageData, error) {
+	var normalized []string
+	for _, tag := range tags {
+		normalized = addTags(normalized, tag)
+	}
+	if len(normalized) == 0 {
+		return nil, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(normalized)), ", ")
+	query := imageSelect + " WHERE scope = ? AND id IN (SELECT image_id FROM image_tags WHERE scope = ? AND tag IN (" + placeholders + ") GROUP BY image_id"
+	args := []any{s.scope, s.scope}
+	for _, tag := range normalized {
+		args = append(args, tag)
+	}
+	if matchAll {
+		query += " HAVING COUNT(*) = ?"
+		args = append(args, len(normalized))
+	}
+	query += ") ORDER BY id"
+	return s.queryImages(query, args...)
+}
+
+func (s *SQLiteStore) Tags() (map[string]int, error) {
+	rows, err := s.db.Query("SELECT tag, COUNT(*) FROM image_tags WHERE scope = ? GROUP BY tag", s.scope)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make(map[string]int)
+	for rows.Next() {
+		var tag string
+		var n int
+		if err := rows.Scan(&tag, &n); err != nil {
+			return nil, err
+		}
+		tags[tag] = n
+	}
+	return tags, rows.Err()
+}
+
+func (s *SQLiteStore) Categories() (map[string]string, error) {
+	rows, err := s.db.Query("SELECT name, code FROM categories WHERE scope = ?", s.scope)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := make(map[string]string)
+	for rows.Next() {
+		var name, code string
+		if err := rows.Scan(&name, &code); err != nil {
+			return nil, err
+		}
+		categories[name] = code
+	}
+	return categories, rows.Err()
+}
+
+func (s *SQLiteStore) CategoryInfos() (map[string]CategoryInfo, error) {
+	return queryCategoryInfo(s.db, s.scope)
+}
+
+func (s *SQLiteStore) AddCategory(name, code string) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		return putCategory(tx, s.scope, name, code)
+	})
+}
+
+// IsEmpty 返回此範圍中是否還沒有任何圖片與分類
+func (s *SQLiteStore) IsEmpty() (bool, error) {
+	var n int
+	err := s.db.QueryRow(
+		"SELECT (SELECT COUNT(*) FROM images WHERE scope = ?) + (SELECT COUNT(*) FROM categories WHERE scope = ?)",
+		s.scope, s.scope,
+	).Scan(&n)
+	return n == 0, err
+}
+
+// Scopes 返回資料庫中有圖片、分類、回收桶或版本紀錄的所有範圍
+func (s *SQLiteStore) Scopes() ([]string, error) {
+	rows, err := s.db.Query(`
+		SELECT scope FROM images UNION SELECT scope FROM categories
+		UNION SELECT scope FROM trash UNION SELECT scope FROM image_history`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scopes []string
+	for rows.Next() {
+		var scope string
+		if err := rows.Scan(&scope); err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes, rows.Err()
+}
+
+// ImportJSON 將 JSON 圖庫檔案（ImageDB 格式）的所有圖片與分類匯入 s 的範圍
+// 整個匯入在同一個交易中完成，失敗時不會留下部分資料
+// 返回匯入的圖片數量
+func ImportJSON(jsonPath string, s *SQLiteStore) (int, error) {
+	db, err := LoadDatabase(jsonPath)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.withTx(func(tx *sql.Tx) error {
+		for name, code := range db.Categories {
+			if err := putCategory(tx, s.scope, name, code); err != nil {
+				return err
+			}
+		}
+		for _, img := range db.Images {
+			if err := putImage(tx, s.scope, img); err != nil {
+				return fmt.Errorf("匯入圖片 %q 失敗: %w", img.Name, err)
+			}
+		}
+		for name, n := range db.Sequences {
+			if _, err := tx.Exec("INSERT OR REPLACE INTO sequences (scope, name, value) VALUES (?, ?, ?)", s.scope, name, n); err != nil {
+				return err
+			}
+		}
+		for oldID, id := range db.Redirects {
+			if err := putRedirect(tx, s.scope, oldID, id); err != nil {
+				return err
+			}
+		}
+		for code, info := range db.CategoryInfo {
+			if err := putCategoryInfo(tx, s.scope, code, info); err != nil {
+				return err
+			}
+		}
+		for _, entry := range db.Trash {
+			if err := putTrash(tx, s.scope, entry); err != nil {
+				return err
+			}
+		}
+		for id, revisions := range db.History {
+			if err := putHistory(tx, s.scope, id, revisions); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(db.Images), nil
+}
+
+// Transact 在同一個 SQLite 交易中讀取完整圖庫、交給 fn 修改，並只寫回有變更的部分
+func (s *SQLiteStore) Transact(fn func(db *ImageDB) error) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		old, err := loadAll(tx, s.scope)
+		if err != nil {
+			return err
+		}
+		next := old.Clone()
+		if err := fn(next); err != nil {
+			return err
+		}
+		return applyChanges(tx, s.scope, diff(old, next))
+	})
+}
+
+// View 在交易中讀取完整圖庫後交給 fn，不會寫回任何變更
+func (s *SQLiteStore) View(fn func(db *ImageDB) error) error {
+	db, err := s.Load()
+	if err != nil {
+		return err
+	}
+	return fn(db)
+}
+
+// Load 讀取完整的圖庫（實作 Backend）
+func (s *SQLiteStore) Load() (*ImageDB, error) {
+	var db *ImageDB
+	err := s.withTx(func(tx *sql.Tx) error {
+		var err error
+		db, err = loadAll(tx, s.scope)
+		return err
+	})
+	return db, err
+}
+
+// Persist 在單一交易中套用變更（實作 Backend），不需要整份重寫
+func (s *SQLiteStore) Persist(snapshot *ImageDB, changes []Change) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		return applyChanges(tx, s.scope, changes)
+	})
+}
+
+// loadAll 讀取範圍中的所有圖片、分類、分類說明、序號、轉址、回收桶與版本紀錄
+func loadAll(tx *sql.Tx, scope string) (*ImageDB, error) {
+	db := &ImageDB{
+		Images:        make(map[string]ImageData),
+		Categories:    make(map[string]string),
+		CategoryInfo:  make(map[string]CategoryInfo),
+		Sequences:     make(map[string]int),
+		Redirects:     make(map[string]string),
+		Trash:         make(map[string]TrashedImage),
+		History:       make(map[string][]Revision),
+		SchemaVersion: CurrentSchemaVersion,
+	}
+
+	rows, err := tx.Query(imageSelect+" WHERE scope = ?", scope)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		img, err := scanImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		db.PutImage(img)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	catRows, err := tx.Query("SELECT name, code FROM categories WHERE scope = ?", scope)
+	if err != nil {
+		return nil, err
+	}
+	defer catRows.Close()
+	for catRows.Next() {
+		var name, code string
+		if err := catRows.Scan(&name, &code); err != nil {
+			return nil, err
+		}
+		db.Categories[name] = code
+	}
+	if err := catRows.Err(); err != nil {
+		return nil, err
+	}
+
+	seqRows, err := tx.Query("SELECT name, value FROM sequences WHERE scope = ?", scope)
+	if err != nil {
+		return nil, err
+	}
+	defer seqRows.Close()
+	for seqRows.Next() {
+		var name string
+		var n int
+		if err := seqRows.Scan(&name, &n); err != nil {
+			return nil, err
+		}
+		db.Sequences[name] = n
+	}
+	if err := seqRows.Err(); err != nil {
+		return nil, err
+	}
+
+	redirectRows, err := tx.Query("SELECT old_id, image_id FROM redirects WHERE scope = ?", scope)
+	if err != nil {
+		return nil, err
+	}
+	defer redirectRows.Close()
+	for redirectRows.Next() {
+		var oldID, id string
+		if err := redirectRows.Scan(&oldID, &id); err != nil {
+			return nil, err
+		}
+		db.Redirects[oldID] = id
+	}
+	if err := redirectRows.Err(); err != nil {
+		return nil, err
+	}
+
+	trashRows, err := tx.Query("SELECT image, deleted_at, deleted_by FROM trash WHERE scope = ?", scope)
+	if err != nil {
+		return nil, err
+	}
+	defer trashRows.Close()
+	for trashRows.Next() {
+		var image string
+		var deletedAt int64
+		var entry TrashedImage
+		if err := trashRows.Scan(&image, &deletedAt, &entry.DeletedBy); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(image), &entry.Image); err != nil {
+			return nil, err
+		}
+		entry.DeletedAt = time.UnixMilli(deletedAt)
+		db.Trash[entry.Image.ID] = entry
+	}
+	if err := trashRows.Err(); err != nil {
+		return nil, err
+	}
+
+	historyRows, err := tx.Query("SELECT image_id, revisions FROM image_history WHERE scope = ?", scope)
+	if err != nil {
+		return nil, err
+	}
+	defer historyRows.Close()
+	for historyRows.Next() {
+		var id, data string
+		if err := historyRows.Scan(&id, &data); err != nil {
+			return nil, err
+		}
+		var revisions []Revision
+		if err := json.Unmarshal([]byte(data), &revisions); err != nil {
+			return nil, err
+		}
+		db.History[id] = revisions
+	}
+	if err := historyRows.Err(); err != nil {
+		return nil, err
+	}
+
+	infos, err := queryCategoryInfo(tx, scope)
+	if err != nil {
+		return nil, err
+	}
+	db.CategoryInfo = infos
+	return db, nil
+}
+
+// applyChanges 依序將變更套用到範圍中
+func applyChanges(tx *sql.Tx, scope string, changes []Change) error {
+	for _, c := range changes {
+		var err error
+		switch c.Kind {
+		case ChangePutImage:
+			err = putImage(tx, scope, c.Image)
+		case ChangeDeleteImage:
+			_, err = deleteImage(tx, scope, c.Image.ID)
+		case ChangePutCategory:
+			err = putCategory(tx, scope, c.CategoryName, c.CategoryCode)
+		case ChangeDeleteCategory:
+			_, err = tx.Exec("DELETE FROM categories WHERE scope = ? AND name = ?", scope, c.CategoryName)
+		case ChangePutCategoryInfo:
+			err = putCategoryInfo(tx, scope, c.CategoryCode, c.CategoryInfo)
+		case ChangeDeleteCategoryInfo:
+			_, err = tx.Exec("DELETE FROM category_info WHERE scope = ? AND code = ?", scope, c.CategoryCode)
+		case ChangePutRedirect:
+			err = putRedirect(tx, scope, c.OldID, c.Image.ID)
+		case ChangeDeleteRedirect:
+			_, err = tx.Exec("DELETE FROM redirects WHERE scope = ? AND old_id = ?", scope, c.OldID)
+		case ChangePutTrash:
+			err = putTrash(tx, scope, c.Trash)
+		case ChangeDeleteTrash:
+			_, err = tx.Exec("DELETE FROM trash WHERE scope = ? AND image_id = ?", scope, c.Trash.Image.ID)
+		case ChangePutHistory:
+			err = putHistory(tx, scope, c.Image.ID, c.Revisions)
+		case ChangeDeleteHistory:
+			_, err = tx.Exec("DELETE FROM image_history WHERE scope = ? AND image_id = ?", scope, c.Image.ID)
+		case ChangePutSequence:
+			_, err = tx.Exec("INSERT OR REPLACE INTO sequences (scope, name, value) VALUES (?, ?, ?)", scope, c.Sequence, c.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migration 在交易中把資料庫結構升級一個版本
+type migration func(tx *sql.Tx) error
+
+// execSQL 返回只執行一段 SQL 的遷移
+func execSQL(stmt string) migration {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(stmt)
+		return err
+	}
+}
+
+// migrations 依序列出資料庫結構的每個版本
+// 第 n 個元素會把結構從版本 n 升級到 n+1，已發佈的遷移不可修改，只能在後面追加
+var migrations = []migration{
+	// 版本 1：圖片與分類資料表
+	execSQL(`CREATE TABLE images (
+		id       TEXT PRIMARY KEY,
+		name     TEXT NOT NULL,
+		url      TEXT NOT NULL,
+		category TEXT NOT NULL
+	);
+	CREATE UNIQUE INDEX idx_images_name ON images(name);
+	CREATE INDEX idx_images_category ON images(category, id);
+	CREATE TABLE categories (
+		name TEXT PRIMARY KEY,
+		code TEXT NOT NULL
+	);`),
+	// 版本 2：加入 scope 欄位，讓每個伺服器擁有獨立的圖庫，既有資料歸入全域圖庫
+	execSQL(`CREATE TABLE images_v2 (
+		scope    TEXT NOT NULL,
+		id       TEXT NOT NULL,
+		name     TEXT NOT NULL,
+		url      TEXT NOT NULL,
+		category TEXT NOT NULL,
+		PRIMARY KEY (scope, id)
+	);
+	INSERT INTO images_v2 (scope, id, name, url, category)
+		SELECT 'global', id, name, url, category FROM images;
+	DROP TABLE images;
+	ALTER TABLE images_v2 RENAME TO images;
+	CREATE UNIQUE INDEX idx_images_name ON images(scope, name);
+	CREATE INDEX idx_images_category ON images(scope, category, id);
+	CREATE TABLE categories_v2 (
+		scope TEXT NOT NULL,
+		name  TEXT NOT NULL,
+		code  TEXT NOT NULL,
+		PRIMARY KEY (scope, name)
+	);
+	INSERT INTO categories_v2 (scope, name, code)
+		SELECT 'global', name, code FROM categories;
+	DROP TABLE categories;
+	ALTER TABLE categories_v2 RENAME TO categories;`),
+	// 版本 3：圖片標籤，並把每張圖片的分類轉為標籤（與 JSON 圖庫的格式版本 1 相同）
+	migrateTags,
+	// 版本 4：圖片別名，唯一性在 Go 中以正規化後的結果檢查
+	execSQL(`CREATE TABLE image_aliases (
+		scope    TEXT NOT NULL,
+		image_id TEXT NOT NULL,
+		alias    TEXT NOT NULL,
+		PRIMARY KEY (scope, image_id, alias)
+	);
+	CREATE INDEX idx_image_aliases_alias ON image_aliases(scope, alias);`),
+	// 版本 5：ID分配的序號，並修正既有的分類編號與圖片ID（與 JSON 圖庫的格式版本 2 相同）
+	migrateSequences,
+	// 版本 6：永久ID與顯示代碼分開，舊ID的轉址（與 JSON 圖庫的格式版本 3 相同）
+	execSQL(`ALTER TABLE images ADD COLUMN code TEXT NOT NULL DEFAULT '';
+	UPDATE images SET code = id;
+	CREATE INDEX idx_images_code ON images(scope, code);
+	CREATE TABLE redirects (
+		scope    TEXT NOT NULL,
+		old_id   TEXT NOT NULL,
+		image_id TEXT NOT NULL,
+		PRIMARY KEY (scope, old_id)
+	);`),
+	// 版本 7：分類的說明與表情符號，以分類編號為鍵，分類改名後仍然保留
+	execSQL(`CREATE TABLE category_info (
+		scope       TEXT NOT NULL,
+		code        TEXT NOT NULL,
+		description TEXT NOT NULL,
+		emoji       TEXT NOT NULL,
+		PRIMARY KEY (scope, code)
+	);`),
+	// 版本 8：以附件上傳、保存在本機的圖片檔案，沒有檔案時 blob_hash 為空字串
+	execSQL(`ALTER TABLE images ADD COLUMN blob_hash TEXT NOT NULL DEFAULT '';
+	ALTER TABLE images ADD COLUMN blob_type TEXT NOT NULL DEFAULT '';
+	ALTER TABLE images ADD COLUMN blob_size INTEGER NOT NULL DEFAULT 0;`),
+	// 版本 9：網址的本機鏡像與下載狀態，以 JSON 保存，尚未鏡像時為空字串
+	execSQL(`ALTER TABLE images ADD COLUMN mirror TEXT NOT NULL DEFAULT '';`),
+	// 版本 10：網址最近一次的檢查結果，以 JSON 保存，尚未檢查時為空字串
+	execSQL(`ALTER TABLE images ADD COLUMN health TEXT NOT NULL DEFAULT '';`),
+	// 版本 11：感知雜湊，SQLite 的整數為有號 64 位元，以相同的位元保存
+	execSQL(`ALTER TABLE images ADD COLUMN phash INTEGER NOT NULL DEFAULT 0;`),
+	// 版本 12：圖片檔案的格式、尺寸與大小，以 JSON 保存，尚未讀取時為空字串
+	execSQL(`ALTER TABLE images ADD COLUMN meta TEXT NOT NULL DEFAULT '';`),
+	// 版本 13：回收桶，圖片的完整內容以 JSON 保存，不會出現在圖片的查詢中
+	execSQL(`CREATE TABLE trash (
+		scope      TEXT NOT NULL,
+		image_id   TEXT NOT NULL,
+		image      TEXT NOT NULL,
+		deleted_at INTEGER NOT NULL,
+		deleted_by TEXT NOT NULL,
+		PRIMARY KEY (scope, image_id)
+	);`),
+	// 版本 14：圖片的版本紀錄，每張圖片的所有版本以一個 JSON 陣列保存
+	execSQL(`CREATE TABLE image_history (
+		scope     TEXT NOT NULL,
+		image_id  TEXT NOT NULL,
+		revisions TEXT NOT NULL,
+		PRIMARY KEY (scope, image_id)
+	);`),
+	// 版本 15：以 NormalizeName 正規化的名稱與別名，查詢時不需要讀出整個範圍
+	migrateNameKeys,
+}
+
+// migrateTags 建立標籤資料表，並以分類名稱作為既有圖片的標籤
+func migrateTags(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE image_tags (
+		scope    TEXT NOT NULL,
+		image_id TEXT NOT NULL,
+		tag      TEXT NOT NULL,
+		PRIMARY KEY (scope, image_id, tag)
+	);
+	CREATE INDEX idx_image_tags_tag ON image_tags(scope, tag, image_id);`)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT i.scope, i.id, c.name FROM images i
+		JOIN categories c ON c.scope = i.scope AND c.code = i.category
+		WHERE i.category <> ?`, UncategorizedCode)
+	if err != nil {
+		return err
+	}
+	type imageTag struct{ scope, id, tag string }
+	var tags []imageTag
+	for rows.Next() {
+		var t imageTag
+		if err := rows.Scan(&t.scope, &t.id, &t.tag); err != nil {
+			rows.Close()
+			return err
+		}
+		// 標籤的正規化規則在 Go 中定義，因此無法單純以 SQL 完成
+		if t.tag = NormalizeTag(t.tag); t.tag != "" {
+			tags = append(tags, t)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, t := range tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO image_tags (scope, image_id, tag) VALUES (?, ?, ?)", t.scope, t.id, t.tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateNameKeys 加入正規化的名稱與別名欄位並填入既有的資料
+// NormalizeName 的規則（Unicode 大小寫與空白）無法以 SQL 表達，因此在 Go 中計算
+func migrateNameKeys(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE images ADD COLUMN name_key TEXT NOT NULL DEFAULT '';
+	ALTER TABLE image_aliases ADD COLUMN alias_key TEXT NOT NULL DEFAULT '';
+	CREATE INDEX idx_images_name_key ON images(scope, name_key);
+	CREATE INDEX idx_image_aliases_alias_key ON image_aliases(scope, alias_key);`)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []struct{ name, column, key string }{
+		{"images", "name", "name_key"},
+		{"image_aliases", "alias", "alias_key"},
+	} {
+		values, err := queryStrings(tx, "SELECT DISTINCT "+table.column+" FROM "+table.name)
+		if err != nil {
+			return err
+		}
+		for _, v := range values {
+			if _, err := tx.Exec("UPDATE "+table.name+" SET "+table.key+" = ? WHERE "+table.column+" = ?", NormalizeName(v), v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// migrateSequences 建立序號資料表，並以 repairIDs 逐一檢查每個範圍的分類編號與圖片ID
+func migrateSequences(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE sequences (
+		scope TEXT NOT NULL,
+		name  TEXT NOT NULL,
+		value INTEGER NOT NULL,
+		PRIMARY KEY (scope, name)
+	);`)
+	if err != nil {
+		return err
+	}
+
+	scopes, err := queryStrings(tx, "SELECT scope FROM images UNION SELECT scope FROM categories")
+	if err != nil {
+		return err
+	}
+	for _, scope := range scopes {
+		// 只讀出需要的欄位，之後的遷移改變圖片資料表時此遷移仍然可以執行
+		db := &ImageDB{Images: make(map[string]ImageData), Categories: make(map[string]string)}
+		rows, err := tx.Query("SELECT id, name, category FROM images WHERE scope = ?", scope)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var img ImageData
+			if err := rows.Scan(&img.ID, &img.Name, &img.Category); err != nil {
+				rows.Close()
+				return err
+			}
+			db.Images[img.Name] = img
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows, err = tx.Query("SELECT name, code FROM categories WHERE scope = ?", scope)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var name, code string
+			if err := rows.Scan(&name, &code); err != nil {
+				rows.Close()
+				return err
+			}
+			db.Categories[name] = code
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		before := db.Clone()
+		repairIDs(db)
+
+		for name, code := range db.Categories {
+			if before.Categories[name] != code {
+				if _, err := tx.Exec("UPDATE categories SET code = ? WHERE scope = ? AND name = ?", code, scope, name); err != nil {
+					return err
+				}
+			}
+		}
+		// 新的ID不會與任何既有的ID相同，因此可以直接逐一更新
+		for name, img := range db.Images {
+			old := before.Images[name]
+			if old.ID == img.ID && old.Category == img.Category {
+				continue
+			}
+			if _, err := tx.Exec("UPDATE images SET id = ?, category = ? WHERE scope = ? AND id = ?", img.ID, img.Category, scope, old.ID); err != nil {
+				return err
+			}
+			for _, table := range []string{"image_tags", "image_aliases"} {
+				if _, err := tx.Exec("UPDATE "+table+" SET image_id = ? WHERE scope = ? AND image_id = ?", img.ID, scope, old.ID); err != nil {
+					return err
+				}
+			}
+		}
+		for name, n := range db.Sequences {
+			if _, err := tx.Exec("INSERT INTO sequences (scope, name, value) VALUES (?, ?, ?)", scope, name, n); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// queryStrings 執行只返回一個文字欄位的查詢
+func queryStrings(tx *sql.Tx, query string, args ...any) ([]string, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// migrate 以 PRAGMA user_version 記錄目前的結構版本，並依序套用之後的遷移
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("資料庫結構版本 %d 比程式支援的版本 %d 新", version, len(migrations))
+	}
+
+	for v := version; v < len(migrations); v++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := migrations[v](tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("套用遷移 %d 失敗: %w", v+1, err)
+		}
+		// PRAGMA 不支援參數綁定，版本號為程式內的整數因此可以直接格式化
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", v+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
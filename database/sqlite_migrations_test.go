@@ -0,0 +1,156 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// createVersion1 建立結構版本 1 的資料庫並執行 stmts 寫入舊格式的資料
+func createVersion1(t *testing.T, path string, stmts ...string) {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrations[0](tx); err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range append(stmts, "PRAGMA user_version = 1") {
+		if _, err := tx.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// userVersion 返回資料庫檔案記錄的結構版本
+func userVersion(t *testing.T, s *SQLiteStore) int {
+	t.Helper()
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
+
+func TestSQLiteMigrateEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	for range 2 { // 第二次開啟時沒有需要套用的遷移
+		s, err := OpenSQLiteStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := userVersion(t, s); v != len(migrations) {
+			t.Errorf("結構版本為 %d，預期 %d", v, len(migrations))
+		}
+		if empty, err := s.IsEmpty(); err != nil || !empty {
+			t.Errorf("IsEmpty() = %v, %v", empty, err)
+		}
+		s.Close()
+	}
+}
+
+func TestSQLiteMigrateRejectsNewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", len(migrations)+1)); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if s, err := OpenSQLiteStore(path); err == nil {
+		s.Close()
+		t.Error("開啟較新版本的資料庫時沒有返回錯誤")
+	}
+}
+
+func TestSQLiteMigrateFromVersion1(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	createVersion1(t, path,
+		`INSERT INTO categories (name, code) VALUES ('NULL', '00'), ('Cats', '01'), ('Dogs', '01'), ('Birds', 'x')`,
+		`INSERT INTO images (id, name, url, category) VALUES
+			('01001', 'Tabby', 'https://example.com/tabby.png', '01'),
+			('7', 'Stray', 'https://example.com/stray.png', '01'),
+			('x001', 'Robin', 'https://example.com/robin.png', 'x'),
+			('01002', 'Misc', 'https://example.com/misc.png', '00')`,
+	)
+
+	s, err := OpenSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if v := userVersion(t, s); v != len(migrations) {
+		t.Errorf("結構版本為 %d，預期 %d", v, len(migrations))
+	}
+
+	// 版本 2 把既有的資料歸入全域圖庫
+	db, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCategories := map[string]string{UncategorizedName: "00", "Birds": "02", "Cats": "01", "Dogs": "03"}
+	if !reflect.DeepEqual(db.Categories, wantCategories) {
+		t.Errorf("分類為 %v，預期 %v", db.Categories, wantCategories)
+	}
+
+	tests := []struct {
+		name     string
+		id       string
+		category string
+		tags     []string
+	}{
+		{"tabby", "01001", "01", []string{"cats", "dogs"}}, // 重複的分類編號都轉為標籤
+		{"stray", "01003", "01", []string{"cats", "dogs"}}, // ID格式錯誤
+		{"robin", "02001", "02", []string{"birds"}},        // 分類編號格式錯誤
+		{"MISC", "00001", "00", nil},                       // 未分類但ID屬於其他分類
+	}
+	for _, tt := range tests {
+		img, err := s.GetByName(tt.name)
+		if err != nil {
+			t.Errorf("GetByName(%q) = %v", tt.name, err)
+			continue
+		}
+		if img.ID != tt.id || img.Code != tt.id || img.Category != tt.category || !reflect.DeepEqual(img.Tags, tt.tags) {
+			t.Errorf("圖片 %q = ID %s、代碼 %s、分類 %s、標籤 %v，預期 ID %s、分類 %s、標籤 %v",
+				tt.name, img.ID, img.Code, img.Category, img.Tags, tt.id, tt.category, tt.tags)
+		}
+	}
+
+	// 序號以修正後最大的編號初始化，新分配的編號不會重複
+	wantSequences := map[string]int{categorySequence: 3, imageSequence("00"): 1, imageSequence("01"): 3, imageSequence("02"): 1}
+	if !reflect.DeepEqual(db.Sequences, wantSequences) {
+		t.Errorf("序號為 %v，預期 %v", db.Sequences, wantSequences)
+	}
+
+	// 標籤與別名跟著新的ID移動，沒有留下指向舊ID的資料列
+	for _, table := range []string{"image_tags", "image_aliases"} {
+		var orphans int
+		query := "SELECT COUNT(*) FROM " + table + " t WHERE NOT EXISTS (SELECT 1 FROM images i WHERE i.scope = t.scope AND i.id = t.image_id)"
+		if err := s.db.QueryRow(query).Scan(&orphans); err != nil {
+			t.Fatal(err)
+		}
+		if orphans != 0 {
+			t.Errorf("%s 有 %d 筆指向不存在的圖片", table, orphans)
+		}
+	}
+
+	// 版本 15 填入正規化的名稱
+	results, err := s.Search("TA")
+	if err != nil || len(results) != 1 || results[0].ID != "01001" {
+		t.Errorf("Search(\"TA\") = %v, %v", results, err)
+	}
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// openTestSQLite 開啟暫存目錄中的 SQLite 資料庫，測試結束時關閉
+func openTestSQLite(t *testing.T) *SQLiteStore {
+	t.Helper()
+	s, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSQLiteNameLookup(t *testing.T) {
+	s := openTestSQLite(t)
+	images := []ImageData{
+		{ID: "00001", Name: "Hello  World", Category: UncategorizedCode, Aliases: []string{"ÉCLAIR  Tart"}},
+		{ID: "00002", Name: "éclair", Category: UncategorizedCode},
+	}
+	for _, img := range images {
+		if err := s.Add(img); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		id   string
+	}{
+		{"hello world", "00001"},
+		{" HELLO   world ", "00001"},
+		{"Éclair", "00002"},
+		{"éclair tart", "00001"}, // 別名
+	}
+	for _, tt := range tests {
+		img, err := s.GetByName(tt.name)
+		if err != nil || img.ID != tt.id {
+			t.Errorf("GetByName(%q) = %s, %v，預期 %s", tt.name, img.ID, err, tt.id)
+		}
+	}
+	if _, err := s.GetByName("missing"); err != ErrNotFound {
+		t.Errorf("GetByName(\"missing\") 的錯誤 = %v，預期 ErrNotFound", err)
+	}
+
+	found, err := s.Search("ÉCL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 {
+		t.Errorf("Search(\"ÉCL\") 找到 %d 張圖片，預期 2 張", len(found))
+	}
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrNotFound 表示找不到指定的圖片
+var ErrNotFound = errors.New("找不到圖片")
+
+// Store 是圖庫的儲存介面，機器人只透過此介面存取圖片資料，
+// 因此可以替換不同的儲存後端（或在測試時使用假的實作）
+type Store interface {
+	// GetByID 根據永久ID、顯示代碼或舊ID取得圖片，找不到時返回 ErrNotFound
+	GetByID(id string) (ImageData, error)
+	// GetByName 根據完整名稱或別名取得圖片，找不到時返回 ErrNotFound
+	GetByName(name string) (ImageData, error)
+	// Search 根據部分名稱搜尋圖片，返回依ID排序的所有匹配結果
+	Search(query string) ([]ImageData, error)
+	// RankedSearch 為每張圖片評分，返回依分數排序的前 limit 筆結果（limit <= 0 表示不限制）
+	RankedSearch(query string, limit int) ([]SearchResult, error)
+	// Add 新增圖片，名稱或別名已被其他圖片使用時返回 ErrNameTaken
+	Add(img ImageData) error
+	// Delete 根據ID刪除圖片，找不到時返回 ErrNotFound
+	Delete(id string) error
+	// Update 以 img 取代目前ID為 id 的圖片（允許更改ID與名稱）
+	Update(id string, img ImageData) error
+	// List 返回依ID排序的所有圖片
+	List() ([]ImageData, error)
+	// ListByCategory 返回指定分類編號中依ID排序的圖片
+	ListByCategory(categoryCode string) ([]ImageData, error)
+	// ListByTags 返回依ID排序、符合標籤條件的圖片
+	// matchAll 為 true 時必須擁有所有標籤（AND），否則只需擁有任一標籤（OR）
+	ListByTags(tags []string, matchAll bool) ([]ImageData, error)
+	// Tags 返回所有標籤與使用該標籤的圖片數量
+	Tags() (map[string]int, error)
+	// Categories 返回分類名稱與對應編號的映射
+	Categories() (map[string]string, error)
+	// CategoryInfos 返回以分類編號為鍵的分類說明與表情符號
+	CategoryInfos() (map[string]CategoryInfo, error)
+	// AddCategory 新增或覆蓋一個分類名稱與編號的對應
+	AddCategory(name, code string) error
+	// Transact 以原子方式執行「讀取-修改-寫回」：fn 可任意修改 db，
+	// 返回 nil 時所有修改一併生效，返回錯誤時所有修改都會被捨棄
+	Transact(fn func(db *ImageDB) error) error
+	// View 以唯讀方式把目前的圖庫交給 fn，不會寫回也不會等待其他修改，fn 不可修改 db
+	View(fn func(db *ImageDB) error) error
+}
+
+// sortByID 將圖片依ID排序
+func sortByID(images []ImageData) {
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].ID < images[j].ID
+	})
+}
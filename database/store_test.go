@@ -0,0 +1,50 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// testStores 返回每種 Store 實作各一個空的圖庫
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+	dir := t.TempDir()
+	lib, err := OpenLibrary(NewJSONStore(filepath.Join(dir, "library.json")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lib.Close() })
+	return map[string]Store{
+		"JSONStore":   NewJSONStore(filepath.Join(dir, "store.json")),
+		"Library":     lib,
+		"SQLiteStore": openTestSQLite(t),
+	}
+}
+
+func TestStoreAddRejectsTakenName(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			first := ImageData{ID: "00001", Name: "Cat", Category: UncategorizedCode, Aliases: []string{"kitty"}}
+			if err := store.Add(first); err != nil {
+				t.Fatal(err)
+			}
+			for _, img := range []ImageData{
+				{ID: "00002", Name: "cat", Category: UncategorizedCode},
+				{ID: "00003", Name: "Kitty", Category: UncategorizedCode},
+				{ID: "00004", Name: "dog", Category: UncategorizedCode, Aliases: []string{" CAT "}},
+			} {
+				if err := store.Add(img); !errors.Is(err, ErrNameTaken) {
+					t.Errorf("Add(%q) 的錯誤 = %v，預期 ErrNameTaken", img.Name, err)
+				}
+			}
+			got, err := store.GetByID("00001")
+			if err != nil || got.Name != "Cat" {
+				t.Errorf("原本的圖片被覆蓋：%+v, %v", got, err)
+			}
+			if err := store.Add(ImageData{ID: "00005", Name: "dog", Category: UncategorizedCode}); err != nil {
+				t.Errorf("Add(\"dog\") = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Submission 是等待審核的圖片投稿，核准後才會分配ID並加入圖庫
+type Submission struct {
+	ID          string    `json:"id"`         // 投稿編號（發出指令的互動ID）
+	Scope       string    `json:"scope"`      // 要加入的圖庫範圍
+	Image       ImageData `json:"image"`      // 圖片內容，ID 與 Category 在核准時才分配
+	Category    string    `json:"category"`   // 投稿者指定的分類名稱
+	SubmitterID string    `json:"submitter"`  // 投稿者的使用者ID
+	ChannelID   string    `json:"channel_id"` // 審核訊息所在的頻道
+	MessageID   string    `json:"message_id"` // 審核訊息的ID
+	CreatedAt   time.Time `json:"created_at"` // 投稿時間
+}
+
+// SubmissionStore 以單一 JSON 檔案保存所有等待審核的投稿，修改後立即寫回檔案
+// 審核完成（核准或退回）的投稿會被移除
+type SubmissionStore struct {
+	filePath string
+	mu       sync.RWMutex
+	items    map[string]Submission
+}
+
+// LoadSubmissions 從 filePath 讀取投稿，檔案不存在時返回空的投稿列表
+func LoadSubmissions(filePath string) (*SubmissionStore, error) {
+	s := &SubmissionStore{filePath: filePath, items: make(map[string]Submission)}
+
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.items); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get 返回編號為 id 的投稿
+func (s *SubmissionStore) Get(id string) (Submission, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sub, ok := s.items[id]
+	return sub, ok
+}
+
+// List 返回範圍中所有等待審核的投稿，依投稿時間排序
+func (s *SubmissionStore) List(scope string) []Submission {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var subs []Submission
+	for _, sub := range s.items {
+		if sub.Scope == scope {
+			subs = append(subs, sub)
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].CreatedAt.Before(subs[j].CreatedAt)
+	})
+	return subs
+}
+
+// MarkBlobs 將等待審核的投稿使用的檔案加入 inUse
+func (s *SubmissionStore) MarkBlobs(inUse map[string]bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, sub := range s.items {
+		sub.Image.markBlobs(inUse)
+	}
+}
+
+// Put 新增或修改投稿並寫回檔案
+func (s *SubmissionStore) Put(sub Submission) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[sub.ID] = sub
+	return s.save()
+}
+
+// Update 交給 fn 修改編號為 id 的投稿並寫回檔案，投稿不存在（已審核）時返回 false
+func (s *SubmissionStore) Update(id string, fn func(sub *Submission)) (Submission, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.items[id]
+	if !ok {
+		return Submission{}, false, nil
+	}
+	sub := old
+	fn(&sub)
+	s.items[id] = sub
+	if err := s.save(); err != nil {
+		s.items[id] = old
+		return Submission{}, false, err
+	}
+	return sub, true, nil
+}
+
+// Take 移除並返回編號為 id 的投稿，用於審核完成時；同一個投稿只有一次呼叫會成功
+func (s *SubmissionStore) Take(id string) (Submission, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.items[id]
+	if !ok {
+		return Submission{}, false, nil
+	}
+	delete(s.items, id)
+	if err := s.save(); err != nil {
+		s.items[id] = sub
+		return Submission{}, false, err
+	}
+	return sub, true, nil
+}
+
+// save 將所有投稿寫回檔案，呼叫者必須持有寫入鎖
+func (s *SubmissionStore) save() error {
+	data, err := json.MarshalIndent(s.items, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(s.filePath, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"sort"
+	"strings"
+)
+
+// NormalizeTag 返回正規化後的標籤，規則與名稱相同
+func NormalizeTag(tag string) string {
+	return NormalizeName(tag)
+}
+
+// ParseTags 將以逗號分隔的字串拆成正規化且不重複的標籤
+func ParseTags(s string) []string {
+	var tags []string
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '，' }) {
+		tags = addTags(tags, part)
+	}
+	return tags
+}
+
+// addTags 返回加入標籤後的新切片（不修改原切片），結果依字母排序且不重複
+func addTags(tags []string, add ...string) []string {
+	out := append([]string(nil), tags...)
+	for _, tag := range add {
+		tag = NormalizeTag(tag)
+		if tag == "" {
+			continue
+		}
+		n := sort.SearchStrings(out, tag)
+		if n < len(out) && out[n] == tag {
+			continue
+		}
+		out = append(out, "")
+		copy(out[n+1:], out[n:])
+		out[n] = tag
+	}
+	return out
+}
+
+// removeTags 返回移除標籤後的新切片（不修改原切片）
+func removeTags(tags []string, remove ...string) []string {
+	drop := make(map[string]bool, len(remove))
+	for _, tag := range remove {
+		drop[NormalizeTag(tag)] = true
+	}
+	var out []string
+	for _, tag := range tags {
+		if !drop[tag] {
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+// HasTag 返回圖片是否有此標籤
+func (img ImageData) HasTag(tag string) bool {
+	tag = NormalizeTag(tag)
+	for _, t := range img.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// WithTags 返回加入標籤後的圖片副本
+func (img ImageData) WithTags(tags ...string) ImageData {
+	img.Tags = addTags(img.Tags, tags...)
+	return img
+}
+
+// WithoutTags 返回移除標籤後的圖片副本
+func (img ImageData) WithoutTags(tags ...string) ImageData {
+	img.Tags = removeTags(img.Tags, tags...)
+	return img
+}
+
+// AddTags 為ID為 id 的圖片加入標籤，返回更新後的圖片
+func (db *ImageDB) AddTags(id string, tags ...string) (ImageData, bool) {
+	img, ok := db.ImageByID(id)
+	if !ok {
+		return ImageData{}, false
+	}
+	img = img.WithTags(tags...)
+	db.ReplaceImage(id, img)
+	return img, true
+}
+
+// RemoveTags 移除ID為 id 的圖片的標籤，返回更新後的圖片
+func (db *ImageDB) RemoveTags(id string, tags ...string) (ImageData, bool) {
+	img, ok := db.ImageByID(id)
+	if !ok {
+		return ImageData{}, false
+	}
+	img = img.WithoutTags(tags...)
+	db.ReplaceImage(id, img)
+	return img, true
+}
+
+// ImagesWithTags 返回依ID排序、符合標籤條件的圖片
+// matchAll 為 true 時圖片必須擁有所有標籤（AND），否則只需擁有任一標籤（OR）
+func (db *ImageDB) ImagesWithTags(tags []string, matchAll bool) []ImageData {
+	db.ensureIndex()
+	if len(tags) == 0 {
+		return nil
+	}
+
+	counts := make(map[string]int)
+	var normalized []string
+	for _, tag := range tags {
+		normalized = addTags(normalized, tag)
+	}
+	for _, tag := range normalized {
+		for _, id := range db.byTag[tag] {
+			counts[id]++
+		}
+	}
+
+	var ids []string
+	for id, n := range counts {
+		if !matchAll || n == len(normalized) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return db.imagesByIDs(ids)
+}
+
+// AllTags 返回所有標籤與使用該標籤的圖片數量
+func (db *ImageDB) AllTags() map[string]int {
+	db.ensureIndex()
+	tags := make(map[string]int, len(db.byTag))
+	for tag, ids := range db.byTag {
+		tags[tag] = len(ids)
+	}
+	return tags
+}
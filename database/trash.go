@@ -0,0 +1,171 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TrashedImage 是移到回收桶的圖片，保留期限過後由 TrashPurger 永久刪除
+type TrashedImage struct {
+	Image     ImageData `json:"image"`
+	DeletedAt time.Time `json:"deleted_at"`
+	DeletedBy string    `json:"deleted_by,omitempty"` // 刪除者的 Discord 使用者ID
+}
+
+// TrashImage 將ID為 id 的圖片移到回收桶，返回被移除的圖片
+// 永久ID與序號都不會釋出，因此還原時ID不變；名稱則會立即釋出給其他圖片使用
+func (db *ImageDB) TrashImage(id, actor string, now time.Time) (ImageData, bool) {
+	img, ok := db.ImageByID(id)
+	if !ok {
+		return ImageData{}, false
+	}
+	db.RemoveImage(img.ID)
+	db.Trash[img.ID] = TrashedImage{Image: img, DeletedAt: now, DeletedBy: actor}
+	return img, true
+}
+
+// RestoreImage 將回收桶中ID為 id 的圖片放回圖庫，返回還原後的圖片
+// 名稱或別名已被其他圖片使用時返回 ErrNameTaken；原本的分類已刪除時改為未分類
+func (db *ImageDB) RestoreImage(id string) (ImageData, error) {
+	entry, ok := db.Trash[id]
+	if !ok {
+		return ImageData{}, ErrNotFound
+	}
+	img := entry.Image
+	if err := db.CheckNames(img, img.ID); err != nil {
+		return ImageData{}, err
+	}
+
+	delete(db.Trash, id)
+	db.PutImage(img)
+	if img.Category != UncategorizedCode && db.CategoryName(img.Category) == "" {
+		img, _ = db.Reclassify(img.ID, UncategorizedName)
+	}
+	return img, nil
+}
+
+// FindTrashed 依永久ID、顯示代碼或名稱尋找回收桶中的圖片，同名時返回最近刪除的
+func (db *ImageDB) FindTrashed(identifier string) (TrashedImage, bool) {
+	if entry, ok := db.Trash[identifier]; ok {
+		return entry, true
+	}
+	name := NormalizeName(identifier)
+	for _, entry := range db.TrashedImages() {
+		if entry.Image.Code == identifier || NormalizeName(entry.Image.Name) == name {
+			return entry, true
+		}
+	}
+	return TrashedImage{}, false
+}
+
+// TrashedImages 返回回收桶中的所有圖片，最近刪除的在前
+func (db *ImageDB) TrashedImages() []TrashedImage {
+	entries := make([]TrashedImage, 0, len(db.Trash))
+	for _, entry := range db.Trash {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		if !entries[a].DeletedAt.Equal(entries[b].DeletedAt) {
+			return entries[a].DeletedAt.After(entries[b].DeletedAt)
+		}
+		return entries[a].Image.ID < entries[b].Image.ID
+	})
+	return entries
+}
+
+// PurgeTrash 永久刪除在 cutoff 之前移到回收桶的圖片與其版本紀錄，返回刪除的數量
+func (db *ImageDB) PurgeTrash(cutoff time.Time) int {
+	n := 0
+	for id, entry := range db.Trash {
+		if entry.DeletedAt.Before(cutoff) {
+			delete(db.Trash, id)
+			delete(db.History, id)
+			n++
+		}
+	}
+	return n
+}
+
+// TrashPurger 定期永久刪除回收桶中超過保留期限的圖片
+// 處理所有範圍，尚未開啟的圖庫直接在持久化層上清理，不會因此開啟
+type TrashPurger struct {
+	registry  *Registry
+	retention time.Duration
+	collector *BlobCollector // 清理後回收不再使用的圖片檔案，可為 nil
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewTrashPurger 建立 TrashPurger，retention 是圖片在回收桶中保留的時間
+// 有圖片被永久刪除時會執行一次 collector（可為 nil），釋出只有這些圖片使用的檔案
+func NewTrashPurger(registry *Registry, retention time.Duration, collector *BlobCollector) *TrashPurger {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &TrashPurger{
+		registry:  registry,
+		retention: retention,
+		collector: collector,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Start 啟動背景 goroutine，立即執行一輪之後每隔 interval 執行一次
+func (p *TrashPurger) Start(interval time.Duration) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			p.RunOnce()
+			select {
+			case <-ticker.C:
+			case <-p.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop 等待背景 goroutine 結束
+func (p *TrashPurger) Stop() {
+	p.cancel()
+	p.wg.Wait()
+}
+
+// RunOnce 清理所有範圍的回收桶，返回永久刪除的圖片數量
+func (p *TrashPurger) RunOnce() int {
+	cutoff := time.Now().Add(-p.retention)
+	scopes, err := p.registry.Scopes()
+	if err != nil {
+		fmt.Println("列出圖庫失敗:", err)
+		return 0
+	}
+	total := 0
+	for _, scope := range scopes {
+		var n int
+		err := p.registry.Transact(scope, func(db *ImageDB) error {
+			n = db.PurgeTrash(cutoff)
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("清理圖庫 %q 的回收桶失敗: %v\n", scope, err)
+			continue
+		}
+		if n > 0 {
+			fmt.Printf("已永久刪除圖庫 %q 回收桶中 %d 張過期的圖片\n", scope, n)
+		}
+		total += n
+	}
+	if total > 0 && p.collector != nil {
+		if _, err := p.collector.RunOnce(); err != nil {
+			fmt.Println("回收圖片檔案失敗:", err)
+		}
+	}
+	return total
+}
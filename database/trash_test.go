@@ -0,0 +1,85 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPurgeTrash(t *testing.T) {
+	now := time.Now()
+	db := &ImageDB{}
+	db.ensureMaps()
+	db.PutImage(ImageData{ID: "01001", Name: "old"})
+	db.PutImage(ImageData{ID: "01002", Name: "new"})
+	db.RecordRevision(nil, ImageData{ID: "01001", Name: "old"}, "u", AuditAdd, now)
+	db.TrashImage("01001", "u", now.Add(-48*time.Hour))
+	db.TrashImage("01002", "u", now)
+
+	if n := db.PurgeTrash(now.Add(-24 * time.Hour)); n != 1 {
+		t.Fatalf("PurgeTrash() = %d，預期 1", n)
+	}
+	if _, ok := db.Trash["01001"]; ok {
+		t.Error("過期的圖片仍在回收桶中")
+	}
+	if len(db.Revisions("01001")) != 0 {
+		t.Error("永久刪除的圖片仍有版本紀錄")
+	}
+	if _, ok := db.Trash["01002"]; !ok {
+		t.Error("未過期的圖片被永久刪除")
+	}
+}
+
+func TestTrashPurgerAllScopes(t *testing.T) {
+	dir := t.TempDir()
+	blobs, err := OpenBlobStore(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := time.Now().Add(-48 * time.Hour)
+	closedBlob := putTestBlob(t, blobs, 10, 72*time.Hour)
+	openBlob := putTestBlob(t, blobs, 20, 72*time.Hour)
+
+	err = SaveDatabase(filepath.Join(dir, "closed.json"), &ImageDB{
+		Trash: map[string]TrashedImage{"01001": {Image: ImageData{ID: "01001", Name: "c", Blob: closedBlob}, DeletedAt: expired}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := newTestRegistry(t, dir)
+	lib, err := registry.Library("open")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = lib.Transact(func(db *ImageDB) error {
+		db.PutImage(ImageData{ID: "01001", Name: "o", Blob: openBlob})
+		db.TrashImage("01001", "u", expired)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collector := NewBlobCollector(registry, blobs, nil, time.Hour)
+	if n := NewTrashPurger(registry, 24*time.Hour, collector).RunOnce(); n != 2 {
+		t.Errorf("RunOnce() = %d，預期 2", n)
+	}
+	if _, ok := registry.Opened()["closed"]; ok {
+		t.Error("清理回收桶時不應開啟尚未使用的圖庫")
+	}
+	err = registry.View("closed", func(db *ImageDB) error {
+		if len(db.Trash) != 0 {
+			t.Error("尚未開啟的圖庫的回收桶沒有被清理")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range []*BlobRef{closedBlob, openBlob} {
+		if _, err := os.Stat(blobs.path(ref.Hash)); !os.IsNotExist(err) {
+			t.Errorf("永久刪除的圖片的檔案 %s 沒有被回收", ref.Hash)
+		}
+	}
+}
@@ -1,11 +1,20 @@
 package main
 
 import (
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/etas94/godcbot/bot"
 )
 
 func main() {
 	bot.Start()
 
-	<-make(chan struct{})
+	// 等待結束訊號，讓機器人在關閉前保存圖庫
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	bot.Stop()
 }